@@ -15,6 +15,7 @@ import (
 	"xray-panel/internal/logger"
 	"xray-panel/internal/models"
 	"xray-panel/internal/nginx"
+	"xray-panel/internal/service"
 )
 
 var (
@@ -209,6 +210,11 @@ func nginxReload() {
 
 	cfg, _ := initSystem(*configPath)
 	ng := nginx.NewGenerator(cfg.Nginx.ConfigDir, cfg.Nginx.StreamDir)
+	m, err := service.New(cfg.NginxService(), "nginx")
+	if err != nil {
+		logger.Fatal("Nginx 服务配置无效: %v", err)
+	}
+	ng.SetService(m)
 
 	logger.Info("正在重载 Nginx...")
 
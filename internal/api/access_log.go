@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+	"xray-panel/internal/xray"
+)
+
+// maxAccessLogRead bounds how much of the access log is read per cycle
+const maxAccessLogRead = 8 << 20
+
+// accessLogIdle is how long the access log must go unwritten before a fully
+// read file is truncated
+const accessLogIdle = time.Minute
+
+// accessLogTail tracks the read position in the Xray access log
+type accessLogTail struct {
+	path   string
+	info   os.FileInfo
+	offset int64
+}
+
+// startAccessLogIngest starts a background goroutine that tails the Xray
+// access log and stores parsed connection records in the database.
+func (s *Server) startAccessLogIngest() {
+	interval := 15 * time.Second
+
+	go func() {
+		logger.Debug("Access log ingest worker started (interval: %v)", interval)
+
+		var tail *accessLogTail
+		lastPrune := time.Time{}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			opts := models.GetAccessLogOptions(s.db)
+			if !opts.Enabled {
+				tail = nil
+				continue
+			}
+			if tail == nil || tail.path != opts.Path {
+				// 从文件末尾开始，避免面板重启后重复导入
+				tail = &accessLogTail{path: opts.Path, offset: -1}
+			}
+			s.ingestAccessLog(tail)
+
+			if time.Since(lastPrune) > time.Hour {
+				if err := models.PruneAccessLogs(s.db, opts.RetentionDays); err != nil {
+					logger.Warn("Access log: prune failed: %v", err)
+				}
+				lastPrune = time.Now()
+			}
+		}
+	}()
+}
+
+// ingestAccessLog reads the lines appended since the last call. A replaced
+// or truncated file (log rotation) is read again from the start.
+func (s *Server) ingestAccessLog(tail *accessLogTail) {
+	f, err := os.Open(tail.path)
+	if err != nil {
+		logger.Debug("Access log: %v", err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if tail.offset < 0 {
+		tail.info, tail.offset = info, info.Size()
+		return
+	}
+	if !os.SameFile(tail.info, info) || info.Size() < tail.offset {
+		tail.offset = 0
+	}
+	tail.info = info
+	if info.Size() == tail.offset {
+		if tail.offset > 0 && time.Since(info.ModTime()) > accessLogIdle {
+			truncateAccessLog(tail)
+		}
+		return
+	}
+
+	buf := make([]byte, min(info.Size()-tail.offset, maxAccessLogRead))
+	n, err := f.ReadAt(buf, tail.offset)
+	if err != nil && err != io.EOF {
+		logger.Warn("Access log: read failed: %v", err)
+		return
+	}
+	buf = buf[:n]
+
+	// 只处理完整的行，未写完的行留到下次
+	end := bytes.LastIndexByte(buf, '\n')
+	if end < 0 {
+		if len(buf) == maxAccessLogRead {
+			tail.offset += int64(len(buf)) // 超长行直接跳过
+		}
+		return
+	}
+	tail.offset += int64(end + 1)
+
+	var records []models.AccessLog
+	for _, line := range bytes.Split(buf[:end], []byte{'\n'}) {
+		if record, ok := xray.ParseAccessLogLine(string(line), time.Local); ok {
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		return
+	}
+	if err := s.db.CreateInBatches(&records, 500).Error; err != nil {
+		logger.Error("Access log: failed to store %d records: %v", len(records), err)
+		return
+	}
+	logger.Debug("Access log: stored %d records", len(records))
+}
+
+// truncateAccessLog empties a fully read access log so it does not grow
+// forever. Xray opens the log in append mode, so it keeps writing from the
+// new end; the file is checked again right before to not lose a fresh line.
+func truncateAccessLog(tail *accessLogTail) {
+	info, err := os.Stat(tail.path)
+	if err != nil || !os.SameFile(info, tail.info) || info.Size() != tail.offset {
+		return
+	}
+	if err := os.Truncate(tail.path, 0); err != nil {
+		logger.Debug("Access log: truncate failed: %v", err)
+		return
+	}
+	if info, err := os.Stat(tail.path); err == nil {
+		tail.info = info
+	}
+	tail.offset = 0
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"xray-panel/internal/models"
+)
+
+func TestAccessLogTruncatedWhenIdle(t *testing.T) {
+	ts := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "access.log")
+	line := "2024/01/02 15:04:05 from 1.2.3.4:51234 accepted tcp:www.example.com:443 [vless-in -> proxy] email: alice\n"
+	os.WriteFile(path, nil, 0644)
+
+	tail := &accessLogTail{path: path, offset: -1}
+	ts.ingestAccessLog(tail)
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	defer f.Close()
+	f.WriteString(line)
+	ts.ingestAccessLog(tail)
+
+	var count int64
+	ts.db.Model(&models.AccessLog{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("stored %d records, want 1", count)
+	}
+
+	// Recently written: kept
+	ts.ingestAccessLog(tail)
+	if info, _ := os.Stat(path); info.Size() == 0 {
+		t.Fatal("access log truncated while still being written")
+	}
+
+	old := time.Now().Add(-2 * accessLogIdle)
+	os.Chtimes(path, old, old)
+	ts.ingestAccessLog(tail)
+	if info, _ := os.Stat(path); info.Size() != 0 || tail.offset != 0 {
+		t.Fatalf("idle access log not truncated: size %d offset %d", info.Size(), tail.offset)
+	}
+
+	// Xray keeps appending to the same file, read from the start
+	f.WriteString(line)
+	ts.ingestAccessLog(tail)
+	ts.db.Model(&models.AccessLog{}).Count(&count)
+	if count != 2 {
+		t.Errorf("stored %d records after truncation, want 2", count)
+	}
+}
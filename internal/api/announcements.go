@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/models"
+)
+
+// AnnouncementRequest represents the request to create or update an announcement
+type AnnouncementRequest struct {
+	Content string `json:"content" binding:"required"`
+	StartAt string `json:"start_at"` // RFC3339, empty = immediately
+	EndAt   string `json:"end_at"`   // RFC3339, empty = never ends
+	Enabled *bool  `json:"enabled"`  // defaults to true
+}
+
+// apply validates the request and copies it onto the announcement
+func (r *AnnouncementRequest) apply(a *models.Announcement) string {
+	content := strings.TrimSpace(r.Content)
+	if content == "" {
+		return "公告内容不能为空"
+	}
+	a.Content = content
+
+	a.StartAt = time.Time{}
+	if r.StartAt != "" {
+		t, err := time.Parse(time.RFC3339, r.StartAt)
+		if err != nil {
+			return "开始时间格式错误"
+		}
+		a.StartAt = t
+	}
+	a.EndAt = time.Time{}
+	if r.EndAt != "" {
+		t, err := time.Parse(time.RFC3339, r.EndAt)
+		if err != nil {
+			return "结束时间格式错误"
+		}
+		a.EndAt = t
+	}
+	if !a.StartAt.IsZero() && !a.EndAt.IsZero() && !a.EndAt.After(a.StartAt) {
+		return "结束时间必须晚于开始时间"
+	}
+
+	a.Enabled = r.Enabled == nil || *r.Enabled
+	return ""
+}
+
+// handleListAnnouncements returns all announcements with their current state
+func (s *Server) handleListAnnouncements(c *gin.Context) {
+	var announcements []models.Announcement
+	if err := s.db.Order("start_at desc, created_at desc").Find(&announcements).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to fetch announcements")
+		return
+	}
+
+	now := time.Now()
+	result := make([]gin.H, 0, len(announcements))
+	for _, a := range announcements {
+		result = append(result, gin.H{
+			"announcement": a,
+			"active":       a.IsActiveAt(now),
+		})
+	}
+	jsonOK(c, result)
+}
+
+// handleCreateAnnouncement creates an announcement
+func (s *Server) handleCreateAnnouncement(c *gin.Context) {
+	var req AnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		jsonError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	var a models.Announcement
+	if msg := req.apply(&a); msg != "" {
+		jsonError(c, http.StatusBadRequest, msg)
+		return
+	}
+	if err := s.db.Create(&a).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to create announcement")
+		return
+	}
+	jsonCreated(c, a)
+}
+
+// handleUpdateAnnouncement updates an announcement
+func (s *Server) handleUpdateAnnouncement(c *gin.Context) {
+	var a models.Announcement
+	if err := s.db.First(&a, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusNotFound, "Announcement not found")
+		return
+	}
+
+	var req AnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		jsonError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if msg := req.apply(&a); msg != "" {
+		jsonError(c, http.StatusBadRequest, msg)
+		return
+	}
+	if err := s.db.Save(&a).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to update announcement")
+		return
+	}
+	jsonOK(c, a)
+}
+
+// handleDeleteAnnouncement deletes an announcement
+func (s *Server) handleDeleteAnnouncement(c *gin.Context) {
+	if err := s.db.Delete(&models.Announcement{}, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to delete announcement")
+		return
+	}
+	jsonOK(c, gin.H{"deleted": true})
+}
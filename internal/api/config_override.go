@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+	"xray-panel/internal/xray"
+)
+
+// ConfigOverrideRequest carries a global override (merge patch or JSON Patch)
+type ConfigOverrideRequest struct {
+	Patch string `json:"patch"`
+}
+
+// handleGetConfigOverride returns the saved global override
+func (s *Server) handleGetConfigOverride(c *gin.Context) {
+	jsonOK(c, gin.H{"patch": models.GetConfigPatch(s.db)})
+}
+
+// handleUpdateConfigOverride saves the global override after checking that it
+// parses, applies cleanly to the current config and passes `xray -test`
+func (s *Server) handleUpdateConfigOverride(c *gin.Context) {
+	var req ConfigOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		jsonError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := xray.ValidatePatch(req.Patch); err != nil {
+		jsonError(c, http.StatusBadRequest, "覆盖配置格式错误: "+err.Error())
+		return
+	}
+	configJSON, err := s.xrayGenerator().SetConfigPatch(req.Patch).GenerateJSON()
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, "覆盖配置无法应用: "+err.Error())
+		return
+	}
+	if err := s.validateXrayConfig(configJSON); err != nil {
+		jsonError(c, http.StatusBadRequest, "覆盖后的配置校验失败: "+err.Error())
+		return
+	}
+
+	setting := models.Setting{Key: "xray_config_patch", Value: req.Patch, Type: "json"}
+	if err := s.db.Where("key = ?", setting.Key).Assign(setting).FirstOrCreate(&setting).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to save override")
+		return
+	}
+
+	logger.Info("Xray config override updated (%d bytes)", len(req.Patch))
+	jsonOK(c, gin.H{"updated": true})
+}
+
+// handlePreviewXrayConfig renders the config with the given (unsaved) global
+// override and runs it through `xray -test`, without touching the live config
+func (s *Server) handlePreviewXrayConfig(c *gin.Context) {
+	var req ConfigOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		jsonError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	configJSON, err := s.xrayGenerator().SetConfigPatch(req.Patch).GenerateJSON()
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, "生成配置失败: "+err.Error())
+		return
+	}
+
+	result := gin.H{
+		"config": string(configJSON),
+		"valid":  true,
+	}
+	if err := s.validateXrayConfig(configJSON); err != nil {
+		result["valid"] = false
+		result["error"] = err.Error()
+	}
+	jsonOK(c, result)
+}
+
+// validatePendingConfig runs `xray -test` on the current config with an
+// unsaved inbound or outbound in place (treated as enabled), so advanced JSON
+// that breaks Xray is rejected before it is stored
+func (s *Server) validatePendingConfig(inbound *models.Inbound, outbound *models.Outbound) error {
+	generator := s.xrayGenerator()
+	if inbound != nil {
+		var inbounds []models.Inbound
+		s.db.Preload("Domain").Where("enabled = ? AND id <> ?", true, inbound.ID).Find(&inbounds)
+		pending := *inbound
+		pending.Enabled = true
+		generator.SetInbounds(append(inbounds, pending))
+	}
+	if outbound != nil {
+		var outbounds []models.Outbound
+		s.db.Where("enabled = ? AND id <> ?", true, outbound.ID).Find(&outbounds)
+		pending := *outbound
+		pending.Enabled = true
+		generator.SetOutbounds(append(outbounds, pending))
+	}
+
+	configJSON, err := generator.GenerateJSON()
+	if err != nil {
+		return err
+	}
+	return s.validateXrayConfig(configJSON)
+}
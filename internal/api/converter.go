@@ -0,0 +1,376 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/models"
+	"xray-panel/internal/utils"
+	"xray-panel/internal/xray"
+)
+
+// convertedNode is one share link from an external subscription
+type convertedNode struct {
+	Link     string           // original share link, re-emitted as-is for base64/plain output
+	Outbound *models.Outbound // parsed form used for clash / sing-box / xray output
+}
+
+// handleConvertSubscription converts an external subscription into another format.
+// Input is either a remote subscription URL ("url") or uploaded content
+// ("content" field or "file" upload); both base64 and plain link lists are accepted.
+// Query/form params:
+//
+//	format  - clash | singbox | base64 | plain | xray (default base64)
+//	include - regexp, keep only nodes whose remark matches
+//	exclude - regexp, drop nodes whose remark matches
+func (s *Server) handleConvertSubscription(c *gin.Context) {
+	param := func(key string) string {
+		if v := c.PostForm(key); v != "" {
+			return v
+		}
+		return c.Query(key)
+	}
+
+	include, err := compileRemarkFilter(param("include"))
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, "include 过滤表达式无效: "+err.Error())
+		return
+	}
+	exclude, err := compileRemarkFilter(param("exclude"))
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, "exclude 过滤表达式无效: "+err.Error())
+		return
+	}
+
+	// Load subscription content
+	var data []byte
+	if subURL := strings.TrimSpace(param("url")); subURL != "" {
+		data, err = utils.FetchSubscription(subURL)
+		if err != nil {
+			jsonError(c, http.StatusBadGateway, err.Error())
+			return
+		}
+	} else if content := param("content"); content != "" {
+		data = []byte(content)
+	} else if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			jsonError(c, http.StatusBadRequest, "读取上传文件失败")
+			return
+		}
+		defer f.Close()
+		data, err = io.ReadAll(io.LimitReader(f, 10<<20))
+		if err != nil {
+			jsonError(c, http.StatusBadRequest, "读取上传文件失败")
+			return
+		}
+	} else {
+		jsonError(c, http.StatusBadRequest, "请提供订阅地址 (url) 或订阅内容 (content / file)")
+		return
+	}
+
+	// Parse and filter
+	var nodes []convertedNode
+	skipped := 0
+	for _, link := range utils.DecodeSubscription(data) {
+		outbound, err := utils.ParseShareLink(link)
+		if err != nil {
+			skipped++
+			continue
+		}
+		if include != nil && !include.MatchString(outbound.Remark) {
+			continue
+		}
+		if exclude != nil && exclude.MatchString(outbound.Remark) {
+			continue
+		}
+		nodes = append(nodes, convertedNode{Link: link, Outbound: outbound})
+	}
+	assignConvertedTags(nodes)
+
+	c.Header("X-Convert-Nodes", strconv.Itoa(len(nodes)))
+	c.Header("X-Convert-Skipped", strconv.Itoa(skipped))
+
+	format := param("format")
+	switch format {
+	case "base64", "":
+		links := make([]string, len(nodes))
+		for i, n := range nodes {
+			links[i] = n.Link
+		}
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.String(http.StatusOK, base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n"))))
+
+	case "plain", "txt", "t":
+		links := make([]string, len(nodes))
+		for i, n := range nodes {
+			links[i] = n.Link
+		}
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.String(http.StatusOK, strings.Join(links, "\n"))
+
+	case "clash", "yaml", "y":
+		c.Header("Content-Type", "text/yaml; charset=utf-8")
+		c.String(http.StatusOK, generateConvertedClash(nodes))
+
+	case "singbox", "sing-box", "sb":
+		out, err := json.MarshalIndent(generateConvertedSingBox(nodes), "", "  ")
+		if err != nil {
+			jsonError(c, http.StatusInternalServerError, "生成 sing-box 配置失败")
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", out)
+
+	case "xray", "json", "j":
+		outbounds := make([]models.Outbound, len(nodes))
+		for i, n := range nodes {
+			outbounds[i] = *n.Outbound
+		}
+		out, err := xray.NewGenerator().SetOutbounds(outbounds).GenerateOutboundsJSON()
+		if err != nil {
+			jsonError(c, http.StatusInternalServerError, "生成 Xray 配置失败")
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", out)
+
+	default:
+		jsonError(c, http.StatusBadRequest, "Unknown format. Supported: base64, plain, clash, singbox, xray")
+	}
+}
+
+// compileRemarkFilter compiles an optional remark filter, nil when empty
+func compileRemarkFilter(expr string) (*regexp.Regexp, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// assignConvertedTags gives every node a unique tag derived from its remark,
+// since share links from one provider often share the same server address
+func assignConvertedTags(nodes []convertedNode) {
+	used := make(map[string]bool)
+	for _, n := range nodes {
+		base := strings.TrimSpace(n.Outbound.Remark)
+		if base == "" {
+			base = n.Outbound.Tag
+		}
+		// A remark may itself look like a suffixed tag ("a-2"), so bump the
+		// suffix until the tag is really unused
+		tag := base
+		for i := 2; used[tag]; i++ {
+			tag = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[tag] = true
+		n.Outbound.Tag = tag
+	}
+}
+
+// convertedSNI returns the TLS server name of a parsed node
+func convertedSNI(o *models.Outbound) string {
+	if o.TLSServerName != "" {
+		return o.TLSServerName
+	}
+	if o.TrojanSNI != "" {
+		return o.TrojanSNI
+	}
+	return o.RequestHost
+}
+
+// convertedTLS reports whether a parsed node uses TLS (Trojan always does)
+func convertedTLS(o *models.Outbound) bool {
+	return o.TLS || o.Type == models.OutboundTrojan
+}
+
+// generateConvertedClash renders nodes as a Clash (mihomo) proxies list
+func generateConvertedClash(nodes []convertedNode) string {
+	var sb strings.Builder
+
+	sb.WriteString("# Clash Configuration\n")
+	sb.WriteString("# Converted by Xray Panel\n\n")
+	sb.WriteString("proxies:\n")
+
+	for _, n := range nodes {
+		o := n.Outbound
+		sb.WriteString(fmt.Sprintf("  - name: %s\n", strconv.Quote(o.Tag)))
+		sb.WriteString(fmt.Sprintf("    type: %s\n", o.Type))
+		sb.WriteString(fmt.Sprintf("    server: %s\n", o.Server))
+		sb.WriteString(fmt.Sprintf("    port: %d\n", o.Port))
+
+		switch o.Type {
+		case models.OutboundTrojan:
+			sb.WriteString(fmt.Sprintf("    password: %s\n", strconv.Quote(o.TrojanPassword)))
+		case models.OutboundVMess:
+			sb.WriteString(fmt.Sprintf("    uuid: %s\n", o.UUID))
+			sb.WriteString("    alterId: 0\n")
+			sb.WriteString(fmt.Sprintf("    cipher: %s\n", o.Security))
+		default:
+			sb.WriteString(fmt.Sprintf("    uuid: %s\n", o.UUID))
+			if o.Flow != "" {
+				sb.WriteString(fmt.Sprintf("    flow: %s\n", o.Flow))
+			}
+		}
+
+		network := o.Network
+		if network == "" {
+			network = "tcp"
+		}
+		sb.WriteString(fmt.Sprintf("    network: %s\n", network))
+		sb.WriteString("    udp: true\n")
+
+		if convertedTLS(o) {
+			if o.Type != models.OutboundTrojan {
+				sb.WriteString("    tls: true\n")
+			}
+			sni := convertedSNI(o)
+			if o.Reality {
+				sni = o.RealitySNI
+			}
+			if sni != "" {
+				if o.Type == models.OutboundTrojan {
+					sb.WriteString(fmt.Sprintf("    sni: %s\n", sni))
+				} else {
+					sb.WriteString(fmt.Sprintf("    servername: %s\n", sni))
+				}
+			}
+			sb.WriteString("    client-fingerprint: chrome\n")
+			if o.TLSALPN != "" && !o.Reality {
+				sb.WriteString("    alpn:\n")
+				for _, a := range strings.Split(o.TLSALPN, ",") {
+					sb.WriteString(fmt.Sprintf("      - %s\n", strings.TrimSpace(a)))
+				}
+			}
+			if o.Reality {
+				sb.WriteString("    reality-opts:\n")
+				sb.WriteString(fmt.Sprintf("      public-key: %s\n", o.RealityPubKey))
+				if o.RealityShortID != "" {
+					sb.WriteString(fmt.Sprintf("      short-id: %s\n", strconv.Quote(o.RealityShortID)))
+				}
+			}
+		}
+
+		switch network {
+		case "ws":
+			sb.WriteString("    ws-opts:\n")
+			sb.WriteString(fmt.Sprintf("      path: %s\n", strconv.Quote(o.Path)))
+			if o.RequestHost != "" {
+				sb.WriteString("      headers:\n")
+				sb.WriteString(fmt.Sprintf("        Host: %s\n", o.RequestHost))
+			}
+		case "grpc":
+			sb.WriteString("    grpc-opts:\n")
+			sb.WriteString(fmt.Sprintf("      grpc-service-name: %s\n", strconv.Quote(o.ServiceName)))
+		case "xhttp":
+			sb.WriteString("    xhttp-opts:\n")
+			sb.WriteString(fmt.Sprintf("      path: %s\n", strconv.Quote(o.Path)))
+			if o.RequestHost != "" {
+				sb.WriteString(fmt.Sprintf("      host: %s\n", o.RequestHost))
+			}
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// generateConvertedSingBox renders nodes as a sing-box outbounds fragment
+// with a selector grouping all nodes
+func generateConvertedSingBox(nodes []convertedNode) map[string]interface{} {
+	outbounds := make([]map[string]interface{}, 0, len(nodes)+2)
+	tags := make([]string, 0, len(nodes))
+
+	for _, n := range nodes {
+		o := n.Outbound
+		ob := map[string]interface{}{
+			"type":        string(o.Type),
+			"tag":         o.Tag,
+			"server":      o.Server,
+			"server_port": o.Port,
+		}
+
+		switch o.Type {
+		case models.OutboundTrojan:
+			ob["password"] = o.TrojanPassword
+		case models.OutboundVMess:
+			ob["uuid"] = o.UUID
+			ob["security"] = o.Security
+			ob["alter_id"] = 0
+		default:
+			ob["uuid"] = o.UUID
+			if o.Flow != "" {
+				ob["flow"] = o.Flow
+			}
+		}
+
+		if convertedTLS(o) {
+			tls := map[string]interface{}{
+				"enabled": true,
+				"utls": map[string]interface{}{
+					"enabled":     true,
+					"fingerprint": "chrome",
+				},
+			}
+			if o.Reality {
+				tls["server_name"] = o.RealitySNI
+				tls["reality"] = map[string]interface{}{
+					"enabled":    true,
+					"public_key": o.RealityPubKey,
+					"short_id":   o.RealityShortID,
+				}
+			} else {
+				if sni := convertedSNI(o); sni != "" {
+					tls["server_name"] = sni
+				}
+				if o.TLSALPN != "" {
+					tls["alpn"] = strings.Split(o.TLSALPN, ",")
+				}
+			}
+			ob["tls"] = tls
+		}
+
+		switch o.Network {
+		case "ws":
+			transport := map[string]interface{}{"type": "ws", "path": o.Path}
+			if o.RequestHost != "" {
+				transport["headers"] = map[string]string{"Host": o.RequestHost}
+			}
+			ob["transport"] = transport
+		case "grpc":
+			ob["transport"] = map[string]interface{}{"type": "grpc", "service_name": o.ServiceName}
+		case "http", "h2":
+			transport := map[string]interface{}{"type": "http", "path": o.Path}
+			if o.RequestHost != "" {
+				transport["host"] = []string{o.RequestHost}
+			}
+			ob["transport"] = transport
+		case "httpupgrade":
+			ob["transport"] = map[string]interface{}{"type": "httpupgrade", "path": o.Path, "host": o.RequestHost}
+		case "xhttp":
+			// sing-box 不支持 xhttp 传输，跳过该节点
+			continue
+		}
+
+		outbounds = append(outbounds, ob)
+		tags = append(tags, o.Tag)
+	}
+
+	if len(tags) > 0 {
+		outbounds = append([]map[string]interface{}{{
+			"type":      "selector",
+			"tag":       "proxy",
+			"outbounds": tags,
+		}}, outbounds...)
+	}
+	outbounds = append(outbounds, map[string]interface{}{"type": "direct", "tag": "direct"})
+
+	return map[string]interface{}{"outbounds": outbounds}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"xray-panel/internal/models"
+)
+
+var testShareLinks = []string{
+	"vless://11111111-1111-1111-1111-111111111111@hk.example.com:443?type=ws&security=tls&sni=hk.example.com&path=%2Fws&host=cdn.example.com#HK%2001",
+	"trojan://secret@jp.example.com:8443?security=tls&sni=jp.example.com#JP%2001",
+	"vless://22222222-2222-2222-2222-222222222222@us.example.com:443?type=grpc&security=reality&pbk=PUBKEY&sid=abcd&sni=www.microsoft.com&serviceName=grpc#US%2001",
+	"ss://unsupported@example.com:1#SS",
+}
+
+// newSubscriptionStub serves the test links base64 encoded, like an airport
+func newSubscriptionStub(t *testing.T, links []string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n")))))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func convert(ts *testServer, params url.Values) (string, http.Header) {
+	ts.t.Helper()
+	w := ts.do("GET", "/api/convert?"+params.Encode(), nil)
+	if w.Code != http.StatusOK {
+		ts.t.Fatalf("convert %v: HTTP %d %s", params, w.Code, w.Body.String())
+	}
+	return w.Body.String(), w.Header()
+}
+
+func TestConvertPlainAndFilters(t *testing.T) {
+	ts := newTestServer(t)
+	stub := newSubscriptionStub(t, testShareLinks)
+
+	body, header := convert(ts, url.Values{"url": {stub.URL}, "format": {"plain"}})
+	if got := header.Get("X-Convert-Nodes"); got != "3" {
+		t.Errorf("X-Convert-Nodes = %s, want 3", got)
+	}
+	if got := header.Get("X-Convert-Skipped"); got != "1" {
+		t.Errorf("X-Convert-Skipped = %s, want 1", got)
+	}
+	if want := strings.Join(testShareLinks[:3], "\n"); body != want {
+		t.Errorf("plain output:\n%s\nwant:\n%s", body, want)
+	}
+
+	body, _ = convert(ts, url.Values{"url": {stub.URL}, "format": {"base64"}, "include": {"^(HK|JP)"}, "exclude": {"JP"}})
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		t.Fatalf("base64 output: %v", err)
+	}
+	if string(decoded) != testShareLinks[0] {
+		t.Errorf("filtered output = %q, want only the HK link", decoded)
+	}
+
+	if w := ts.do("GET", "/api/convert?format=plain&include=(", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid include: HTTP %d, want 400", w.Code)
+	}
+}
+
+func TestConvertClash(t *testing.T) {
+	ts := newTestServer(t)
+	stub := newSubscriptionStub(t, testShareLinks)
+
+	body, _ := convert(ts, url.Values{"url": {stub.URL}, "format": {"clash"}})
+	for _, want := range []string{
+		"  - name: \"HK 01\"\n    type: vless\n    server: hk.example.com\n    port: 443\n    uuid: 11111111-1111-1111-1111-111111111111\n    network: ws\n",
+		"    tls: true\n    servername: hk.example.com\n",
+		"    ws-opts:\n      path: \"/ws\"\n      headers:\n        Host: cdn.example.com\n",
+		"  - name: \"JP 01\"\n    type: trojan\n    server: jp.example.com\n    port: 8443\n    password: \"secret\"\n",
+		"    sni: jp.example.com\n",
+		"    reality-opts:\n      public-key: PUBKEY\n      short-id: \"abcd\"\n",
+		"    grpc-opts:\n      grpc-service-name: \"grpc\"\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("clash output missing:\n%s\ngot:\n%s", want, body)
+		}
+	}
+}
+
+func TestConvertSingBoxAndXray(t *testing.T) {
+	ts := newTestServer(t)
+	stub := newSubscriptionStub(t, testShareLinks)
+
+	body, _ := convert(ts, url.Values{"url": {stub.URL}, "format": {"singbox"}})
+	var sb struct {
+		Outbounds []map[string]interface{} `json:"outbounds"`
+	}
+	if err := json.Unmarshal([]byte(body), &sb); err != nil {
+		t.Fatalf("sing-box output: %v", err)
+	}
+	if len(sb.Outbounds) != 5 {
+		t.Fatalf("sing-box outbounds = %d, want selector + 3 nodes + direct", len(sb.Outbounds))
+	}
+	if sb.Outbounds[0]["type"] != "selector" || len(sb.Outbounds[0]["outbounds"].([]interface{})) != 3 {
+		t.Errorf("selector = %v", sb.Outbounds[0])
+	}
+	us := sb.Outbounds[3]
+	tls, _ := us["tls"].(map[string]interface{})
+	reality, _ := tls["reality"].(map[string]interface{})
+	if us["tag"] != "US 01" || tls["server_name"] != "www.microsoft.com" || reality["public_key"] != "PUBKEY" {
+		t.Errorf("reality node = %v", us)
+	}
+
+	body, _ = convert(ts, url.Values{"url": {stub.URL}, "format": {"xray"}})
+	var xr struct {
+		Outbounds []struct {
+			Tag      string                 `json:"tag"`
+			Protocol string                 `json:"protocol"`
+			Settings map[string]interface{} `json:"settings"`
+		} `json:"outbounds"`
+	}
+	if err := json.Unmarshal([]byte(body), &xr); err != nil {
+		t.Fatalf("xray output: %v", err)
+	}
+	tags := map[string]string{}
+	for _, o := range xr.Outbounds {
+		tags[o.Tag] = o.Protocol
+	}
+	for tag, protocol := range map[string]string{"HK 01": "vless", "JP 01": "trojan", "US 01": "vless"} {
+		if tags[tag] != protocol {
+			t.Errorf("xray outbound %q = %q, want %q (got %v)", tag, tags[tag], protocol, tags)
+		}
+	}
+}
+
+func TestConvertUpstreamError(t *testing.T) {
+	ts := newTestServer(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	w := ts.do("GET", "/api/convert?url="+url.QueryEscape(srv.URL), nil)
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "HTTP 404") {
+		t.Errorf("upstream 404: HTTP %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAssignConvertedTagsUnique(t *testing.T) {
+	var nodes []convertedNode
+	for _, remark := range []string{"a", "a", "a-2", "", "a"} {
+		nodes = append(nodes, convertedNode{Outbound: &models.Outbound{Tag: "node", Remark: remark}})
+	}
+	assignConvertedTags(nodes)
+
+	var got []string
+	for _, n := range nodes {
+		got = append(got, n.Outbound.Tag)
+	}
+	if want := "a,a-2,a-2-2,node,a-3"; strings.Join(got, ",") != want {
+		t.Errorf("tags = %v, want %s", got, want)
+	}
+}
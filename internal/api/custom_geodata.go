@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+
+	"xray-panel/internal/geodata"
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+)
+
+// compileCustomGeoData writes custom.dat / customip.dat to the assets path
+// from the custom lists. A file is only written when lists of its type exist.
+// Returns the files that changed, for restoreCustomGeoData.
+func (s *Server) compileCustomGeoData() ([]string, error) {
+	var lists []models.CustomGeoList
+	if err := s.db.Order("tag ASC").Find(&lists).Error; err != nil {
+		return nil, err
+	}
+	if len(lists) == 0 {
+		return nil, nil
+	}
+	if s.config.Xray.AssetsPath == "" {
+		return nil, fmt.Errorf("未配置 xray.assets_path")
+	}
+
+	sites := make(map[string][]geodata.Domain)
+	ips := make(map[string][]netip.Prefix)
+	for _, list := range lists {
+		// 空列表也写入分类，保证引用它的规则能加载
+		if list.Type == models.CustomGeoIP {
+			ips[list.Tag] = []netip.Prefix{}
+		} else {
+			sites[list.Tag] = []geodata.Domain{}
+		}
+
+		for _, line := range list.EntryLines() {
+			if list.Type == models.CustomGeoIP {
+				prefix, err := geodata.ParseCIDRRule(line)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", list.Reference(), err)
+				}
+				ips[list.Tag] = append(ips[list.Tag], prefix)
+				continue
+			}
+			domain, err := geodata.ParseDomainRule(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", list.Reference(), err)
+			}
+			sites[list.Tag] = append(sites[list.Tag], domain)
+		}
+	}
+
+	files := make(map[string][]byte)
+	if len(sites) > 0 {
+		files[models.CustomGeoSiteFile] = geodata.EncodeGeoSite(sites)
+	}
+	if len(ips) > 0 {
+		files[models.CustomGeoIPFile] = geodata.EncodeGeoIP(ips)
+	}
+	changed, err := geodata.Install(s.config.Xray.AssetsPath, files)
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) > 0 {
+		logger.Info("Custom geo data compiled: %v", changed)
+	}
+	return changed, nil
+}
+
+// restoreCustomGeoData puts back the files replaced by compileCustomGeoData
+// when the config using them failed validation
+func (s *Server) restoreCustomGeoData(changed []string) {
+	for _, name := range changed {
+		var err error
+		if geodata.HasBackup(s.config.Xray.AssetsPath, name) {
+			err = geodata.Restore(s.config.Xray.AssetsPath, []string{name})
+		} else {
+			err = os.Remove(filepath.Join(s.config.Xray.AssetsPath, name))
+		}
+		if err != nil {
+			logger.Warn("Failed to restore %s: %v", name, err)
+		}
+	}
+}
@@ -64,6 +64,42 @@ func (s *Server) handleUpdateSettings(c *gin.Context) {
 		return
 	}
 
+	// 覆盖配置需经过格式与 xray -test 校验，只能通过专用接口保存
+	if _, ok := req["xray_config_patch"]; ok {
+		jsonError(c, http.StatusBadRequest, "xray_config_patch 请通过 PUT /api/xray/override 保存")
+		return
+	}
+
+	// TPROXY 与 TUN 互斥，只检查本次涉及的开关
+	_, tproxySet := req["tproxy_enabled"]
+	_, tunSet := req["tun_enabled"]
+	if tproxySet || tunSet {
+		tproxy := models.GetTransparentProxyOptions(s.db).Enabled
+		if tproxySet {
+			tproxy = req["tproxy_enabled"] == "true"
+		}
+		tun := models.GetTunOptions(s.db).Enabled
+		if tunSet {
+			tun = req["tun_enabled"] == "true"
+		}
+		if tproxy && tun {
+			jsonError(c, http.StatusBadRequest, "透明代理 (TPROXY) 与 TUN 不能同时启用，请先关闭另一项")
+			return
+		}
+	}
+
+	if tag, ok := req["client_proxy_group"]; ok && tag != "" {
+		var count int64
+		s.db.Model(&models.OutboundGroup{}).Where("tag = ?", tag).Count(&count)
+		if count == 0 {
+			s.db.Model(&models.SubscriptionSource{}).Where("group_tag = ?", tag).Count(&count)
+		}
+		if count == 0 {
+			jsonError(c, http.StatusBadRequest, "默认代理组不存在: "+tag)
+			return
+		}
+	}
+
 	for key, value := range req {
 		setting := models.Setting{Key: key, Value: value}
 		s.db.Where("key = ?", key).Assign(setting).FirstOrCreate(&setting)
@@ -74,21 +110,36 @@ func (s *Server) handleUpdateSettings(c *gin.Context) {
 
 // handleXrayStatus returns Xray service status
 func (s *Server) handleXrayStatus(c *gin.Context) {
-	// Check if Xray is running
-	cmd := exec.Command("systemctl", "is-active", "xray")
-	output, _ := cmd.Output()
-	status := string(output)
+	if s.xrayProcess != nil {
+		process := s.xrayProcess.Status()
+		status := "inactive"
+		if process.Running {
+			status = "active"
+		}
+		jsonOK(c, gin.H{
+			"status":     status,
+			"active":     process.Running,
+			"supervised": true,
+			"process":    process,
+		})
+		return
+	}
+
+	status, err := s.xrayService.Status()
+	if err != nil {
+		logger.Debug("Xray status (%s): %v", s.xrayService, err)
+	}
 
 	jsonOK(c, gin.H{
-		"status": status,
-		"active": status == "active\n",
+		"status":  status.State,
+		"active":  status.Active,
+		"manager": s.xrayService.String(),
 	})
 }
 
 // handleXrayRestart restarts Xray service
 func (s *Server) handleXrayRestart(c *gin.Context) {
-	cmd := exec.Command("systemctl", "restart", "xray")
-	if err := cmd.Run(); err != nil {
+	if err := s.restartXray(); err != nil {
 		jsonError(c, http.StatusInternalServerError, "Failed to restart Xray: "+err.Error())
 		return
 	}
@@ -115,7 +166,7 @@ func (s *Server) handleApplyXrayConfig(c *gin.Context) {
 
 	if hotReload {
 		// Use Xray API for hot reload
-		if err := s.applyXrayConfigHot(); err != nil {
+		if err := s.applyXrayConfigHot(c.GetString("username"), models.RevisionHot); err != nil {
 			jsonError(c, http.StatusInternalServerError, "Hot reload failed: "+err.Error())
 			return
 		}
@@ -136,18 +187,26 @@ func (s *Server) handleApplyXrayConfig(c *gin.Context) {
 		return
 	}
 
-	// 2. Write Xray config to file
-	if err := os.WriteFile(s.config.Xray.ConfigPath, configJSON, 0644); err != nil {
-		jsonError(c, http.StatusInternalServerError, "Failed to write Xray config: "+err.Error())
+	// 1.5. Compile the custom geosite / geoip lists the config may refer to
+	customGeoData, err := s.compileCustomGeoData()
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, "自定义 Geo 列表编译失败: "+err.Error())
 		return
 	}
 
-	// 2.5. Validate config before restarting
-	if err := s.validateXrayConfig(); err != nil {
+	// 2. Validate config before writing and restarting
+	if err := s.validateXrayConfig(configJSON); err != nil {
+		s.restoreCustomGeoData(customGeoData)
 		jsonError(c, http.StatusBadRequest, "配置校验失败，服务未重启: "+err.Error())
 		return
 	}
 
+	// 2.5. Write Xray config to file
+	if err := os.WriteFile(s.config.Xray.ConfigPath, configJSON, 0644); err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to write Xray config: "+err.Error())
+		return
+	}
+
 	// 3. Generate Nginx configs
 	var inbounds []models.Inbound
 	s.db.Preload("Domain").Where("enabled = ?", true).Find(&inbounds)
@@ -161,50 +220,61 @@ func (s *Server) handleApplyXrayConfig(c *gin.Context) {
 		return
 	}
 
-	// 4. Restart services
-	// Restart Xray
-	xrayCmd := exec.Command("systemctl", "restart", "xray")
-	if err := xrayCmd.Run(); err != nil {
+	// 4. Keep a revision of the written files for rollback
+	s.recordConfigRevision(configJSON, c.GetString("username"), models.RevisionApply, "")
+
+	// 5. Restart services
+	s.restartServices()
+
+	jsonOK(c, gin.H{
+		"applied":    true,
+		"method":     "restart",
+		"config_len": len(configJSON),
+		"message":    "配置已写入文件并重启服务",
+	})
+}
+
+// restartServices restarts Xray and reloads Nginx, logging failures
+func (s *Server) restartServices() {
+	if err := s.restartXray(); err != nil {
 		logger.Warn("Failed to restart Xray: %v", err)
 	} else {
 		logger.Info("Xray service restarted successfully")
 	}
 
-	// Reload Nginx
-	nginxCmd := exec.Command("sh", "-c", s.config.Nginx.ReloadCmd)
-	if err := nginxCmd.Run(); err != nil {
+	if _, err := s.nginxService.Reload(); err != nil {
 		logger.Warn("Failed to reload Nginx: %v", err)
 	} else {
 		logger.Info("Nginx reloaded successfully")
 	}
-
-	jsonOK(c, gin.H{
-		"applied":    true,
-		"method":     "restart",
-		"config_len": len(configJSON),
-		"message":    "配置已写入文件并重启服务",
-	})
 }
 
 // applyXrayConfigHot applies configuration by writing config and restarting Xray.
 // Full gRPC-based hot reload is not yet implemented; this is a functional fallback.
-func (s *Server) applyXrayConfigHot() error {
+// admin and method are recorded in the config revision.
+func (s *Server) applyXrayConfigHot(admin, method string) error {
 	configJSON, err := s.generateXrayConfig()
 	if err != nil {
 		return fmt.Errorf("failed to generate config: %w", err)
 	}
 
-	if err := os.WriteFile(s.config.Xray.ConfigPath, configJSON, 0644); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
+	customGeoData, err := s.compileCustomGeoData()
+	if err != nil {
+		return fmt.Errorf("自定义 Geo 列表编译失败: %w", err)
 	}
 
-	// Validate before restart
-	if err := s.validateXrayConfig(); err != nil {
+	// Validate before writing, so a broken config never replaces the running one
+	if err := s.validateXrayConfig(configJSON); err != nil {
+		s.restoreCustomGeoData(customGeoData)
 		return fmt.Errorf("配置校验失败: %w", err)
 	}
 
-	cmd := exec.Command("systemctl", "restart", "xray")
-	if err := cmd.Run(); err != nil {
+	if err := os.WriteFile(s.config.Xray.ConfigPath, configJSON, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	s.recordConfigRevision(configJSON, admin, method, "")
+
+	if err := s.restartXray(); err != nil {
 		return fmt.Errorf("failed to restart xray: %w", err)
 	}
 
@@ -212,15 +282,35 @@ func (s *Server) applyXrayConfigHot() error {
 	return nil
 }
 
-// validateXrayConfig runs `xray -test -c <config>` to validate the generated config.
-// Returns nil if valid, error with details if invalid.
-func (s *Server) validateXrayConfig() error {
+// validateXrayConfig runs `xray -test -c <config>` on the given config, written
+// to a temporary file. Returns nil if valid, error with details if invalid.
+func (s *Server) validateXrayConfig(configJSON []byte) error {
 	binaryPath := s.config.Xray.BinaryPath
 	if binaryPath == "" {
 		binaryPath = "/usr/local/bin/xray"
 	}
+	return s.validateXrayConfigWith(binaryPath, configJSON)
+}
 
-	cmd := exec.Command(binaryPath, "-test", "-c", s.config.Xray.ConfigPath)
+// validateXrayConfigWith validates the config with the given Xray binary,
+// loading geosite / geoip from the configured assets path
+func (s *Server) validateXrayConfigWith(binaryPath string, configJSON []byte) error {
+	// Xray picks the config format from the file extension
+	tmp, err := os.CreateTemp("", "xray-test-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temp config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(configJSON); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp config: %w", err)
+	}
+	tmp.Close()
+
+	cmd := exec.Command(binaryPath, "-test", "-c", tmp.Name())
+	if s.config.Xray.AssetsPath != "" {
+		cmd.Env = append(os.Environ(), "XRAY_LOCATION_ASSET="+s.config.Xray.AssetsPath)
+	}
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		logger.Error("Xray config validation failed: %s", string(output))
@@ -238,17 +328,34 @@ func (s *Server) validateXrayConfig() error {
 
 // generateXrayConfig creates the Xray configuration
 func (s *Server) generateXrayConfig() ([]byte, error) {
+	return s.xrayGenerator().GenerateJSON()
+}
+
+// xrayGenerator returns a generator loaded with the current database state
+func (s *Server) xrayGenerator() *xray.Generator {
 	var users []models.User
 	var inbounds []models.Inbound
 	var outbounds []models.Outbound
 	var rules []models.RoutingRule
 	var domains []models.Domain
+	var sources []models.SubscriptionSource
+	var groups []models.OutboundGroup
+	var dnsServers []models.DNSServer
+	var dnsHosts []models.DNSHost
+	var localInbounds []models.LocalInbound
+	var wgPeers []models.WireGuardPeer
 
 	s.db.Where("enabled = ?", true).Find(&users)
 	s.db.Preload("Domain").Where("enabled = ?", true).Find(&inbounds)
 	s.db.Where("enabled = ?", true).Find(&outbounds)
 	s.db.Where("enabled = ?", true).Order("priority ASC").Find(&rules)
 	s.db.Where("enabled = ?", true).Find(&domains)
+	s.db.Find(&sources)
+	s.db.Find(&groups) // disabled groups still reserve their tag (rules are blocked)
+	s.db.Order("priority ASC").Find(&dnsServers)
+	s.db.Find(&dnsHosts)
+	s.db.Order("port ASC").Find(&localInbounds)
+	s.db.Order("created_at ASC").Find(&wgPeers)
 
 	var modeSetting models.Setting
 	panelMode := "server"
@@ -264,12 +371,26 @@ func (s *Server) generateXrayConfig() ([]byte, error) {
 	generator.SetInbounds(inbounds)
 	generator.SetOutbounds(outbounds)
 	generator.SetRoutingRules(rules)
+	generator.SetSubscriptionSources(sources)
+	generator.SetOutboundGroups(groups)
+	generator.SetObservatory(models.GetObservatoryProbe(s.db))
+	generator.SetDNS(dnsServers, dnsHosts, models.GetDNSOptions(s.db))
+	generator.SetFakeDNS(models.GetFakeDNSOptions(s.db))
+	generator.SetLocalInbounds(localInbounds)
+	generator.SetTransparentProxy(models.GetTransparentProxyOptions(s.db))
+	generator.SetTun(models.GetTunOptions(s.db))
+	generator.SetWireGuardPeers(wgPeers)
 	generator.SetDomains(domains)
 	generator.SetAPIPort(s.config.Xray.APIPort)
 	generator.SetSocketDir(s.config.Xray.SocketDir)
 	generator.SetPanelMode(panelMode)
 	generator.SetClientRoutingMode(clientRoutingMode)
+	generator.SetClientProxyGroup(models.GetClientProxyGroup(s.db))
 	generator.SetDirectDomainStrategy(directDomainStrategy)
+	generator.SetConfigPatch(models.GetConfigPatch(s.db))
+	if accessLog := models.GetAccessLogOptions(s.db); accessLog.Enabled {
+		generator.SetAccessLog(accessLog.Path)
+	}
 
-	return generator.GenerateJSON()
+	return generator
 }
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"time"
+
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+	"xray-panel/internal/xray"
+)
+
+// syncOnlineIPs refreshes the online IP list of every enabled user from
+// Xray's statsUserOnline data and enforces per-user device limits.
+func (s *Server) syncOnlineIPs(client *xray.APIClient) {
+	if !client.IsHealthy() {
+		return // Xray not running, skip
+	}
+
+	var inbounds []models.Inbound
+	s.db.Where("enabled = ? AND protocol IN ?", true,
+		[]models.Protocol{models.ProtocolVLESS, models.ProtocolTrojan}).Find(&inbounds)
+
+	s.restoreKickedUsers(client, inbounds)
+
+	var users []models.User
+	if err := s.db.Where("enabled = ?", true).Find(&users).Error; err != nil {
+		logger.Error("Online IP sync: failed to fetch users: %v", err)
+		return
+	}
+
+	now := time.Now()
+	policy := models.GetDeviceLimitPolicy(s.db)
+	var online []models.UserOnlineIP
+	for _, user := range users {
+		ips, err := client.GetOnlineIPs(user.StatsKey())
+		if err != nil {
+			logger.Debug("Online IP sync: user %s: %v", user.Name, err)
+			continue
+		}
+		for ip, seen := range ips {
+			lastSeen := now
+			if seen > 0 {
+				lastSeen = time.Unix(seen, 0)
+			}
+			online = append(online, models.UserOnlineIP{UserID: user.ID, IP: ip, LastSeen: lastSeen})
+		}
+
+		if user.DeviceLimit > 0 && len(ips) > user.DeviceLimit && !user.KickedUntil.After(now) {
+			s.enforceDeviceLimit(client, user, len(ips), policy, inbounds)
+		}
+	}
+
+	// 在线列表每次整体替换，下线的 IP 自然消失
+	tx := s.db.Begin()
+	tx.Where("1 = 1").Delete(&models.UserOnlineIP{})
+	if len(online) > 0 {
+		tx.Create(&online)
+	}
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("Online IP sync: failed to save online IPs: %v", err)
+	}
+}
+
+// enforceDeviceLimit applies the configured action to a user that is online
+// from more IPs than its device limit allows
+func (s *Server) enforceDeviceLimit(client *xray.APIClient, user models.User, count int, policy models.DeviceLimitPolicy, inbounds []models.Inbound) {
+	switch policy.Action {
+	case models.DeviceLimitKick:
+		until := time.Now().Add(policy.KickDuration)
+		s.removeUserFromXray(client, user, inbounds)
+		s.db.Model(&models.User{}).Where("id = ?", user.ID).Update("kicked_until", until)
+		logger.Warn("Device limit: user %s online from %d IPs (limit %d), removed until %s",
+			user.Name, count, user.DeviceLimit, until.Format("15:04:05"))
+
+	case models.DeviceLimitDisable:
+		s.removeUserFromXray(client, user, inbounds)
+		s.db.Model(&models.User{}).Where("id = ?", user.ID).Update("enabled", false)
+		logger.Warn("Device limit: user %s online from %d IPs (limit %d), disabled",
+			user.Name, count, user.DeviceLimit)
+
+	default:
+		logger.Warn("Device limit: user %s online from %d IPs (limit %d)",
+			user.Name, count, user.DeviceLimit)
+	}
+}
+
+// restoreKickedUsers adds users whose kick has expired back to Xray
+func (s *Server) restoreKickedUsers(client *xray.APIClient, inbounds []models.Inbound) {
+	var users []models.User
+	s.db.Where("kicked_until > ? AND kicked_until <= ?", time.Time{}, time.Now()).Find(&users)
+
+	for _, user := range users {
+		if user.IsActive() {
+			for _, inbound := range inbounds {
+				if err := client.AddUser(inbound.Tag, xray.UserClient(inbound.Protocol, user)); err != nil {
+					logger.Warn("Device limit: failed to restore user %s to %s: %v", user.Name, inbound.Tag, err)
+				}
+			}
+			logger.Info("Device limit: user %s restored", user.Name)
+		}
+		s.db.Model(&models.User{}).Where("id = ?", user.ID).Update("kicked_until", time.Time{})
+	}
+}
+
+// removeUserFromXray removes a user from all user-bearing inbounds of the
+// running Xray without regenerating the config
+func (s *Server) removeUserFromXray(client *xray.APIClient, user models.User, inbounds []models.Inbound) {
+	for _, inbound := range inbounds {
+		if err := client.RemoveUser(inbound.Tag, user.StatsKey()); err != nil {
+			logger.Warn("Device limit: failed to remove user %s from %s: %v", user.Name, inbound.Tag, err)
+		}
+	}
+}
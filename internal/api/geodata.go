@@ -0,0 +1,265 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/geodata"
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+)
+
+// geoDataFiles are the data files managed by the updater
+var geoDataFiles = []string{"geosite.dat", "geoip.dat"}
+
+// geoDataUpdateMu serializes geo data updates (background job and manual update)
+var geoDataUpdateMu sync.Mutex
+
+// startGeoDataUpdate starts a background goroutine that downloads geosite.dat
+// and geoip.dat when the configured interval has elapsed.
+func (s *Server) startGeoDataUpdate() {
+	interval := 10 * time.Minute
+
+	go func() {
+		time.Sleep(time.Minute)
+		logger.Debug("Geo data update worker started (interval: %v)", interval)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			opts := models.GetGeoDataOptions(s.db)
+			last, ok := models.LastGeoDataUpdate(s.db)
+			if opts.Enabled && (!ok || time.Since(last.CreatedAt) >= opts.Interval) {
+				s.updateGeoData("schedule")
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// updateGeoData downloads and activates new geo data. After the files are
+// replaced the config is validated and Xray restarted; if either fails the
+// previous files are restored.
+func (s *Server) updateGeoData(trigger string) models.GeoDataUpdate {
+	geoDataUpdateMu.Lock()
+	defer geoDataUpdateMu.Unlock()
+
+	opts := models.GetGeoDataOptions(s.db)
+	var sources []geodata.UpdateSource
+	if opts.GeoSiteURL != "" {
+		sources = append(sources, geodata.UpdateSource{Name: "geosite.dat", URL: opts.GeoSiteURL, ChecksumURL: opts.GeoSiteSHA256URL})
+	}
+	if opts.GeoIPURL != "" {
+		sources = append(sources, geodata.UpdateSource{Name: "geoip.dat", URL: opts.GeoIPURL, ChecksumURL: opts.GeoIPSHA256URL})
+	}
+
+	update := models.GeoDataUpdate{Trigger: trigger}
+	changed, err := geodata.Update(s.config.Xray.AssetsPath, sources)
+	switch {
+	case len(sources) == 0:
+		update.Result, update.Message = models.GeoDataFailed, "未配置下载地址"
+	case err != nil:
+		update.Result, update.Message = models.GeoDataFailed, err.Error()
+	case len(changed) == 0:
+		update.Result, update.Message = models.GeoDataUnchanged, "已是最新"
+	default:
+		update.Files = strings.Join(changed, ", ")
+		if err := s.activateGeoData(changed); err != nil {
+			update.Result, update.Message = models.GeoDataFailed, err.Error()
+		} else {
+			update.Result, update.Message = models.GeoDataUpdated, "已更新并重启 Xray"
+		}
+	}
+
+	s.recordGeoDataUpdate(&update)
+	return update
+}
+
+// activateGeoData validates the config against the replaced files and
+// restarts Xray, restoring the previous files on failure
+func (s *Server) activateGeoData(changed []string) error {
+	err := s.validateActiveConfig()
+	if err == nil {
+		err = s.restartXray()
+	}
+	if err == nil {
+		return nil
+	}
+
+	if restoreErr := geodata.Restore(s.config.Xray.AssetsPath, changed); restoreErr != nil {
+		logger.Error("Geo data: failed to restore previous files: %v", restoreErr)
+		return err
+	}
+	s.restartXray()
+	return fmt.Errorf("%w，已恢复旧文件", err)
+}
+
+// validateActiveConfig validates the config Xray loads on its next restart
+func (s *Server) validateActiveConfig() error {
+	configJSON, err := s.activeXrayConfig()
+	if err != nil {
+		return err
+	}
+	return s.validateXrayConfig(configJSON)
+}
+
+// recordGeoDataUpdate stores an update record and logs its result
+func (s *Server) recordGeoDataUpdate(update *models.GeoDataUpdate) {
+	if update.Result == models.GeoDataFailed {
+		logger.Warn("Geo data update (%s) failed: %s", update.Trigger, update.Message)
+	} else {
+		logger.Info("Geo data update (%s): %s %s", update.Trigger, update.Result, update.Files)
+	}
+
+	if err := s.db.Create(update).Error; err != nil {
+		logger.Error("Failed to record geo data update: %v", err)
+		return
+	}
+	if err := models.PruneGeoDataUpdates(s.db); err != nil {
+		logger.Warn("Failed to prune geo data updates: %v", err)
+	}
+}
+
+// handleUpdateGeoData runs a geo data update now
+func (s *Server) handleUpdateGeoData(c *gin.Context) {
+	update := s.updateGeoData("manual")
+	if update.Result == models.GeoDataFailed {
+		jsonError(c, http.StatusBadGateway, "更新失败: "+update.Message)
+		return
+	}
+	jsonOK(c, update)
+}
+
+// handleRestoreGeoData swaps the data files with their previous version
+func (s *Server) handleRestoreGeoData(c *gin.Context) {
+	geoDataUpdateMu.Lock()
+	defer geoDataUpdateMu.Unlock()
+
+	var files []string
+	for _, name := range geoDataFiles {
+		if geodata.HasBackup(s.config.Xray.AssetsPath, name) {
+			files = append(files, name)
+		}
+	}
+	if len(files) == 0 {
+		jsonError(c, http.StatusBadRequest, "没有可恢复的旧版本")
+		return
+	}
+
+	if err := geodata.Restore(s.config.Xray.AssetsPath, files); err != nil {
+		jsonError(c, http.StatusInternalServerError, "恢复失败: "+err.Error())
+		return
+	}
+	update := models.GeoDataUpdate{Trigger: "manual", Files: strings.Join(files, ", ")}
+	if err := s.activateGeoData(files); err != nil {
+		update.Result, update.Message = models.GeoDataFailed, "恢复后 "+err.Error()
+		s.recordGeoDataUpdate(&update)
+		jsonError(c, http.StatusInternalServerError, update.Message)
+		return
+	}
+
+	update.Result, update.Message = models.GeoDataRestored, "已恢复上一版本并重启 Xray"
+	s.recordGeoDataUpdate(&update)
+	jsonOK(c, update)
+}
+
+// maxGeoDataListing bounds the entries returned by the geo data browser
+const maxGeoDataListing = 2000
+
+// handleGetGeoSiteCategory lists the rules of a geosite category, optionally
+// filtered by attribute (attr) and substring (q)
+func (s *Server) handleGetGeoSiteCategory(c *gin.Context) {
+	index, err := geodata.NewGeoDataParser(s.config.Xray.AssetsPath).GeoSite()
+	if err != nil {
+		jsonError(c, http.StatusInternalServerError, "读取 geosite.dat 失败: "+err.Error())
+		return
+	}
+
+	category := c.Param("category")
+	domains, ok := index.Domains(category, c.Query("attr"))
+	if !ok {
+		jsonError(c, http.StatusNotFound, "geosite 分类不存在: "+category)
+		return
+	}
+	if q := strings.ToLower(strings.TrimSpace(c.Query("q"))); q != "" {
+		var filtered []geodata.Domain
+		for _, d := range domains {
+			if strings.Contains(strings.ToLower(d.Value), q) {
+				filtered = append(filtered, d)
+			}
+		}
+		domains = filtered
+	}
+
+	total := len(domains)
+	if total > maxGeoDataListing {
+		domains = domains[:maxGeoDataListing]
+	}
+	jsonOK(c, gin.H{
+		"category": strings.ToLower(category),
+		"total":    total,
+		"domains":  domains,
+	})
+}
+
+// handleGetGeoIPCode lists the CIDRs of a geoip code
+func (s *Server) handleGetGeoIPCode(c *gin.Context) {
+	index, err := geodata.NewGeoDataParser(s.config.Xray.AssetsPath).GeoIP()
+	if err != nil {
+		jsonError(c, http.StatusInternalServerError, "读取 geoip.dat 失败: "+err.Error())
+		return
+	}
+
+	code := c.Param("code")
+	prefixes, ok := index.CIDRs(code)
+	if !ok {
+		jsonError(c, http.StatusNotFound, "geoip 代码不存在: "+code)
+		return
+	}
+
+	total := len(prefixes)
+	cidrs := make([]string, 0, min(total, maxGeoDataListing))
+	for _, p := range prefixes[:min(total, maxGeoDataListing)] {
+		cidrs = append(cidrs, p.String())
+	}
+	jsonOK(c, gin.H{
+		"code":  strings.ToLower(code),
+		"total": total,
+		"cidrs": cidrs,
+	})
+}
+
+// handleGeoDataLookup finds the geoip codes containing an IP, or the geosite
+// categories matching a domain
+func (s *Server) handleGeoDataLookup(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		jsonError(c, http.StatusBadRequest, "请输入域名或 IP")
+		return
+	}
+	parser := geodata.NewGeoDataParser(s.config.Xray.AssetsPath)
+
+	if addr, err := netip.ParseAddr(q); err == nil {
+		index, err := parser.GeoIP()
+		if err != nil {
+			jsonError(c, http.StatusInternalServerError, "读取 geoip.dat 失败: "+err.Error())
+			return
+		}
+		jsonOK(c, gin.H{"type": "ip", "query": q, "geoip": index.Lookup(addr)})
+		return
+	}
+
+	index, err := parser.GeoSite()
+	if err != nil {
+		jsonError(c, http.StatusInternalServerError, "读取 geosite.dat 失败: "+err.Error())
+		return
+	}
+	jsonOK(c, gin.H{"type": "domain", "query": q, "geosite": index.Lookup(q)})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"xray-panel/internal/config"
+	"xray-panel/internal/database"
+	"xray-panel/internal/logger"
+)
+
+// testServer is a panel server on an in-memory database with an admin session
+type testServer struct {
+	*Server
+	t     *testing.T
+	token string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	logger.Init(&config.LogConfig{Level: "error"})
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	// 内存库每个连接独立，限制为单连接
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.Xray.Service.Manager = "none"
+	cfg.Xray.AssetsPath = t.TempDir()
+	cfg.Xray.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	cfg.Nginx.Service.Manager = "none"
+	cfg.Nginx.ConfigDir = t.TempDir()
+	cfg.Nginx.StreamDir = t.TempDir()
+	if err := database.Seed(db, cfg); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{Username: "admin"}).SignedString([]byte(cfg.JWT.Secret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return &testServer{Server: NewServer(cfg, db), t: t, token: token}
+}
+
+// do sends an authenticated request; form values are sent url-encoded
+func (ts *testServer) do(method, path string, form url.Values) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req := httptest.NewRequest(method, path, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: ts.token})
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+	"xray-panel/internal/xray"
+)
+
+// localInboundTagPattern restricts local inbound tags
+var localInboundTagPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// handleLocalInboundsTable renders the client-mode local inbounds with the
+// port conflicts of the generated config
+func (s *Server) handleLocalInboundsTable(c *gin.Context) {
+	var locals []models.LocalInbound
+	if err := s.db.Order("port ASC").Find(&locals).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error loading local inbounds")
+		return
+	}
+
+	// 服务端模式不生成本地入站，按客户端模式检查冲突
+	var conflicts []string
+	if cfg, err := s.xrayGenerator().SetPanelMode("client").Generate(); err == nil {
+		conflicts = xray.PortConflicts(cfg.Inbounds)
+	}
+
+	c.HTML(http.StatusOK, "components/local-inbounds-table.html", gin.H{
+		"Locals":    locals,
+		"Conflicts": conflicts,
+		"PanelMode": models.GetPanelMode(s.db),
+	})
+}
+
+// bindLocalInbound reads and validates the local inbound form
+func (s *Server) bindLocalInbound(c *gin.Context, l *models.LocalInbound) string {
+	l.Tag = strings.TrimSpace(c.PostForm("tag"))
+	l.Protocol = models.LocalInboundProtocol(c.PostForm("protocol"))
+	l.Listen = strings.TrimSpace(c.PostForm("listen"))
+	l.Port, _ = strconv.Atoi(strings.TrimSpace(c.PostForm("port")))
+	l.Username = strings.TrimSpace(c.PostForm("username"))
+	l.UDP = c.PostForm("udp") == "on"
+	l.Sniffing = c.PostForm("sniffing") == "on"
+	l.SniffingRouteOnly = c.PostForm("sniffing_route_only") == "on"
+	l.SniffingDestOverride = strings.ToLower(c.PostForm("sniffing_dest_override"))
+	l.SniffingDestOverride = strings.Join(l.DestOverrideList(), ",") // 统一为逗号分隔
+	l.Remark = c.PostForm("remark")
+	// 编辑时密码留空表示不修改
+	if password := c.PostForm("password"); password != "" || l.Username == "" {
+		l.Password = password
+	}
+
+	switch l.Protocol {
+	case models.LocalInboundSocks, models.LocalInboundHTTP, models.LocalInboundDNS:
+	default:
+		return "无效的协议"
+	}
+	if !localInboundTagPattern.MatchString(l.Tag) {
+		return "标签只能包含字母、数字和 _ . -"
+	}
+	switch l.Tag {
+	case "api", "dns-out", "direct", "block", models.TransparentProxyTag, models.TunTag:
+		return "标签 " + l.Tag + " 为保留标签"
+	}
+	var count int64
+	s.db.Model(&models.Inbound{}).Where("tag = ?", l.Tag).Count(&count)
+	if count > 0 {
+		return "标签与入站 " + l.Tag + " 重复"
+	}
+	s.db.Model(&models.LocalInbound{}).Where("tag = ? AND id <> ?", l.Tag, l.ID).Count(&count)
+	if count > 0 {
+		return "标签已存在: " + l.Tag
+	}
+
+	if l.Listen == "" {
+		l.Listen = "127.0.0.1"
+	}
+	if _, err := netip.ParseAddr(l.Listen); err != nil {
+		return "监听地址必须是 IP，如 127.0.0.1 或 0.0.0.0"
+	}
+	if l.Port < 1 || l.Port > 65535 {
+		return "端口无效"
+	}
+	if l.Username != "" && l.Password == "" {
+		return "设置用户名时必须填写密码"
+	}
+	for _, p := range l.DestOverrideList() {
+		switch p {
+		case "http", "tls", "quic":
+		default:
+			return "不支持的嗅探协议: " + p + "（fakedns 在启用 FakeDNS 时自动加入）"
+		}
+	}
+	return ""
+}
+
+func (s *Server) handleCreateLocalInbound(c *gin.Context) {
+	var l models.LocalInbound
+	if msg := s.bindLocalInbound(c, &l); msg != "" {
+		jsonError(c, http.StatusBadRequest, msg)
+		return
+	}
+	l.Enabled = true
+
+	if err := s.db.Create(&l).Error; err != nil {
+		logger.Error("Failed to create local inbound %s: %v", l.Tag, err)
+		jsonError(c, http.StatusInternalServerError, "创建失败: "+err.Error())
+		return
+	}
+
+	logger.Info("Local inbound created: %s %s %s:%d", l.Tag, l.Protocol, l.Listen, l.Port)
+	s.handleLocalInboundsTable(c)
+}
+
+func (s *Server) handleUpdateLocalInbound(c *gin.Context) {
+	var l models.LocalInbound
+	if err := s.db.First(&l, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusNotFound, "Local inbound not found")
+		return
+	}
+	if msg := s.bindLocalInbound(c, &l); msg != "" {
+		jsonError(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := s.db.Save(&l).Error; err != nil {
+		logger.Error("Failed to update local inbound %s: %v", l.ID, err)
+		jsonError(c, http.StatusInternalServerError, "更新失败: "+err.Error())
+		return
+	}
+
+	logger.Info("Local inbound updated: %s %s %s:%d", l.Tag, l.Protocol, l.Listen, l.Port)
+	s.handleLocalInboundsTable(c)
+}
+
+func (s *Server) handleToggleLocalInbound(c *gin.Context) {
+	var l models.LocalInbound
+	if err := s.db.First(&l, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusNotFound, "Local inbound not found")
+		return
+	}
+
+	l.Enabled = !l.Enabled
+	if err := s.db.Save(&l).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "更新失败: "+err.Error())
+		return
+	}
+
+	logger.Info("Local inbound toggled: %s (Enabled: %v)", l.Tag, l.Enabled)
+	s.handleLocalInboundsTable(c)
+}
+
+func (s *Server) handleDeleteLocalInbound(c *gin.Context) {
+	if err := s.db.Delete(&models.LocalInbound{}, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "删除失败")
+		return
+	}
+	c.String(http.StatusOK, "")
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/models"
+	"xray-panel/internal/xray"
+)
+
+// outboundGroupStatus is the live balancer state of an outbound group
+type outboundGroupStatus struct {
+	Strategy models.BalancerStrategy `json:"strategy"`
+	Info     string                  `json:"info,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+// handleOutboundGroupsStatus queries the running Xray for the current
+// selection of every enabled group, reflecting the latest observatory results
+func (s *Server) handleOutboundGroupsStatus(c *gin.Context) {
+	var groups []models.OutboundGroup
+	if err := s.db.Where("enabled = ?", true).Find(&groups).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to load outbound groups")
+		return
+	}
+
+	apiClient := xray.NewAPIClientWithBinary(
+		"127.0.0.1",
+		s.config.Xray.APIPort,
+		s.config.Xray.BinaryPath,
+	)
+
+	status := make(map[string]outboundGroupStatus, len(groups))
+	for _, grp := range groups {
+		st := outboundGroupStatus{Strategy: grp.Strategy}
+		info, err := apiClient.GetBalancerInfo(grp.Tag)
+		if err != nil {
+			st.Error = err.Error()
+		} else {
+			st.Info = info
+		}
+		status[grp.Tag] = st
+	}
+
+	jsonOK(c, status)
+}
@@ -74,14 +74,20 @@ func (s *Server) testOutboundViaXray(outbound models.Outbound) OutboundTestResul
 	// 2. Build a minimal Xray config JSON directly
 	//    (The Generator only handles vless/trojan/wireguard inbounds,
 	//     so we construct the test config by hand.)
-	outbound.Enabled = true // Force enable for test
+	chain, err := s.outboundTestChain(outbound)
+	if err != nil {
+		return OutboundTestResult{Success: false, Message: err.Error(), Endpoint: endpoint}
+	}
+	if len(chain) > 1 {
+		endpoint = chainEndpoint(chain)
+	}
 
 	gen := xray.NewGenerator()
-	gen.SetOutbounds([]models.Outbound{outbound})
+	gen.SetOutbounds(chain)
 	gen.SetDirectDomainStrategy(models.GetDirectDomainStrategy(s.db))
 
 	// Use the generator only for the outbound section
-	configJSON, err := gen.GenerateTestJSON(proxyPort)
+	configJSON, err := gen.GenerateTestJSON(proxyPort, outbound.Tag)
 	if err != nil {
 		return OutboundTestResult{Success: false, Message: "Config build failed: " + err.Error(), Endpoint: endpoint}
 	}
@@ -145,6 +151,37 @@ func (s *Server) testOutboundViaXray(outbound models.Outbound) OutboundTestResul
 	return OutboundTestResult{Success: false, Message: fmt.Sprintf("Unexpected HTTP status: %d", resp.StatusCode), Latency: latency, Endpoint: endpoint}
 }
 
+// outboundTestChain returns the outbound and all of its upstreams (DialerProxy),
+// force-enabled so the whole chain is tested end to end
+func (s *Server) outboundTestChain(outbound models.Outbound) ([]models.Outbound, error) {
+	outbounds := []models.Outbound{outbound}
+	if outbound.DialerProxy != "" {
+		var all []models.Outbound
+		if err := s.db.Where("id <> ?", outbound.ID).Find(&all).Error; err != nil {
+			return nil, fmt.Errorf("Failed to load outbounds: %v", err)
+		}
+		outbounds = append(outbounds, all...)
+	}
+
+	chain, err := models.ResolveOutboundChain(outbounds, outbound.Tag)
+	if err != nil {
+		return nil, err
+	}
+	for i := range chain {
+		chain[i].Enabled = true // Force enable for test
+	}
+	return chain, nil
+}
+
+// chainEndpoint describes a chain as "tag(server:port) -> upstream(...)"
+func chainEndpoint(chain []models.Outbound) string {
+	parts := make([]string, 0, len(chain))
+	for _, o := range chain {
+		parts = append(parts, fmt.Sprintf("%s(%s:%d)", o.Tag, o.Server, o.Port))
+	}
+	return strings.Join(parts, " -> ")
+}
+
 // parseWireGuardConfig parses a WireGuard configuration string (from ProtonVPN, etc.)
 func parseWireGuardConfig(config string) map[string]string {
 	result := make(map[string]string)
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/geodata"
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+	"xray-panel/internal/nginx"
+	"xray-panel/internal/utils"
+)
+
+// recordConfigRevision stores the just-written Xray config together with the
+// current managed nginx files. Failures are logged and never block an apply.
+func (s *Server) recordConfigRevision(configJSON []byte, admin, method, rollbackOf string) {
+	nginxGen := nginx.NewGenerator(s.config.Nginx.ConfigDir, s.config.Nginx.StreamDir)
+	files, err := nginxGen.ManagedFiles()
+	if err != nil {
+		logger.Warn("Config revision: failed to read nginx files: %v", err)
+	}
+	filesJSON, _ := json.Marshal(files)
+
+	// 自定义 Geo 文件随配置一起保存，回滚时恢复同一版本
+	geoData := make(map[string][]byte)
+	for _, name := range []string{models.CustomGeoSiteFile, models.CustomGeoIPFile} {
+		if s.config.Xray.AssetsPath == "" {
+			break
+		}
+		if data, err := os.ReadFile(filepath.Join(s.config.Xray.AssetsPath, name)); err == nil {
+			geoData[name] = data
+		}
+	}
+	geoDataJSON, _ := json.Marshal(geoData)
+
+	hash, err := models.SnapshotHash(s.db)
+	if err != nil {
+		logger.Warn("Config revision: failed to hash database: %v", err)
+	}
+
+	rev := models.ConfigRevision{
+		Method:     method,
+		Admin:      admin,
+		DBHash:     hash,
+		XrayConfig: string(configJSON),
+		NginxFiles: string(filesJSON),
+		GeoData:    string(geoDataJSON),
+		RollbackOf: rollbackOf,
+	}
+	if err := s.db.Create(&rev).Error; err != nil {
+		logger.Error("Failed to record config revision: %v", err)
+		return
+	}
+	if err := models.PruneConfigRevisions(s.db); err != nil {
+		logger.Warn("Failed to prune config revisions: %v", err)
+	}
+	logger.Info("Config revision recorded: %s (%s by %s)", rev.ID, method, admin)
+}
+
+// readXrayConfigFile returns the on-disk Xray config, or "" if it does not exist
+func (s *Server) readXrayConfigFile() string {
+	data, err := os.ReadFile(s.config.Xray.ConfigPath)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// activeXrayConfig returns the config Xray loads on its next restart: the
+// on-disk config, or the generated one when none has been written yet
+func (s *Server) activeXrayConfig() ([]byte, error) {
+	if data := s.readXrayConfigFile(); data != "" {
+		return []byte(data), nil
+	}
+	configJSON, err := s.generateXrayConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate config: %w", err)
+	}
+	return configJSON, nil
+}
+
+// handleXrayConfigDiff compares the on-disk Xray config with the config the
+// next apply would write
+func (s *Server) handleXrayConfigDiff(c *gin.Context) {
+	pending, err := s.generateXrayConfig()
+	if err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to generate config: "+err.Error())
+		return
+	}
+
+	diff := utils.UnifiedDiff(s.readXrayConfigFile(), string(pending), s.config.Xray.ConfigPath, "待应用配置", 3)
+	jsonOK(c, gin.H{
+		"changed": diff != "",
+		"diff":    diff,
+	})
+}
+
+// handleRevisionDiff compares the on-disk files with a revision, i.e. what a
+// rollback to it would change
+func (s *Server) handleRevisionDiff(c *gin.Context) {
+	var rev models.ConfigRevision
+	if err := s.db.First(&rev, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	xrayDiff := utils.UnifiedDiff(s.readXrayConfigFile(), rev.XrayConfig, s.config.Xray.ConfigPath, "revision "+rev.ID[:8], 3)
+
+	nginxGen := nginx.NewGenerator(s.config.Nginx.ConfigDir, s.config.Nginx.StreamDir)
+	current, err := nginxGen.ManagedFiles()
+	if err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to read nginx files: "+err.Error())
+		return
+	}
+	saved := rev.NginxFileMap()
+
+	paths := make(map[string]bool)
+	for p := range current {
+		paths[p] = true
+	}
+	for p := range saved {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var nginxDiff string
+	for _, p := range sorted {
+		nginxDiff += utils.UnifiedDiff(current[p], saved[p], p, p+" (revision)", 3)
+	}
+
+	jsonOK(c, gin.H{
+		"xray":  xrayDiff,
+		"nginx": nginxDiff,
+	})
+}
+
+// handleRevisionConfig returns the Xray config stored in a revision
+func (s *Server) handleRevisionConfig(c *gin.Context) {
+	var rev models.ConfigRevision
+	if err := s.db.First(&rev, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	c.Header("Content-Type", "application/json")
+	c.String(http.StatusOK, rev.XrayConfig)
+}
+
+// handleRollbackRevision restores a revision's Xray, custom geo data and nginx
+// files and restarts the services. The database is left unchanged, so the next apply
+// regenerates the configs from the current data.
+func (s *Server) handleRollbackRevision(c *gin.Context) {
+	var rev models.ConfigRevision
+	if err := s.db.First(&rev, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	// Put back the custom geo data the revision was validated with; older
+	// revisions without it get the lists compiled from the current data
+	var customGeoData []string
+	var err error
+	if files := rev.GeoDataFiles(); len(files) > 0 {
+		customGeoData, err = geodata.Install(s.config.Xray.AssetsPath, files)
+	} else {
+		customGeoData, err = s.compileCustomGeoData()
+	}
+	if err != nil {
+		jsonError(c, http.StatusInternalServerError, "恢复自定义 Geo 列表失败: "+err.Error())
+		return
+	}
+
+	configJSON := []byte(rev.XrayConfig)
+	if err := s.validateXrayConfig(configJSON); err != nil {
+		s.restoreCustomGeoData(customGeoData)
+		jsonError(c, http.StatusBadRequest, "配置校验失败，未回滚: "+err.Error())
+		return
+	}
+
+	nginxGen := nginx.NewGenerator(s.config.Nginx.ConfigDir, s.config.Nginx.StreamDir)
+	if err := nginxGen.RestoreManagedFiles(rev.NginxFileMap()); err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to restore Nginx config: "+err.Error())
+		return
+	}
+	if err := os.WriteFile(s.config.Xray.ConfigPath, configJSON, 0644); err != nil {
+		jsonError(c, http.StatusInternalServerError, "Failed to write Xray config: "+err.Error())
+		return
+	}
+
+	admin := c.GetString("username")
+	s.recordConfigRevision(configJSON, admin, models.RevisionRollback, rev.ID)
+	s.restartServices()
+
+	logger.Info("Config rolled back to revision %s by %s", rev.ID, admin)
+	jsonOK(c, gin.H{
+		"rolled_back": true,
+		"message":     "已回滚到所选版本并重启服务",
+	})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"xray-panel/internal/models"
+)
+
+// useXrayStub points the server at a fake xray binary whose -test always passes
+func useXrayStub(ts *testServer) {
+	ts.t.Helper()
+	bin := filepath.Join(ts.t.TempDir(), "xray")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		ts.t.Fatalf("write xray stub: %v", err)
+	}
+	ts.config.Xray.BinaryPath = bin
+}
+
+func TestRollbackRestoresCustomGeoData(t *testing.T) {
+	ts := newTestServer(t)
+	useXrayStub(ts)
+	customDat := filepath.Join(ts.config.Xray.AssetsPath, models.CustomGeoSiteFile)
+
+	list := models.CustomGeoList{Tag: "mine", Type: models.CustomGeoSite, Entries: "old.example"}
+	ts.db.Create(&list)
+	if _, err := ts.compileCustomGeoData(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	oldDat, _ := os.ReadFile(customDat)
+	ts.recordConfigRevision([]byte(`{"old":true}`), "admin", models.RevisionApply, "")
+	var rev models.ConfigRevision
+	ts.db.Order("created_at DESC").First(&rev)
+
+	ts.db.Model(&list).Update("entries", "new.example")
+	if _, err := ts.compileCustomGeoData(); err != nil {
+		t.Fatalf("recompile: %v", err)
+	}
+	if newDat, _ := os.ReadFile(customDat); bytes.Equal(newDat, oldDat) {
+		t.Fatal("custom.dat did not change with the list")
+	}
+
+	w := ts.do("POST", "/api/revisions/"+rev.ID+"/rollback", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rollback: HTTP %d %s", w.Code, w.Body.String())
+	}
+	if got, _ := os.ReadFile(customDat); !bytes.Equal(got, oldDat) {
+		t.Error("rollback did not restore the revision's custom.dat")
+	}
+	if got, _ := os.ReadFile(ts.config.Xray.ConfigPath); string(got) != `{"old":true}` {
+		t.Errorf("rollback wrote config %q", got)
+	}
+}
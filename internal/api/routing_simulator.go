@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/xray"
+)
+
+// handleSimulateRouting reports which rule and outbound a connection would
+// take. The generated config is used by default, so unapplied changes can be
+// checked; source=active uses the config Xray runs with.
+func (s *Server) handleSimulateRouting(c *gin.Context) {
+	var req xray.SimulateRequest
+	if err := c.ShouldBind(&req); err != nil {
+		jsonError(c, http.StatusBadRequest, "参数无效: "+err.Error())
+		return
+	}
+
+	var configJSON []byte
+	var err error
+	if c.Query("source") == "active" {
+		configJSON, err = s.activeXrayConfig()
+	} else {
+		configJSON, err = s.generateXrayConfig()
+	}
+	if err != nil {
+		jsonError(c, http.StatusInternalServerError, "生成配置失败: "+err.Error())
+		return
+	}
+
+	sim, err := xray.NewSimulation(configJSON, s.config.Xray.AssetsPath)
+	if err != nil {
+		jsonError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result, err := sim.Run(req)
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	jsonOK(c, result)
+}
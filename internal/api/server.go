@@ -15,7 +15,9 @@ import (
 	"xray-panel/internal/logger"
 	"xray-panel/internal/models"
 	"xray-panel/internal/nginx"
+	"xray-panel/internal/service"
 	"xray-panel/internal/web"
+	"xray-panel/internal/xray"
 )
 
 // loginRateLimiter is a simple in-memory rate limiter for login attempts
@@ -68,6 +70,11 @@ type Server struct {
 	templates  *template.Template
 	webHandler *web.Handler
 	nginxGen   *nginx.ConfigGenerator
+
+	xrayService  service.Manager
+	nginxService service.Manager
+	xrayProcess  *xray.Process // 面板守护的 Xray 子进程，未启用 supervise 时为 nil
+	xrayBinaries *xray.BinaryStore
 }
 
 // NewServer creates a new API server
@@ -94,21 +101,37 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 		panic("Failed to load templates: " + err.Error())
 	}
 
+	// Service managers for xray and nginx
+	nginxService, err := service.New(cfg.NginxService(), "nginx")
+	if err != nil {
+		panic("Invalid nginx service config: " + err.Error())
+	}
+	xrayService, err := service.New(cfg.Xray.Service, "xray")
+	if err != nil {
+		panic("Invalid xray service config: " + err.Error())
+	}
+
 	// Create Nginx config generator
 	nginxGen := nginx.NewGenerator(cfg.Nginx.ConfigDir, cfg.Nginx.StreamDir)
 	nginxGen.SetDB(db)
 	nginxGen.SetSocketDir(cfg.Xray.SocketDir)
-	if cfg.Nginx.ReloadCmd != "" {
-		nginxGen.SetReloadCmd(cfg.Nginx.ReloadCmd)
-	}
+	nginxGen.SetService(nginxService)
 
 	s := &Server{
-		config:     cfg,
-		db:         db,
-		router:     gin.Default(),
-		embedFiles: webFS,
-		templates:  templates,
-		nginxGen:   nginxGen,
+		config:       cfg,
+		db:           db,
+		router:       gin.Default(),
+		embedFiles:   webFS,
+		templates:    templates,
+		nginxGen:     nginxGen,
+		xrayService:  xrayService,
+		nginxService: nginxService,
+		xrayBinaries: xray.NewBinaryStore(cfg.Xray.BinaryDir, cfg.Xray.BinaryPath),
+	}
+
+	if cfg.Xray.Supervise {
+		s.xrayProcess = xray.NewProcess(cfg.Xray.BinaryPath, cfg.Xray.ConfigPath, cfg.Xray.AssetsPath)
+		s.xrayService = supervisedXray{s.xrayProcess}
 	}
 
 	// Set HTML templates
@@ -116,6 +139,7 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 
 	// Create web handler with DB and Nginx generator
 	s.webHandler = web.NewHandler(db, nginxGen)
+	s.webHandler.SetConfigValidator(s.validatePendingConfig)
 
 	s.setupRoutes()
 	return s
@@ -123,7 +147,15 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 
 // Run starts the server
 func (s *Server) Run() error {
+	if s.xrayProcess != nil {
+		s.startXrayProcess()
+	}
 	s.startTrafficSync()
+	s.startSubscriptionSync()
+	s.startAccessLogIngest()
+	s.startGeoDataUpdate()
+	s.applyTransparentProxyOnStart()
+	s.startTunWatch()
 	return s.router.Run(s.config.Server.Listen)
 }
 
@@ -161,8 +193,12 @@ func (s *Server) setupRoutes() {
 		pages.GET("/inbounds", s.webHandler.InboundsPage)
 		pages.GET("/outbounds", s.webHandler.OutboundsPage)
 		pages.GET("/routing", s.webHandler.RoutingPage)
+		pages.GET("/dns", s.webHandler.DNSPage)
 		pages.GET("/domains", s.webHandler.DomainsPage)
 		pages.GET("/settings", s.webHandler.SettingsPage)
+		pages.GET("/revisions", s.webHandler.RevisionsPage)
+		pages.GET("/xray-binaries", s.webHandler.XrayBinariesPage)
+		pages.GET("/access-logs", s.webHandler.AccessLogsPage)
 	}
 
 	// Form routes (return HTML forms)
@@ -176,16 +212,36 @@ func (s *Server) setupRoutes() {
 		// Inbound forms
 		forms.GET("/inbounds/new", s.webHandler.NewInboundForm)
 		forms.GET("/inbounds/:id/edit", s.webHandler.EditInboundForm)
-		forms.GET("/inbounds/:id/wg-client", s.webHandler.WGClientConfig)
+		forms.GET("/inbounds/:id/wg-client", s.handleWGPeers)
 
 		// Outbound forms
 		forms.GET("/outbounds/new", s.webHandler.NewOutboundForm)
 		forms.GET("/outbounds/import", s.webHandler.ImportOutboundForm)
 		forms.GET("/outbounds/:id/edit", s.webHandler.EditOutboundForm)
 
+		// Subscription source forms
+		forms.GET("/subscription-sources/new", s.webHandler.NewSubscriptionSourceForm)
+		forms.GET("/subscription-sources/:id/edit", s.webHandler.EditSubscriptionSourceForm)
+		forms.GET("/outbound-groups/new", s.webHandler.NewOutboundGroupForm)
+		forms.GET("/outbound-groups/:id/edit", s.webHandler.EditOutboundGroupForm)
+
 		// Routing forms
 		forms.GET("/routing/new", s.webHandler.NewRoutingForm)
 		forms.GET("/routing/:id/edit", s.webHandler.EditRoutingForm)
+		forms.GET("/routing/geodata", s.webHandler.GeoDataBrowser)
+		forms.GET("/routing/simulate", s.webHandler.RoutingSimulator)
+		forms.GET("/routing/custom-geo/new", s.webHandler.NewCustomGeoListForm)
+		forms.GET("/routing/custom-geo/:id/edit", s.webHandler.EditCustomGeoListForm)
+
+		// Local inbound forms
+		forms.GET("/inbounds/local/new", s.webHandler.NewLocalInboundForm)
+		forms.GET("/inbounds/local/:id/edit", s.webHandler.EditLocalInboundForm)
+
+		// DNS forms
+		forms.GET("/dns/servers/new", s.webHandler.NewDNSServerForm)
+		forms.GET("/dns/servers/:id/edit", s.webHandler.EditDNSServerForm)
+		forms.GET("/dns/hosts/new", s.webHandler.NewDNSHostForm)
+		forms.GET("/dns/hosts/:id/edit", s.webHandler.EditDNSHostForm)
 
 		// Domain forms
 		forms.GET("/domains/new", s.webHandler.NewDomainForm)
@@ -227,6 +283,12 @@ func (s *Server) setupRoutes() {
 		api.POST("/inbounds/:id/toggle", s.webHandler.ToggleInbound)
 		api.DELETE("/inbounds/:id", s.webHandler.DeleteInbound)
 
+		// WireGuard peers (per-user / relay node provisioning)
+		api.POST("/inbounds/:id/wg-peers", s.handleCreateWGPeer)
+		api.POST("/inbounds/:id/wg-peers/:peer/toggle", s.handleToggleWGPeer)
+		api.GET("/inbounds/:id/wg-peers/:peer/conf", s.handleWGPeerConf)
+		api.DELETE("/inbounds/:id/wg-peers/:peer", s.handleDeleteWGPeer)
+
 		// Outbounds
 		api.GET("/outbounds/table", s.webHandler.OutboundsTable)
 		api.GET("/outbounds/:id", s.handleGetOutbound)
@@ -239,15 +301,69 @@ func (s *Server) setupRoutes() {
 		api.POST("/outbounds/:id/test", s.handleTestOutbound)
 		api.DELETE("/outbounds/:id", s.webHandler.DeleteOutbound)
 
+		// Subscription sources (remote subscriptions kept in sync as outbounds)
+		api.GET("/subscription-sources/table", s.webHandler.SubscriptionSourcesTable)
+		api.POST("/subscription-sources", s.webHandler.CreateSubscriptionSource)
+		api.POST("/subscription-sources/:id", s.webHandler.UpdateSubscriptionSource)
+		api.POST("/subscription-sources/:id/toggle", s.webHandler.ToggleSubscriptionSource)
+		api.POST("/subscription-sources/:id/refresh", s.handleRefreshSubscriptionSource)
+		api.DELETE("/subscription-sources/:id", s.webHandler.DeleteSubscriptionSource)
+
+		// Outbound groups (balancers)
+		api.GET("/outbound-groups/table", s.webHandler.OutboundGroupsTable)
+		api.GET("/outbound-groups/status", s.handleOutboundGroupsStatus)
+		api.POST("/outbound-groups", s.webHandler.CreateOutboundGroup)
+		api.POST("/outbound-groups/:id", s.webHandler.UpdateOutboundGroup)
+		api.POST("/outbound-groups/:id/toggle", s.webHandler.ToggleOutboundGroup)
+		api.DELETE("/outbound-groups/:id", s.webHandler.DeleteOutboundGroup)
+
 		// Routing
 		api.GET("/routing/table", s.webHandler.RoutingTable)
 		api.GET("/routing/geodata", s.handleGetGeoData)
+		api.GET("/routing/geodata/updates", s.webHandler.GeoDataUpdatesTable)
+		api.POST("/routing/geodata/update", s.handleUpdateGeoData)
+		api.POST("/routing/geodata/restore", s.handleRestoreGeoData)
+		api.GET("/routing/geodata/lookup", s.handleGeoDataLookup)
+		api.GET("/routing/geodata/geosite/:category", s.handleGetGeoSiteCategory)
+		api.GET("/routing/geodata/geoip/:code", s.handleGetGeoIPCode)
+		api.GET("/routing/custom-geo/table", s.webHandler.CustomGeoListsTable)
+		api.POST("/routing/custom-geo", s.webHandler.CreateCustomGeoList)
+		api.POST("/routing/custom-geo/:id", s.webHandler.UpdateCustomGeoList)
+		api.DELETE("/routing/custom-geo/:id", s.webHandler.DeleteCustomGeoList)
+		api.POST("/routing/simulate", s.handleSimulateRouting)
 		api.POST("/routing/preset/:preset", s.handleImportPresetRules)
 		api.POST("/routing", s.webHandler.CreateRouting)
 		api.POST("/routing/:id", s.webHandler.UpdateRouting)
 		api.POST("/routing/:id/toggle", s.webHandler.ToggleRouting)
 		api.DELETE("/routing/:id", s.webHandler.DeleteRouting)
 
+		// Client-mode local inbounds
+		api.GET("/local-inbounds/table", s.handleLocalInboundsTable)
+		api.POST("/local-inbounds", s.handleCreateLocalInbound)
+		api.POST("/local-inbounds/:id", s.handleUpdateLocalInbound)
+		api.POST("/local-inbounds/:id/toggle", s.handleToggleLocalInbound)
+		api.DELETE("/local-inbounds/:id", s.handleDeleteLocalInbound)
+
+		// Client-mode transparent proxy gateway
+		api.POST("/tproxy/apply", s.handleApplyTransparentProxy)
+		api.POST("/tproxy/remove", s.handleRemoveTransparentProxy)
+
+		// Client-mode TUN routes
+		api.POST("/tun/apply", s.handleApplyTun)
+		api.POST("/tun/remove", s.handleRemoveTun)
+
+		// DNS
+		api.GET("/dns/servers/table", s.webHandler.DNSServersTable)
+		api.POST("/dns/servers", s.webHandler.CreateDNSServer)
+		api.POST("/dns/servers/:id", s.webHandler.UpdateDNSServer)
+		api.POST("/dns/servers/:id/toggle", s.webHandler.ToggleDNSServer)
+		api.DELETE("/dns/servers/:id", s.webHandler.DeleteDNSServer)
+		api.GET("/dns/hosts/table", s.webHandler.DNSHostsTable)
+		api.POST("/dns/hosts", s.webHandler.CreateDNSHost)
+		api.POST("/dns/hosts/:id", s.webHandler.UpdateDNSHost)
+		api.POST("/dns/hosts/:id/toggle", s.webHandler.ToggleDNSHost)
+		api.DELETE("/dns/hosts/:id", s.webHandler.DeleteDNSHost)
+
 		// Domains
 		api.GET("/domains/table", s.webHandler.DomainsTable)
 		api.GET("/domains/scan-certs", s.handleScanCertificates)
@@ -262,10 +378,41 @@ func (s *Server) setupRoutes() {
 		api.POST("/xray/restart", s.handleXrayRestart)
 		api.GET("/xray/config", s.handleGetXrayConfig)
 		api.POST("/xray/apply", s.handleApplyXrayConfig)
+		api.POST("/xray/preview", s.handlePreviewXrayConfig)
+		api.GET("/xray/override", s.handleGetConfigOverride)
+		api.PUT("/xray/override", s.handleUpdateConfigOverride)
+		api.GET("/xray/diff", s.handleXrayConfigDiff)
+
+		// Xray binaries
+		api.GET("/xray/binaries/table", s.handleXrayBinariesTable)
+		api.POST("/xray/binaries", s.handleUploadXrayBinary)
+		api.POST("/xray/binaries/rollback", s.handleRollbackXrayBinary)
+		api.POST("/xray/binaries/:version/test", s.handleTestXrayBinary)
+		api.POST("/xray/binaries/:version/activate", s.handleActivateXrayBinary)
+		api.DELETE("/xray/binaries/:version", s.handleDeleteXrayBinary)
+
+		// Config revisions
+		api.GET("/revisions/table", s.webHandler.RevisionsTable)
+		api.GET("/revisions/:id/diff", s.handleRevisionDiff)
+		api.GET("/revisions/:id/config", s.handleRevisionConfig)
+		api.POST("/revisions/:id/rollback", s.handleRollbackRevision)
+
+		// Access logs
+		api.GET("/access-logs/table", s.webHandler.AccessLogsTable)
 
 		// Settings
 		api.GET("/settings", s.handleGetSettings)
 		api.PUT("/settings", s.handleUpdateSettings)
+
+		// Subscription converter (external subscription URL / content)
+		api.GET("/convert", s.handleConvertSubscription)
+		api.POST("/convert", s.handleConvertSubscription)
+
+		// Subscription announcements
+		api.GET("/announcements", s.handleListAnnouncements)
+		api.POST("/announcements", s.handleCreateAnnouncement)
+		api.POST("/announcements/:id", s.handleUpdateAnnouncement)
+		api.DELETE("/announcements/:id", s.handleDeleteAnnouncement)
 	}
 
 	// Subscription routes (public, rate-limited)
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xray-panel/internal/models"
+)
+
+// putSettings sends a settings update as the settings page does
+func putSettings(ts *testServer, body string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	req := httptest.NewRequest("PUT", "/api/settings", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: ts.token})
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSettingsTProxyTunExclusive(t *testing.T) {
+	ts := newTestServer(t)
+
+	if w := putSettings(ts, `{"tproxy_enabled":"true"}`); w.Code != http.StatusOK {
+		t.Fatalf("enable tproxy: HTTP %d %s", w.Code, w.Body.String())
+	}
+	if w := putSettings(ts, `{"tun_enabled":"true"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("enabling tun with tproxy on: HTTP %d, want 400", w.Code)
+	}
+	if models.GetTunOptions(ts.db).Enabled {
+		t.Error("tun_enabled saved although tproxy is on")
+	}
+	if w := putSettings(ts, `{"tproxy_enabled":"false","tun_enabled":"true"}`); w.Code != http.StatusOK {
+		t.Errorf("switching from tproxy to tun: HTTP %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGenerateRejectsTProxyWithTun(t *testing.T) {
+	ts := newTestServer(t)
+	for _, key := range []string{"panel_mode", "tproxy_enabled", "tun_enabled"} {
+		value := "true"
+		if key == "panel_mode" {
+			value = "client"
+		}
+		ts.db.Model(&models.Setting{}).Where("key = ?", key).Update("value", value)
+	}
+
+	if _, err := ts.generateXrayConfig(); err == nil {
+		t.Error("config generated with both TPROXY and TUN enabled")
+	}
+}
+
+func TestSettingsClientProxyGroup(t *testing.T) {
+	ts := newTestServer(t)
+
+	if w := putSettings(ts, `{"client_proxy_group":"missing"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown group: HTTP %d, want 400", w.Code)
+	}
+	ts.db.Create(&models.OutboundGroup{Tag: "auto", Strategy: models.BalancerRandom, Members: "hk"})
+	if w := putSettings(ts, `{"client_proxy_group":"auto"}`); w.Code != http.StatusOK {
+		t.Errorf("existing group: HTTP %d %s", w.Code, w.Body.String())
+	}
+	if got := models.GetClientProxyGroup(ts.db); got != "auto" {
+		t.Errorf("client_proxy_group = %q, want auto", got)
+	}
+}
+
+func TestSettingsRejectConfigPatch(t *testing.T) {
+	ts := newTestServer(t)
+
+	if w := putSettings(ts, `{"xray_config_patch":"not json"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("config patch via settings: HTTP %d, want 400", w.Code)
+	}
+	if got := models.GetConfigPatch(ts.db); got != "" {
+		t.Errorf("xray_config_patch = %q, want it unchanged", got)
+	}
+}
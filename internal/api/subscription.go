@@ -28,38 +28,49 @@ func (s *Server) handleSubscription(c *gin.Context) {
 		return
 	}
 
-	// Check if user is active
-	if !user.IsActive() {
+	// Disabled users are rejected outright. Expired / over-quota users get a
+	// single explanatory node instead of a 403, which most clients only show
+	// as an unreadable error.
+	if !user.Enabled {
 		c.String(http.StatusForbidden, "Subscription expired or disabled")
 		return
 	}
 
-	// Get all enabled inbounds with domains (AGGREGATED SUBSCRIPTION)
+	var links []string
 	var inbounds []models.Inbound
-	if err := s.db.Preload("Domain").Where("enabled = ?", true).Find(&inbounds).Error; err != nil {
-		c.String(http.StatusInternalServerError, "Failed to generate subscription")
-		return
-	}
+	notices := subscriptionNotices(s.db, user)
 
-	// Generate links for all inbounds
-	// Skip inbounds marked as exclude_from_sub (e.g. WireGuard relay inbounds)
-	var links []string
-	for _, inbound := range inbounds {
-		if inbound.ExcludeFromSub {
-			continue
-		}
-		var link string
-		switch inbound.Protocol {
-		case models.ProtocolTrojan:
-			link = generateTrojanLink(user, inbound)
-		default:
-			link = generateVLESSLink(user, inbound)
+	if user.IsActive() {
+		// Get all enabled inbounds with domains (AGGREGATED SUBSCRIPTION)
+		if err := s.db.Preload("Domain").Where("enabled = ?", true).Find(&inbounds).Error; err != nil {
+			c.String(http.StatusInternalServerError, "Failed to generate subscription")
+			return
 		}
-		if link != "" {
-			links = append(links, link)
+
+		// Generate links for all inbounds
+		// Skip inbounds marked as exclude_from_sub (e.g. WireGuard relay inbounds)
+		for _, inbound := range inbounds {
+			if inbound.ExcludeFromSub {
+				continue
+			}
+			for _, node := range inboundNodes(inbound) {
+				switch inbound.Protocol {
+				case models.ProtocolTrojan:
+					links = append(links, generateTrojanLink(user, inbound, node))
+				default:
+					links = append(links, generateVLESSLink(user, inbound, node))
+				}
+			}
 		}
 	}
 
+	// Informational pseudo-nodes go first so they are visible at the top of the node list
+	infoLinks := make([]string, 0, len(notices))
+	for _, notice := range notices {
+		infoLinks = append(infoLinks, generateInfoLink(notice))
+	}
+	links = append(infoLinks, links...)
+
 	// Calculate user info
 	uploadBytes := int64(0) // Upload/download combined in TrafficUsed
 	downloadBytes := user.TrafficUsed
@@ -130,11 +141,12 @@ func (s *Server) handleSubscription(c *gin.Context) {
 				"remaining_traffic": user.RemainingTraffic(),
 				"is_active":         user.IsActive(),
 			},
+			"notices": notices,
 		})
 
 	case "yaml", "y", "clash":
 		// YAML proxy config format
-		clashConfig := generateClashConfig(user, inbounds)
+		clashConfig := generateClashConfig(user, inbounds, notices)
 		c.Header("Content-Type", "text/yaml; charset=utf-8")
 		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.yaml", filename))
 		c.String(http.StatusOK, clashConfig)
@@ -144,30 +156,93 @@ func (s *Server) handleSubscription(c *gin.Context) {
 	}
 }
 
-// generateVLESSLink generates a VLESS share link for a specific inbound
-func generateVLESSLink(user models.User, inbound models.Inbound) string {
-	sniDomain := ""
+// subNode is one client-facing entry of an inbound in a subscription.
+// An inbound yields one node per connect endpoint.
+type subNode struct {
+	SNI    string // TLS SNI (reverse proxy subdomain)
+	Server string // address the client connects to
+	Port   int    // port the client connects to (Nginx / CDN)
+	Suffix string // remark suffix distinguishing endpoints, empty for the default node
+}
+
+// inboundSNI returns the SNI domain of an inbound, or "" if it has none
+func inboundSNI(inbound models.Inbound) string {
 	if inbound.Domain != nil {
-		sniDomain = inbound.Domain.Domain
 		if inbound.ActualDomain != "" {
-			sniDomain = inbound.ActualDomain
+			return inbound.ActualDomain
 		}
-	} else if inbound.CustomSNI != "" {
-		sniDomain = inbound.CustomSNI
-	} else {
-		return ""
+		return inbound.Domain.Domain
+	}
+	return inbound.CustomSNI
+}
+
+// inboundNodes expands an inbound into subscription nodes.
+// Without ConnectEndpoints a single node on ConnectDomain (or the SNI) port 443 is returned.
+func inboundNodes(inbound models.Inbound) []subNode {
+	sniDomain := inboundSNI(inbound)
+	if sniDomain == "" {
+		return nil
+	}
+
+	endpoints := inbound.Endpoints()
+	if len(endpoints) == 0 {
+		// 连接目标域名：如果设置了 ConnectDomain 则使用它，否则使用 sniDomain
+		// ConnectDomain 用于 CDN 场景，客户端连接到 CDN 域名，但 SNI 使用反代子域名
+		// 端口始终为 443（Nginx 反向代理），Xray 本身监听在 inbound.Port
+		connectDomain := sniDomain
+		if inbound.ConnectDomain != "" {
+			connectDomain = inbound.ConnectDomain
+		}
+		return []subNode{{SNI: sniDomain, Server: connectDomain, Port: 443}}
+	}
+
+	nodes := make([]subNode, 0, len(endpoints))
+	used := make(map[string]bool, len(endpoints))
+	for _, ep := range endpoints {
+		suffix := ep.Remark
+		if suffix == "" {
+			suffix = ep.Address
+			if ep.Port != 443 {
+				suffix = ep.HostPort()
+			}
+		}
+		// Node names must be unique (Clash rejects duplicate names), so a
+		// clashing suffix gets the endpoint address, then a counter
+		if used[suffix] {
+			base := ep.HostPort()
+			if ep.Remark != "" {
+				base = ep.Remark + "-" + base
+			}
+			suffix = base
+			for i := 2; used[suffix]; i++ {
+				suffix = fmt.Sprintf("%s-%d", base, i)
+			}
+		}
+		used[suffix] = true
+		nodes = append(nodes, subNode{SNI: sniDomain, Server: ep.Address, Port: ep.Port, Suffix: suffix})
+	}
+	return nodes
+}
+
+// remark appends the node suffix to a base remark
+func (n subNode) remark(base string) string {
+	if n.Suffix == "" {
+		return base
 	}
+	return base + "-" + n.Suffix
+}
 
-	// 连接目标域名：如果设置了 ConnectDomain 则使用它，否则使用 sniDomain
-	// ConnectDomain 用于 CDN 场景，客户端连接到 CDN 域名，但 SNI 使用反代子域名
-	connectDomain := sniDomain
-	if inbound.ConnectDomain != "" {
-		connectDomain = inbound.ConnectDomain
+// linkHost formats the connect address for use in a URL (IPv6 bracketed)
+func (n subNode) linkHost() string {
+	if strings.Contains(n.Server, ":") {
+		return "[" + n.Server + "]"
 	}
+	return n.Server
+}
 
-	// 端口始终为 443（Nginx 反向代理）
-	// Xray 本身监听在 inbound.Port，但客户端连接到 Nginx 的 443 端口
-	port := 443
+// generateVLESSLink generates a VLESS share link for one node of an inbound
+func generateVLESSLink(user models.User, inbound models.Inbound, node subNode) string {
+	sniDomain := node.SNI
 
 	// Build query parameters
 	params := url.Values{}
@@ -207,14 +282,15 @@ func generateVLESSLink(user models.User, inbound models.Inbound) string {
 	if remark == "" {
 		remark = fmt.Sprintf("%s-%s-%s", sniDomain, inbound.Protocol, inbound.Transport)
 	}
+	remark = node.remark(remark)
 
 	// Build VLESS URL
-	// 连接目标使用 connectDomain（可能是 CDN 域名或父域名）
+	// 连接目标使用 node.Server（CDN 优选 IP、CDN 域名或父域名）
 	// SNI 使用 sniDomain（反代子域名）
 	link := fmt.Sprintf("vless://%s@%s:%d?%s#%s",
 		user.UUID,
-		connectDomain, // 连接目标域名
-		port,
+		node.linkHost(), // 连接目标地址
+		node.Port,
 		params.Encode(),
 		url.PathEscape(remark),
 	)
@@ -222,26 +298,9 @@ func generateVLESSLink(user models.User, inbound models.Inbound) string {
 	return link
 }
 
-// generateTrojanLink generates a Trojan share link for a specific inbound
-func generateTrojanLink(user models.User, inbound models.Inbound) string {
-	sniDomain := ""
-	if inbound.Domain != nil {
-		sniDomain = inbound.Domain.Domain
-		if inbound.ActualDomain != "" {
-			sniDomain = inbound.ActualDomain
-		}
-	} else if inbound.CustomSNI != "" {
-		sniDomain = inbound.CustomSNI
-	} else {
-		return ""
-	}
-
-	connectDomain := sniDomain
-	if inbound.ConnectDomain != "" {
-		connectDomain = inbound.ConnectDomain
-	}
-
-	port := 443
+// generateTrojanLink generates a Trojan share link for one node of an inbound
+func generateTrojanLink(user models.User, inbound models.Inbound, node subNode) string {
+	sniDomain := node.SNI
 
 	params := url.Values{}
 	params.Set("type", string(inbound.Transport))
@@ -271,12 +330,13 @@ func generateTrojanLink(user models.User, inbound models.Inbound) string {
 	if remark == "" {
 		remark = fmt.Sprintf("%s-%s-%s", sniDomain, inbound.Protocol, inbound.Transport)
 	}
+	remark = node.remark(remark)
 
 	// trojan:// uses password (UUID) as userinfo
 	link := fmt.Sprintf("trojan://%s@%s:%d?%s#%s",
 		user.UUID,
-		connectDomain,
-		port,
+		node.linkHost(),
+		node.Port,
 		params.Encode(),
 		url.PathEscape(remark),
 	)
@@ -285,7 +345,8 @@ func generateTrojanLink(user models.User, inbound models.Inbound) string {
 }
 
 // generateClashConfig generates Clash configuration
-func generateClashConfig(user models.User, inbounds []models.Inbound) string {
+// notices are emitted first as unreachable informational proxies
+func generateClashConfig(user models.User, inbounds []models.Inbound, notices []string) string {
 	var sb strings.Builder
 
 	sb.WriteString("# Clash Configuration\n")
@@ -294,80 +355,78 @@ func generateClashConfig(user models.User, inbounds []models.Inbound) string {
 
 	sb.WriteString("proxies:\n")
 
+	for _, notice := range notices {
+		writeClashInfoProxy(&sb, notice)
+	}
+
 	for _, inbound := range inbounds {
-		sniDomain := ""
-		if inbound.Domain != nil {
-			sniDomain = inbound.Domain.Domain
-			if inbound.ActualDomain != "" {
-				sniDomain = inbound.ActualDomain
-			}
-		} else if inbound.CustomSNI != "" {
-			sniDomain = inbound.CustomSNI
-		} else {
+		if inbound.ExcludeFromSub {
 			continue
 		}
-
-		// 连接目标域名：如果设置了 ConnectDomain 则使用它，否则使用 sniDomain
-		connectDomain := sniDomain
-		if inbound.ConnectDomain != "" {
-			connectDomain = inbound.ConnectDomain
+		for _, node := range inboundNodes(inbound) {
+			writeClashProxy(&sb, user, inbound, node)
 		}
+	}
 
-		name := inbound.Remark
-		if name == "" {
-			name = fmt.Sprintf("%s-%s", sniDomain, inbound.Transport)
-		}
+	return sb.String()
+}
 
-		sb.WriteString(fmt.Sprintf("  - name: \"%s\"\n", name))
+// writeClashProxy writes a single Clash proxy entry for one node of an inbound
+func writeClashProxy(sb *strings.Builder, user models.User, inbound models.Inbound, node subNode) {
+	sniDomain := node.SNI
 
-		// Protocol type
-		if inbound.Protocol == models.ProtocolTrojan {
-			sb.WriteString("    type: trojan\n")
-		} else {
-			sb.WriteString("    type: vless\n")
-		}
+	name := inbound.Remark
+	if name == "" {
+		name = fmt.Sprintf("%s-%s", sniDomain, inbound.Transport)
+	}
+	name = node.remark(name)
 
-		sb.WriteString(fmt.Sprintf("    server: %s\n", connectDomain))
+	sb.WriteString(fmt.Sprintf("  - name: \"%s\"\n", name))
 
-		port := 443
-		sb.WriteString(fmt.Sprintf("    port: %d\n", port))
+	// Protocol type
+	if inbound.Protocol == models.ProtocolTrojan {
+		sb.WriteString("    type: trojan\n")
+	} else {
+		sb.WriteString("    type: vless\n")
+	}
 
-		if inbound.Protocol == models.ProtocolTrojan {
-			sb.WriteString(fmt.Sprintf("    password: %s\n", user.UUID))
-		} else {
-			sb.WriteString(fmt.Sprintf("    uuid: %s\n", user.UUID))
-			sb.WriteString("    cipher: none\n")
-		}
+	// 连接目标：CDN 优选 IP / CDN 域名，未配置时为 SNI 域名
+	sb.WriteString(fmt.Sprintf("    server: %s\n", node.Server))
+	sb.WriteString(fmt.Sprintf("    port: %d\n", node.Port))
 
-		sb.WriteString(fmt.Sprintf("    network: %s\n", inbound.Transport))
-		sb.WriteString("    tls: true\n")
-		sb.WriteString(fmt.Sprintf("    servername: %s\n", sniDomain)) // SNI 使用反代子域名
-		sb.WriteString("    client-fingerprint: randomized\n")
-		sb.WriteString("    alpn:\n")
-		sb.WriteString("      - h2\n")
-
-		// Transport options
-		switch inbound.Transport {
-		case models.TransportXHTTP:
-			sb.WriteString("    xhttp-opts:\n")
-			sb.WriteString(fmt.Sprintf("      path: %s\n", inbound.Path))
-			if inbound.Host != "" {
-				sb.WriteString(fmt.Sprintf("      host: %s\n", inbound.Host))
-			}
-		case models.TransportWS:
-			sb.WriteString("    ws-opts:\n")
-			sb.WriteString(fmt.Sprintf("      path: %s\n", inbound.Path))
-			if inbound.Host != "" {
-				sb.WriteString("      headers:\n")
-				sb.WriteString(fmt.Sprintf("        Host: %s\n", inbound.Host))
-			}
-		case models.TransportGRPC:
-			sb.WriteString("    grpc-opts:\n")
-			sb.WriteString(fmt.Sprintf("      grpc-service-name: %s\n", inbound.ServiceName))
-		}
+	if inbound.Protocol == models.ProtocolTrojan {
+		sb.WriteString(fmt.Sprintf("    password: %s\n", user.UUID))
+	} else {
+		sb.WriteString(fmt.Sprintf("    uuid: %s\n", user.UUID))
+		sb.WriteString("    cipher: none\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("    network: %s\n", inbound.Transport))
+	sb.WriteString("    tls: true\n")
+	sb.WriteString(fmt.Sprintf("    servername: %s\n", sniDomain)) // SNI 使用反代子域名
+	sb.WriteString("    client-fingerprint: randomized\n")
+	sb.WriteString("    alpn:\n")
+	sb.WriteString("      - h2\n")
 
-		sb.WriteString("\n")
+	// Transport options
+	switch inbound.Transport {
+	case models.TransportXHTTP:
+		sb.WriteString("    xhttp-opts:\n")
+		sb.WriteString(fmt.Sprintf("      path: %s\n", inbound.Path))
+		if inbound.Host != "" {
+			sb.WriteString(fmt.Sprintf("      host: %s\n", inbound.Host))
+		}
+	case models.TransportWS:
+		sb.WriteString("    ws-opts:\n")
+		sb.WriteString(fmt.Sprintf("      path: %s\n", inbound.Path))
+		if inbound.Host != "" {
+			sb.WriteString("      headers:\n")
+			sb.WriteString(fmt.Sprintf("        Host: %s\n", inbound.Host))
+		}
+	case models.TransportGRPC:
+		sb.WriteString("    grpc-opts:\n")
+		sb.WriteString(fmt.Sprintf("      grpc-service-name: %s\n", inbound.ServiceName))
 	}
 
-	return sb.String()
+	sb.WriteString("\n")
 }
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"xray-panel/internal/models"
+	"xray-panel/internal/system"
+)
+
+// Informational pseudo-nodes point at an unreachable local address; only
+// their names carry information (remaining traffic, expiry, announcements).
+const (
+	infoNodeUUID   = "00000000-0000-0000-0000-000000000000"
+	infoNodeServer = "127.0.0.1"
+	infoNodePort   = 1
+)
+
+// subscriptionNotices builds the names of informational pseudo-nodes for a user.
+// Expired / over-quota users get a single explanatory notice and nothing else.
+func subscriptionNotices(db *gorm.DB, user models.User) []string {
+	if notice := inactiveNotice(user); notice != "" {
+		return []string{notice}
+	}
+
+	var notices []string
+	if models.GetSubInfoNodes(db) {
+		if remaining := user.RemainingTraffic(); remaining >= 0 {
+			notices = append(notices, "剩余流量: "+system.FormatBytes(uint64(remaining)))
+		} else {
+			notices = append(notices, "剩余流量: 不限")
+		}
+		if days := user.RemainingDays(); days >= 0 {
+			notices = append(notices, fmt.Sprintf("到期时间: %s (剩余 %d 天)", user.ExpiryDate.Format("2006-01-02"), days))
+		} else {
+			notices = append(notices, "到期时间: 长期有效")
+		}
+	}
+
+	for _, a := range models.GetActiveAnnouncements(db) {
+		notices = append(notices, "公告: "+a.Content)
+	}
+	return notices
+}
+
+// inactiveNotice explains why an enabled user cannot use the subscription, or "" if active
+func inactiveNotice(user models.User) string {
+	if !user.ExpiryDate.IsZero() && time.Now().After(user.ExpiryDate) {
+		return fmt.Sprintf("账户已于 %s 到期，请联系管理员续期", user.ExpiryDate.Format("2006-01-02"))
+	}
+	if user.TrafficLimit > 0 && user.TrafficUsed >= user.TrafficLimit {
+		return fmt.Sprintf("流量已用尽 (%s)，请联系管理员", system.FormatBytes(uint64(user.TrafficLimit)))
+	}
+	return ""
+}
+
+// infoNodeName makes a notice safe for use as a single-line node name
+func infoNodeName(notice string) string {
+	notice = strings.Join(strings.Fields(notice), " ")
+	return strings.ReplaceAll(notice, `"`, "'")
+}
+
+// generateInfoLink generates an unreachable VLESS share link whose remark carries the notice
+func generateInfoLink(notice string) string {
+	params := url.Values{}
+	params.Set("type", "tcp")
+	params.Set("encryption", "none")
+	params.Set("security", "none")
+
+	return fmt.Sprintf("vless://%s@%s:%d?%s#%s",
+		infoNodeUUID,
+		infoNodeServer,
+		infoNodePort,
+		params.Encode(),
+		url.PathEscape(infoNodeName(notice)),
+	)
+}
+
+// writeClashInfoProxy writes an unreachable Clash proxy entry whose name carries the notice
+func writeClashInfoProxy(sb *strings.Builder, notice string) {
+	sb.WriteString(fmt.Sprintf("  - name: \"%s\"\n", infoNodeName(notice)))
+	sb.WriteString("    type: vless\n")
+	sb.WriteString(fmt.Sprintf("    server: %s\n", infoNodeServer))
+	sb.WriteString(fmt.Sprintf("    port: %d\n", infoNodePort))
+	sb.WriteString(fmt.Sprintf("    uuid: %s\n", infoNodeUUID))
+	sb.WriteString("    cipher: none\n")
+	sb.WriteString("    network: tcp\n")
+	sb.WriteString("    tls: false\n")
+	sb.WriteString("\n")
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+	"xray-panel/internal/utils"
+)
+
+// sourceSyncMu serializes subscription source refreshes (background job and manual refresh)
+var sourceSyncMu sync.Mutex
+
+// startSubscriptionSync starts a background goroutine that refreshes
+// subscription sources whose refresh interval has elapsed.
+func (s *Server) startSubscriptionSync() {
+	interval := 60 * time.Second
+
+	go func() {
+		time.Sleep(15 * time.Second)
+		logger.Debug("Subscription source sync worker started (interval: %v)", interval)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.syncDueSubscriptionSources()
+			<-ticker.C
+		}
+	}()
+}
+
+// syncDueSubscriptionSources refreshes every enabled source that is due
+func (s *Server) syncDueSubscriptionSources() {
+	var sources []models.SubscriptionSource
+	if err := s.db.Where("enabled = ?", true).Find(&sources).Error; err != nil {
+		logger.Error("Subscription sync: failed to fetch sources: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range sources {
+		if sources[i].IsDue(now) {
+			s.refreshSubscriptionSource(&sources[i])
+		}
+	}
+}
+
+// refreshSubscriptionSource fetches a source and reconciles its outbounds.
+// Returns whether any outbound was created, updated or deleted.
+func (s *Server) refreshSubscriptionSource(source *models.SubscriptionSource) (bool, error) {
+	sourceSyncMu.Lock()
+	defer sourceSyncMu.Unlock()
+
+	changed, count, err := s.syncSourceOutbounds(source)
+
+	source.LastFetchAt = time.Now()
+	source.LastError = ""
+	if err != nil {
+		source.LastError = err.Error()
+		logger.Warn("Subscription source %s refresh failed: %v", source.Name, err)
+	} else {
+		source.NodeCount = count
+		logger.Info("Subscription source %s refreshed: %d nodes (changed: %v)", source.Name, count, changed)
+	}
+	s.db.Model(source).Updates(map[string]interface{}{
+		"last_fetch_at": source.LastFetchAt,
+		"last_error":    source.LastError,
+		"node_count":    source.NodeCount,
+	})
+
+	if changed && source.AutoApply {
+		if err := s.applyXrayConfigHot("system", models.RevisionAuto); err != nil {
+			logger.Error("Subscription source %s: auto apply failed: %v", source.Name, err)
+		}
+	}
+	return changed, err
+}
+
+// syncSourceOutbounds downloads the source and creates / updates / deletes its outbounds.
+// A failed download or an empty result leaves existing outbounds untouched.
+func (s *Server) syncSourceOutbounds(source *models.SubscriptionSource) (bool, int, error) {
+	include, err := compileRemarkFilter(source.NameFilter)
+	if err != nil {
+		return false, 0, fmt.Errorf("名称过滤表达式无效: %v", err)
+	}
+	exclude, err := compileRemarkFilter(source.ExcludeFilter)
+	if err != nil {
+		return false, 0, fmt.Errorf("排除过滤表达式无效: %v", err)
+	}
+
+	data, err := utils.FetchSubscription(source.URL)
+	if err != nil {
+		return false, 0, err
+	}
+
+	fetched := parseSourceNodes(utils.DecodeSubscription(data), include, exclude)
+	if len(fetched) == 0 {
+		return false, 0, fmt.Errorf("订阅中没有可用节点")
+	}
+
+	var existing []models.Outbound
+	if err := s.db.Where("source_id = ?", source.ID).Find(&existing).Error; err != nil {
+		return false, 0, err
+	}
+	byKey := make(map[string]models.Outbound, len(existing))
+	for _, o := range existing {
+		byKey[o.SourceKey] = o
+	}
+
+	// All or nothing, so a failed write never leaves the source half synced
+	changed := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for key, node := range fetched {
+			node.SourceID = source.ID
+			node.SourceKey = key
+			node.Tag = sourceOutboundTag(source.GroupTag, key)
+
+			old, ok := byKey[key]
+			if !ok {
+				// Nodes stored before the key included transport settings keep
+				// their identity (and tag, so references survive)
+				old, ok = byKey[legacySourceNodeKey(node)]
+			}
+			if ok {
+				delete(byKey, old.SourceKey)
+				// Keep identity and admin-controlled fields
+				node.ID = old.ID
+				node.Tag = old.Tag
+				node.Enabled = old.Enabled
+				node.Priority = old.Priority
+				node.DialerProxy = old.DialerProxy
+				node.AdvancedJSON = old.AdvancedJSON
+				node.CreatedAt = old.CreatedAt
+				if sameSourceNode(old, *node) {
+					continue
+				}
+				node.UpdatedAt = time.Now()
+				if err := tx.Save(node).Error; err != nil {
+					return fmt.Errorf("更新节点 %s 失败: %v", node.Tag, err)
+				}
+			} else {
+				node.Enabled = true
+				if err := tx.Create(node).Error; err != nil {
+					return fmt.Errorf("创建节点 %s 失败: %v", node.Tag, err)
+				}
+			}
+			changed = true
+		}
+
+		// Nodes no longer present in the subscription
+		for _, old := range byKey {
+			if err := tx.Delete(&models.Outbound{}, "id = ?", old.ID).Error; err != nil {
+				return fmt.Errorf("删除节点 %s 失败: %v", old.Tag, err)
+			}
+			changed = true
+		}
+		return nil
+	})
+	if err != nil {
+		return false, len(fetched), err
+	}
+	return changed, len(fetched), nil
+}
+
+// parseSourceNodes parses share links into outbounds keyed by their source key,
+// applying the include / exclude remark filters
+func parseSourceNodes(links []string, include, exclude *regexp.Regexp) map[string]*models.Outbound {
+	nodes := make(map[string]*models.Outbound)
+	for _, link := range links {
+		outbound, err := utils.ParseShareLink(link)
+		if err != nil {
+			continue
+		}
+		if include != nil && !include.MatchString(outbound.Remark) {
+			continue
+		}
+		if exclude != nil && exclude.MatchString(outbound.Remark) {
+			continue
+		}
+		nodes[sourceNodeKey(outbound)] = outbound
+	}
+	return nodes
+}
+
+// sourceNodeKey identifies a node across refreshes independent of its remark.
+// Transport and SNI are part of it: airports often publish several nodes on
+// one server and credential that differ only there.
+func sourceNodeKey(o *models.Outbound) string {
+	network, path, sni := o.Network, o.Path, o.TLSServerName
+	if network == "" {
+		network = o.TrojanNetwork
+	}
+	if path == "" {
+		path = o.ServiceName
+	}
+	if sni == "" {
+		sni = o.TrojanSNI
+	}
+	if sni == "" {
+		sni = o.RealitySNI
+	}
+	return fmt.Sprintf("%s|%s|%s|%s", legacySourceNodeKey(o), network, path, sni)
+}
+
+// legacySourceNodeKey is the key nodes were stored under before transport and
+// SNI were added to it
+func legacySourceNodeKey(o *models.Outbound) string {
+	credential := o.UUID
+	if o.Type == models.OutboundTrojan {
+		credential = o.TrojanPassword
+	}
+	return fmt.Sprintf("%s|%s|%d|%s", o.Type, o.Server, o.Port, credential)
+}
+
+// sourceOutboundTag derives a stable outbound tag from the group tag and node key
+func sourceOutboundTag(groupTag, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return groupTag + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// sameSourceNode reports whether a refreshed node differs from the stored one
+func sameSourceNode(a, b models.Outbound) bool {
+	a.UpdatedAt, b.UpdatedAt = time.Time{}, time.Time{}
+	return a == b
+}
+
+// handleRefreshSubscriptionSource refreshes a subscription source immediately
+func (s *Server) handleRefreshSubscriptionSource(c *gin.Context) {
+	var source models.SubscriptionSource
+	if err := s.db.First(&source, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusNotFound, "Subscription source not found")
+		return
+	}
+
+	changed, err := s.refreshSubscriptionSource(&source)
+	if err != nil {
+		jsonError(c, http.StatusBadGateway, "刷新失败: "+err.Error())
+		return
+	}
+
+	jsonOK(c, gin.H{
+		"changed":    changed,
+		"node_count": source.NodeCount,
+	})
+}
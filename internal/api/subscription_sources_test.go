@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"xray-panel/internal/models"
+)
+
+// sourceStub is an airport whose node list and status can change between refreshes
+type sourceStub struct {
+	*httptest.Server
+	mu     sync.Mutex
+	links  []string
+	status int
+}
+
+func newSourceStub(t *testing.T, links []string) *sourceStub {
+	t.Helper()
+	stub := &sourceStub{links: links, status: http.StatusOK}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		w.WriteHeader(stub.status)
+		w.Write([]byte(base64.StdEncoding.EncodeToString([]byte(strings.Join(stub.links, "\n")))))
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *sourceStub) set(links []string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links, s.status = links, status
+}
+
+func createSource(ts *testServer, url string) *models.SubscriptionSource {
+	ts.t.Helper()
+	source := &models.SubscriptionSource{Name: "airport", URL: url, GroupTag: "air", ExcludeFilter: "^SS$"}
+	if err := ts.db.Create(source).Error; err != nil {
+		ts.t.Fatalf("create source: %v", err)
+	}
+	return source
+}
+
+func sourceNodes(ts *testServer, source *models.SubscriptionSource) map[string]models.Outbound {
+	ts.t.Helper()
+	var nodes []models.Outbound
+	ts.db.Where("source_id = ?", source.ID).Find(&nodes)
+	byRemark := make(map[string]models.Outbound, len(nodes))
+	for _, n := range nodes {
+		byRemark[n.Remark] = n
+	}
+	return byRemark
+}
+
+func TestSubscriptionSourceSync(t *testing.T) {
+	ts := newTestServer(t)
+	stub := newSourceStub(t, testShareLinks)
+	source := createSource(ts, stub.URL)
+
+	changed, err := ts.refreshSubscriptionSource(source)
+	if err != nil || !changed {
+		t.Fatalf("first refresh: changed=%v err=%v", changed, err)
+	}
+	nodes := sourceNodes(ts, source)
+	if len(nodes) != 3 || source.NodeCount != 3 {
+		t.Fatalf("got %d nodes (count %d), want 3", len(nodes), source.NodeCount)
+	}
+	for remark, n := range nodes {
+		if !strings.HasPrefix(n.Tag, "air-") || !n.Enabled {
+			t.Errorf("node %s: tag %s enabled %v", remark, n.Tag, n.Enabled)
+		}
+	}
+
+	// Admin settings survive refreshes
+	hk := nodes["HK 01"]
+	ts.db.Model(&hk).Updates(map[string]interface{}{"enabled": false, "priority": 5})
+
+	if changed, err := ts.refreshSubscriptionSource(source); err != nil || changed {
+		t.Fatalf("unchanged refresh: changed=%v err=%v", changed, err)
+	}
+
+	// HK renamed, JP dropped
+	renamed := strings.Replace(testShareLinks[0], "#HK%2001", "#HK%20Premium", 1)
+	stub.set([]string{renamed, testShareLinks[2]}, http.StatusOK)
+	if changed, err := ts.refreshSubscriptionSource(source); err != nil || !changed {
+		t.Fatalf("second refresh: changed=%v err=%v", changed, err)
+	}
+	nodes = sourceNodes(ts, source)
+	if len(nodes) != 2 || source.NodeCount != 2 {
+		t.Fatalf("got %d nodes (count %d), want 2", len(nodes), source.NodeCount)
+	}
+	if _, ok := nodes["JP 01"]; ok {
+		t.Error("JP node was not deleted")
+	}
+	updated, ok := nodes["HK Premium"]
+	if !ok {
+		t.Fatal("HK node was not renamed")
+	}
+	if updated.ID != hk.ID || updated.Tag != hk.Tag || updated.Enabled || updated.Priority != 5 {
+		t.Errorf("HK node lost its identity or settings: %+v", updated)
+	}
+
+	// A failed download leaves the nodes untouched
+	stub.set(nil, http.StatusInternalServerError)
+	if _, err := ts.refreshSubscriptionSource(source); err == nil {
+		t.Fatal("refresh of a failing source succeeded")
+	}
+	var stored models.SubscriptionSource
+	ts.db.First(&stored, "id = ?", source.ID)
+	if stored.LastError == "" || stored.NodeCount != 2 {
+		t.Errorf("after failure: last_error %q node_count %d", stored.LastError, stored.NodeCount)
+	}
+	if got := len(sourceNodes(ts, source)); got != 2 {
+		t.Errorf("failed refresh left %d nodes, want 2", got)
+	}
+}
+
+func TestSubscriptionSourceFilters(t *testing.T) {
+	ts := newTestServer(t)
+	stub := newSourceStub(t, testShareLinks)
+	source := createSource(ts, stub.URL)
+	source.NameFilter = "^(HK|JP)"
+	source.ExcludeFilter = "JP"
+
+	if _, err := ts.refreshSubscriptionSource(source); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	nodes := sourceNodes(ts, source)
+	if _, ok := nodes["HK 01"]; !ok || len(nodes) != 1 {
+		t.Errorf("filtered nodes = %v, want only HK 01", nodes)
+	}
+
+	source.NameFilter = "^XX"
+	if _, err := ts.refreshSubscriptionSource(source); err == nil {
+		t.Error("refresh without matching nodes succeeded")
+	}
+	if got := len(sourceNodes(ts, source)); got != 1 {
+		t.Errorf("empty result left %d nodes, want 1", got)
+	}
+}
+
+func TestDisabledSourceNotGenerated(t *testing.T) {
+	ts := newTestServer(t)
+	stub := newSourceStub(t, testShareLinks)
+	source := createSource(ts, stub.URL)
+	if _, err := ts.refreshSubscriptionSource(source); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	ts.db.Model(source).Update("enabled", false)
+
+	configJSON, err := ts.generateXrayConfig()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for remark, n := range sourceNodes(ts, source) {
+		if strings.Contains(string(configJSON), `"`+n.Tag+`"`) {
+			t.Errorf("node %s (%s) of a disabled source is generated", remark, n.Tag)
+		}
+	}
+}
+
+func TestSubscriptionSourceKeyTransport(t *testing.T) {
+	ts := newTestServer(t)
+	// Same server and credential, different path and SNI
+	other := strings.NewReplacer("path=%2Fws", "path=%2Fws2", "sni=hk.example.com", "sni=hk2.example.com", "#HK%2001", "#HK%2002").
+		Replace(testShareLinks[0])
+	stub := newSourceStub(t, []string{testShareLinks[0], other})
+	source := createSource(ts, stub.URL)
+
+	if _, err := ts.refreshSubscriptionSource(source); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	nodes := sourceNodes(ts, source)
+	if len(nodes) != 2 || nodes["HK 01"].Tag == nodes["HK 02"].Tag {
+		t.Fatalf("nodes = %+v, want two distinct nodes", nodes)
+	}
+
+	// A node stored under the old key (without transport) keeps its identity
+	hk := nodes["HK 01"]
+	legacyKey := legacySourceNodeKey(&hk)
+	ts.db.Model(&hk).Updates(map[string]interface{}{"source_key": legacyKey, "tag": "air-legacy", "priority": 7})
+	ts.db.Delete(&models.Outbound{}, "id = ?", nodes["HK 02"].ID)
+	stub.set([]string{testShareLinks[0]}, http.StatusOK)
+
+	if _, err := ts.refreshSubscriptionSource(source); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	nodes = sourceNodes(ts, source)
+	got, ok := nodes["HK 01"]
+	if len(nodes) != 1 || !ok {
+		t.Fatalf("nodes = %+v, want only HK 01", nodes)
+	}
+	if got.ID != hk.ID || got.Tag != "air-legacy" || got.Priority != 7 || got.SourceKey == legacyKey {
+		t.Errorf("legacy node not adopted: %+v", got)
+	}
+}
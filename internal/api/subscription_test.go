@@ -0,0 +1,32 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"xray-panel/internal/models"
+)
+
+func TestInboundNodesUniqueSuffix(t *testing.T) {
+	inbound := models.Inbound{
+		CustomSNI:        "sni.example.com",
+		ConnectEndpoints: "1.1.1.1#HK\n2.2.2.2:8443#HK\n3.3.3.3\n3.3.3.3\n3.3.3.3:443",
+	}
+	var got []string
+	for _, n := range inboundNodes(inbound) {
+		got = append(got, n.Suffix)
+	}
+	want := "HK,HK-2.2.2.2:8443,3.3.3.3,3.3.3.3:443,3.3.3.3:443-2"
+	if strings.Join(got, ",") != want {
+		t.Errorf("suffixes = %v, want %s", got, want)
+	}
+}
+
+func TestParseConnectEndpointsDuplicateRemark(t *testing.T) {
+	if _, err := models.ParseConnectEndpoints("1.1.1.1#HK\n2.2.2.2#HK"); err == nil || !strings.Contains(err.Error(), "duplicate remark") {
+		t.Errorf("err = %v, want a duplicate remark error", err)
+	}
+	if _, err := models.ParseConnectEndpoints("1.1.1.1#HK\n2.2.2.2#JP\n3.3.3.3\n3.3.3.3"); err != nil {
+		t.Errorf("distinct remarks: %v", err)
+	}
+}
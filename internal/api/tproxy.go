@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/geodata"
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+	"xray-panel/internal/xray"
+)
+
+// transparentProxyPlan builds the nftables / policy routing setup from the
+// gateway options
+func (s *Server) transparentProxyPlan() (*xray.TProxyPlan, error) {
+	opts := models.GetTransparentProxyOptions(s.db)
+
+	var bypass []netip.Prefix
+	for _, cidr := range opts.BypassCIDRList() {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("无效的绕过地址: %s", cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		bypass = append(bypass, prefix)
+	}
+	if opts.BypassCN {
+		index, err := geodata.NewGeoDataParser(s.config.Xray.AssetsPath).GeoIP()
+		if err != nil {
+			return nil, fmt.Errorf("读取 geoip.dat 失败: %w", err)
+		}
+		cidrs, ok := index.CIDRs("cn")
+		if !ok {
+			return nil, fmt.Errorf("geoip.dat 中没有 cn 分类")
+		}
+		bypass = append(bypass, cidrs...)
+	}
+
+	// FakeDNS 地址池位于保留网段内，仍需转给 Xray
+	var divert []netip.Prefix
+	if fakeDNS := models.GetFakeDNSOptions(s.db); fakeDNS.Enabled {
+		for _, pool := range []string{fakeDNS.IPv4Pool, fakeDNS.IPv6Pool} {
+			if prefix, err := netip.ParsePrefix(pool); err == nil {
+				divert = append(divert, prefix)
+			}
+		}
+	}
+	return xray.NewTProxyPlan(opts, bypass, divert), nil
+}
+
+// applyTransparentProxy loads the ruleset and sets up policy routing
+func (s *Server) applyTransparentProxy(plan *xray.TProxyPlan) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("透明代理仅支持 Linux")
+	}
+	if _, err := runCommand(plan.Ruleset, "nft", "-f", "-"); err != nil {
+		return err
+	}
+	return runHostCommands(plan.Setup, false)
+}
+
+// applyTransparentProxyOnStart restores the gateway rules, which do not
+// survive a reboot
+func (s *Server) applyTransparentProxyOnStart() {
+	if models.GetPanelMode(s.db) != "client" || !models.GetTransparentProxyOptions(s.db).Enabled {
+		return
+	}
+	plan, err := s.transparentProxyPlan()
+	if err == nil {
+		err = s.applyTransparentProxy(plan)
+	}
+	if err != nil {
+		logger.Warn("Failed to apply transparent proxy rules: %v", err)
+		return
+	}
+	logger.Info("Transparent proxy rules applied")
+}
+
+// handleApplyTransparentProxy applies the gateway rules; with dry_run=true
+// it only returns the script for review
+func (s *Server) handleApplyTransparentProxy(c *gin.Context) {
+	plan, err := s.transparentProxyPlan()
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if c.Query("dry_run") == "true" {
+		jsonOK(c, gin.H{"applied": false, "script": plan.Script()})
+		return
+	}
+
+	if models.GetPanelMode(s.db) != "client" {
+		jsonError(c, http.StatusBadRequest, "透明代理仅在客户端模式下可用")
+		return
+	}
+	if !models.GetTransparentProxyOptions(s.db).Enabled {
+		jsonError(c, http.StatusBadRequest, "请先启用透明代理并保存")
+		return
+	}
+	if models.GetTunOptions(s.db).Enabled {
+		jsonError(c, http.StatusBadRequest, "透明代理网关与 TUN 不能同时启用")
+		return
+	}
+	if err := s.applyTransparentProxy(plan); err != nil {
+		logger.Error("Failed to apply transparent proxy rules: %v", err)
+		jsonError(c, http.StatusInternalServerError, "应用规则失败: "+err.Error())
+		return
+	}
+
+	logger.Info("Transparent proxy rules applied by %s", c.GetString("username"))
+	jsonOK(c, gin.H{"applied": true, "script": plan.Script()})
+}
+
+// handleRemoveTransparentProxy removes the gateway rules
+func (s *Server) handleRemoveTransparentProxy(c *gin.Context) {
+	if runtime.GOOS != "linux" {
+		jsonError(c, http.StatusBadRequest, "透明代理仅支持 Linux")
+		return
+	}
+	opts := models.GetTransparentProxyOptions(s.db)
+	runHostCommands(xray.NewTProxyPlan(opts, nil, nil).Teardown, true)
+
+	logger.Info("Transparent proxy rules removed by %s", c.GetString("username"))
+	jsonOK(c, gin.H{"removed": true})
+}
+
+// runHostCommands runs firewall / routing commands. Rule deletions repeat
+// until they fail (no matching rule left); other failures abort unless
+// ignoreErrors is set, e.g. on teardown where the state may not exist.
+func runHostCommands(cmds [][]string, ignoreErrors bool) error {
+	for _, args := range cmds {
+		if xray.IsRuleDel(args) {
+			for i := 0; i < 1000; i++ {
+				if _, err := runCommand("", args...); err != nil {
+					break
+				}
+			}
+			continue
+		}
+		if _, err := runCommand("", args...); err != nil {
+			if !ignoreErrors {
+				return err
+			}
+			logger.Debug("Ignored: %v", err)
+		}
+	}
+	return nil
+}
+
+// runCommand runs a command with optional stdin and returns its output
+func runCommand(stdin string, args ...string) (string, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	output := out.String()
+	if err != nil {
+		return output, fmt.Errorf("%s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(output))
+	}
+	return output, nil
+}
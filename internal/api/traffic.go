@@ -30,6 +30,7 @@ func (s *Server) startTrafficSync() {
 
 		for range ticker.C {
 			s.syncTraffic(apiClient)
+			s.syncOnlineIPs(apiClient)
 		}
 	}()
 }
@@ -75,4 +76,39 @@ func (s *Server) syncTraffic(client *xray.APIClient) {
 	if updated > 0 {
 		logger.Debug("Traffic sync: updated %d users", updated)
 	}
+
+	s.syncWireGuardPeerTraffic(client)
+}
+
+// syncWireGuardPeerTraffic reads the loopback outbound stats of the WireGuard
+// peers; a user's peer traffic also counts towards the user's quota.
+func (s *Server) syncWireGuardPeerTraffic(client *xray.APIClient) {
+	var peers []models.WireGuardPeer
+	if err := s.db.Where("enabled = ?", true).Find(&peers).Error; err != nil {
+		logger.Error("Traffic sync: failed to fetch wireguard peers: %v", err)
+		return
+	}
+
+	for _, peer := range peers {
+		down, _ := client.GetStats("outbound>>>"+peer.StatsTag()+">>>traffic>>>downlink", true)
+		up, _ := client.GetStats("outbound>>>"+peer.StatsTag()+">>>traffic>>>uplink", true)
+		if down+up <= 0 {
+			continue
+		}
+
+		if err := s.db.Model(&models.WireGuardPeer{}).
+			Where("id = ?", peer.ID).
+			Updates(map[string]interface{}{
+				"traffic_up":   gorm.Expr("traffic_up + ?", up),
+				"traffic_down": gorm.Expr("traffic_down + ?", down),
+			}).Error; err != nil {
+			logger.Error("Traffic sync: failed to update wireguard peer %s: %v", peer.Email, err)
+			continue
+		}
+		if !peer.IsRelay() {
+			s.db.Model(&models.User{}).
+				Where("id = ?", peer.UserID).
+				Update("traffic_used", gorm.Expr("traffic_used + ?", down+up))
+		}
+	}
 }
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
+	"xray-panel/internal/xray"
+)
+
+// tunPlan builds the TUN routing setup. The proxy servers are excluded so
+// Xray's connections to them never loop back into the TUN.
+func (s *Server) tunPlan() (*xray.TunPlan, error) {
+	cfg, err := s.xrayGenerator().Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	var exclude []netip.Prefix
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, host := range xray.ServerEndpoints(cfg) {
+		if addr, err := netip.ParseAddr(host); err == nil {
+			exclude = append(exclude, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, fmt.Errorf("解析服务器地址 %s 失败: %w", host, err)
+		}
+		for _, addr := range addrs {
+			exclude = append(exclude, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+
+	// FakeDNS 地址池位于保留网段内，仍需进入 TUN
+	var divert []netip.Prefix
+	if fakeDNS := models.GetFakeDNSOptions(s.db); fakeDNS.Enabled {
+		for _, pool := range []string{fakeDNS.IPv4Pool, fakeDNS.IPv6Pool} {
+			if prefix, err := netip.ParsePrefix(pool); err == nil {
+				divert = append(divert, prefix)
+			}
+		}
+	}
+	return xray.NewTunPlan(models.GetTunOptions(s.db), exclude, divert), nil
+}
+
+// applyTun assigns the TUN addresses and installs the policy routing
+func (s *Server) applyTun(plan *xray.TunPlan) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("TUN 路由仅支持 Linux")
+	}
+	runHostCommands(plan.Teardown, true)
+	return runHostCommands(plan.Setup, false)
+}
+
+// tunNeedsSetup reports whether Xray has created the interface but it lacks
+// the configured addresses, i.e. Xray (re)started since the routes were applied
+func tunNeedsSetup(opts models.TunOptions) bool {
+	iface, err := net.InterfaceByName(opts.Name)
+	if err != nil {
+		return false
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	present := make(map[netip.Addr]bool)
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			if addr, ok := netip.AddrFromSlice(ipnet.IP); ok {
+				present[addr.Unmap()] = true
+			}
+		}
+	}
+	for _, cidr := range opts.AddressList() {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && !present[prefix.Addr()] {
+			return true
+		}
+	}
+	return false
+}
+
+// startTunWatch applies the TUN routes whenever Xray recreates the interface
+// (start, restart, crash recovery); its addresses and routes go with it
+func (s *Server) startTunWatch() {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	interval := 5 * time.Second
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if models.GetPanelMode(s.db) != "client" {
+				continue
+			}
+			opts := models.GetTunOptions(s.db)
+			if !opts.Enabled || !tunNeedsSetup(opts) {
+				continue
+			}
+			plan, err := s.tunPlan()
+			if err == nil {
+				err = s.applyTun(plan)
+			}
+			if err != nil {
+				logger.Warn("Failed to apply TUN routes: %v", err)
+				continue
+			}
+			logger.Info("TUN routes applied on %s", opts.Name)
+		}
+	}()
+}
+
+// handleApplyTun applies the TUN routes; with dry_run=true it only returns
+// the script for review
+func (s *Server) handleApplyTun(c *gin.Context) {
+	plan, err := s.tunPlan()
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if c.Query("dry_run") == "true" {
+		jsonOK(c, gin.H{"applied": false, "script": plan.Script()})
+		return
+	}
+
+	if models.GetPanelMode(s.db) != "client" {
+		jsonError(c, http.StatusBadRequest, "TUN 仅在客户端模式下可用")
+		return
+	}
+	opts := models.GetTunOptions(s.db)
+	if !opts.Enabled {
+		jsonError(c, http.StatusBadRequest, "请先启用 TUN 并保存")
+		return
+	}
+	if models.GetTransparentProxyOptions(s.db).Enabled {
+		jsonError(c, http.StatusBadRequest, "透明代理网关与 TUN 不能同时启用")
+		return
+	}
+	if _, err := net.InterfaceByName(opts.Name); err != nil {
+		jsonError(c, http.StatusBadRequest, "接口 "+opts.Name+" 不存在，请先应用 Xray 配置")
+		return
+	}
+	if err := s.applyTun(plan); err != nil {
+		logger.Error("Failed to apply TUN routes: %v", err)
+		jsonError(c, http.StatusInternalServerError, "应用路由失败: "+err.Error())
+		return
+	}
+
+	logger.Info("TUN routes applied by %s", c.GetString("username"))
+	jsonOK(c, gin.H{"applied": true, "script": plan.Script()})
+}
+
+// handleRemoveTun removes the TUN policy routing
+func (s *Server) handleRemoveTun(c *gin.Context) {
+	if runtime.GOOS != "linux" {
+		jsonError(c, http.StatusBadRequest, "TUN 路由仅支持 Linux")
+		return
+	}
+	runHostCommands(xray.NewTunPlan(models.GetTunOptions(s.db), nil, nil).Teardown, true)
+
+	logger.Info("TUN routes removed by %s", c.GetString("username"))
+	jsonOK(c, gin.H{"removed": true})
+}
@@ -26,6 +26,7 @@ type UpdateUserRequest struct {
 	ExpiryDate   string `json:"expiry_date"` // RFC3339 format
 	Enabled      bool   `json:"enabled"`
 	Note         string `json:"note"`
+	EgressTag    string `json:"egress_tag"` // outbound / group tag, empty = follow routing rules
 }
 
 // handleGetUser returns a single user as JSON (used by edit forms)
@@ -64,6 +65,7 @@ func (s *Server) handleUpdateUser(c *gin.Context) {
 	user.TrafficLimit = req.TrafficLimit
 	user.Enabled = req.Enabled
 	user.Note = req.Note
+	user.EgressTag = req.EgressTag
 
 	if req.ExpiryDate != "" {
 		expiryDate, err := time.Parse(time.RFC3339, req.ExpiryDate)
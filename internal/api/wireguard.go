@@ -4,25 +4,256 @@ import (
 	"crypto/ecdh"
 	"crypto/rand"
 	"encoding/base64"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/logger"
+	"xray-panel/internal/models"
 )
 
+// wgPeerNamePattern rejects characters that would break the stats name
+var wgPeerNamePattern = regexp.MustCompile(`^[^\s@>]+$`)
+
+// wgConfFileName keeps the characters wg-quick accepts in interface names
+var wgConfFileName = regexp.MustCompile(`[^a-zA-Z0-9_=+.-]`)
+
+// generateWGKeyPair returns a base64 WireGuard (Curve25519) key pair
+func generateWGKeyPair() (string, string, error) {
+	privKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(privKey.Bytes()),
+		base64.StdEncoding.EncodeToString(privKey.PublicKey().Bytes()), nil
+}
+
+// wgPublicKey derives the public key of a base64 private key
+func wgPublicKey(privateKey string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", err
+	}
+	privKey, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(privKey.PublicKey().Bytes()), nil
+}
+
 // handleGenerateWGKeys generates a WireGuard (Curve25519) key pair.
 // Returns JSON: { "private_key": "...", "public_key": "..." }
 func (s *Server) handleGenerateWGKeys(c *gin.Context) {
-	privKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	privB64, pubB64, err := generateWGKeyPair()
 	if err != nil {
 		jsonError(c, http.StatusInternalServerError, "Failed to generate key: "+err.Error())
 		return
 	}
 
-	privB64 := base64.StdEncoding.EncodeToString(privKey.Bytes())
-	pubB64 := base64.StdEncoding.EncodeToString(privKey.PublicKey().Bytes())
-
 	c.JSON(http.StatusOK, gin.H{
 		"private_key": privB64,
 		"public_key":  pubB64,
 	})
 }
+
+// wgInbound loads the WireGuard inbound of the request
+func (s *Server) wgInbound(c *gin.Context) (*models.Inbound, bool) {
+	var inbound models.Inbound
+	if err := s.db.First(&inbound, "id = ?", c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusNotFound, "Inbound not found")
+		return nil, false
+	}
+	if inbound.Protocol != models.ProtocolWireGuard {
+		jsonError(c, http.StatusBadRequest, "Not a WireGuard inbound")
+		return nil, false
+	}
+	return &inbound, true
+}
+
+// wgServerPublicKey returns the inbound's public key, derived from the
+// secret key when it was not stored
+func wgServerPublicKey(inbound *models.Inbound) string {
+	if inbound.WGPublicKey != "" {
+		return inbound.WGPublicKey
+	}
+	pub, _ := wgPublicKey(inbound.WGSecretKey)
+	return pub
+}
+
+// wgEndpoint returns the endpoint clients connect to: the host the panel is
+// reached at and the inbound port
+func wgEndpoint(c *gin.Context, inbound *models.Inbound) string {
+	host := c.GetHeader("X-Forwarded-Host")
+	if host == "" {
+		host = c.Request.Host
+	}
+	if idx := strings.LastIndex(host, ":"); idx != -1 && !strings.HasSuffix(host, "]") {
+		host = host[:idx]
+	}
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+	return host + ":" + strconv.Itoa(inbound.Port)
+}
+
+// handleWGPeers renders the peers of a WireGuard inbound
+func (s *Server) handleWGPeers(c *gin.Context) {
+	inbound, ok := s.wgInbound(c)
+	if !ok {
+		return
+	}
+
+	var peers []models.WireGuardPeer
+	s.db.Preload("User").Where("inbound_id = ?", inbound.ID).Order("created_at ASC").Find(&peers)
+	var users []models.User
+	s.db.Order("name ASC").Find(&users)
+
+	subnet := ""
+	if prefix, _, err := inbound.WGSubnet(); err == nil {
+		subnet = prefix.String()
+	}
+
+	c.HTML(http.StatusOK, "components/wg-peers.html", gin.H{
+		"Inbound":         inbound,
+		"Peers":           peers,
+		"Users":           users,
+		"Subnet":          subnet,
+		"ServerPublicKey": wgServerPublicKey(inbound),
+		"Endpoint":        wgEndpoint(c, inbound),
+	})
+}
+
+// handleCreateWGPeer provisions a peer for a user or a relay node: a new key
+// pair, a preshared key and the next free tunnel address
+func (s *Server) handleCreateWGPeer(c *gin.Context) {
+	inbound, ok := s.wgInbound(c)
+	if !ok {
+		return
+	}
+
+	peer := models.WireGuardPeer{
+		InboundID: inbound.ID,
+		UserID:    c.PostForm("user_id"),
+		Name:      strings.TrimSpace(c.PostForm("name")),
+		Remark:    c.PostForm("remark"),
+		Enabled:   true,
+	}
+	if peer.UserID != "" {
+		var user models.User
+		if err := s.db.First(&user, "id = ?", peer.UserID).Error; err != nil {
+			jsonError(c, http.StatusBadRequest, "用户不存在")
+			return
+		}
+		// 同一用户多台设备时以设备名区分
+		if peer.Name == "" {
+			peer.Name = user.Name
+		} else {
+			peer.Name = user.Name + "-" + peer.Name
+		}
+	}
+	if peer.Name == "" {
+		jsonError(c, http.StatusBadRequest, "请选择用户或填写节点名称")
+		return
+	}
+	if !wgPeerNamePattern.MatchString(peer.Name) {
+		jsonError(c, http.StatusBadRequest, "名称不能包含空白、@ 或 >")
+		return
+	}
+	peer.Email = peer.Name + "@" + inbound.Tag
+
+	var count int64
+	s.db.Model(&models.WireGuardPeer{}).Where("email = ?", peer.Email).Count(&count)
+	if count > 0 {
+		jsonError(c, http.StatusBadRequest, "对端已存在: "+peer.Email)
+		return
+	}
+
+	var err error
+	if peer.PrivateKey, peer.PublicKey, err = generateWGKeyPair(); err != nil {
+		jsonError(c, http.StatusInternalServerError, "生成密钥失败: "+err.Error())
+		return
+	}
+	psk := make([]byte, 32)
+	if _, err := rand.Read(psk); err != nil {
+		jsonError(c, http.StatusInternalServerError, "生成预共享密钥失败: "+err.Error())
+		return
+	}
+	peer.PresharedKey = base64.StdEncoding.EncodeToString(psk)
+
+	if err := models.CreateWGPeer(s.db, *inbound, &peer); err != nil {
+		logger.Error("Failed to create wireguard peer %s: %v", peer.Email, err)
+		jsonError(c, http.StatusInternalServerError, "创建失败: "+err.Error())
+		return
+	}
+
+	logger.Info("WireGuard peer created: %s (%s)", peer.Email, peer.Address)
+	s.handleWGPeers(c)
+}
+
+// wgPeer loads a peer of the request's inbound
+func (s *Server) wgPeer(c *gin.Context) (*models.WireGuardPeer, bool) {
+	var peer models.WireGuardPeer
+	if err := s.db.First(&peer, "id = ? AND inbound_id = ?", c.Param("peer"), c.Param("id")).Error; err != nil {
+		jsonError(c, http.StatusNotFound, "Peer not found")
+		return nil, false
+	}
+	return &peer, true
+}
+
+func (s *Server) handleToggleWGPeer(c *gin.Context) {
+	peer, ok := s.wgPeer(c)
+	if !ok {
+		return
+	}
+
+	peer.Enabled = !peer.Enabled
+	if err := s.db.Model(peer).Update("enabled", peer.Enabled).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "更新失败: "+err.Error())
+		return
+	}
+
+	logger.Info("WireGuard peer toggled: %s (Enabled: %v)", peer.Email, peer.Enabled)
+	s.handleWGPeers(c)
+}
+
+func (s *Server) handleDeleteWGPeer(c *gin.Context) {
+	peer, ok := s.wgPeer(c)
+	if !ok {
+		return
+	}
+	if err := s.db.Delete(peer).Error; err != nil {
+		jsonError(c, http.StatusInternalServerError, "删除失败")
+		return
+	}
+
+	logger.Info("WireGuard peer deleted: %s", peer.Email)
+	s.handleWGPeers(c)
+}
+
+// handleWGPeerConf returns the wg-quick config of a peer, as a .conf
+// attachment with download=1
+func (s *Server) handleWGPeerConf(c *gin.Context) {
+	inbound, ok := s.wgInbound(c)
+	if !ok {
+		return
+	}
+	peer, ok := s.wgPeer(c)
+	if !ok {
+		return
+	}
+
+	conf := peer.ClientConfig(*inbound, wgServerPublicKey(inbound), wgEndpoint(c, inbound))
+	if c.Query("download") == "1" {
+		// wg-quick 以文件名作为接口名，最长 15 个字符
+		name := wgConfFileName.ReplaceAllString(peer.Name, "_")
+		if len(name) > 15 {
+			name = name[:15]
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.conf"`, name))
+	}
+	c.String(http.StatusOK, conf)
+}
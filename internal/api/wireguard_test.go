@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"xray-panel/internal/models"
+)
+
+func TestCreateWGPeerAddresses(t *testing.T) {
+	ts := newTestServer(t)
+	inbound := models.Inbound{Tag: "wg-in", Protocol: models.ProtocolWireGuard, Port: 51820, WGLocalIP: "10.9.0.1/24", Enabled: true}
+	if err := ts.db.Create(&inbound).Error; err != nil {
+		t.Fatalf("create inbound: %v", err)
+	}
+
+	for _, name := range []string{"relay-a", "relay-b"} {
+		w := ts.do("POST", "/api/inbounds/"+inbound.ID+"/wg-peers", url.Values{"name": {name}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("create %s: HTTP %d %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	var peers []models.WireGuardPeer
+	ts.db.Where("inbound_id = ?", inbound.ID).Order("created_at ASC").Find(&peers)
+	if len(peers) != 2 || peers[0].Address != "10.9.0.2/32" || peers[1].Address != "10.9.0.3/32" {
+		t.Fatalf("peers = %+v, want 10.9.0.2 and 10.9.0.3", peers)
+	}
+
+	// The unique index rejects a second peer on the same address
+	dup := models.WireGuardPeer{InboundID: inbound.ID, Name: "dup", Email: "dup@wg-in", PublicKey: "x", Address: peers[0].Address}
+	if err := ts.db.Create(&dup).Error; err == nil {
+		t.Error("duplicate tunnel address was stored")
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"xray-panel/internal/logger"
+	"xray-panel/internal/xray"
+)
+
+// handleXrayBinariesTable renders the installed Xray binaries
+func (s *Server) handleXrayBinariesTable(c *gin.Context) {
+	binaries, err := s.xrayBinaries.List()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "读取内核目录失败: "+err.Error())
+		return
+	}
+
+	// binary_path 还不是由面板管理的链接时，显示其版本信息
+	var unmanaged string
+	active := s.xrayBinaries.Active()
+	if active == "" {
+		unmanaged, _ = xray.BinaryVersion(s.xrayBinaries.BinaryPath())
+	}
+
+	c.HTML(http.StatusOK, "components/xray-binaries-table.html", gin.H{
+		"Binaries":   binaries,
+		"BinaryPath": s.xrayBinaries.BinaryPath(),
+		"Active":     active,
+		"Previous":   s.xrayBinaries.Previous(),
+		"Unmanaged":  unmanaged,
+	})
+}
+
+// handleUploadXrayBinary installs an uploaded release archive after checking
+// its SHA-256 checksum
+func (s *Server) handleUploadXrayBinary(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, "请选择要上传的内核压缩包")
+		return
+	}
+	if file.Size > xray.MaxBinaryUpload {
+		jsonError(c, http.StatusBadRequest, "文件过大")
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, "读取上传文件失败")
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, xray.MaxBinaryUpload))
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, "读取上传文件失败")
+		return
+	}
+
+	info, err := s.xrayBinaries.Install(data, file.Filename, c.PostForm("sha256"))
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logger.Info("Xray binary %s installed from %s by %s", info.Version, info.Source, c.GetString("username"))
+	jsonOK(c, info)
+}
+
+// handleTestXrayBinary validates the current config against a candidate binary
+func (s *Server) handleTestXrayBinary(c *gin.Context) {
+	info, err := s.xrayBinaries.Get(c.Param("version"))
+	if err != nil {
+		jsonError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := s.testXrayBinary(info); err != nil {
+		jsonError(c, http.StatusBadRequest, "配置校验失败: "+err.Error())
+		return
+	}
+	jsonOK(c, gin.H{
+		"valid":   true,
+		"message": "当前配置可以在 " + info.Version + " 上运行",
+	})
+}
+
+// handleActivateXrayBinary switches Xray to an installed version
+func (s *Server) handleActivateXrayBinary(c *gin.Context) {
+	s.switchXrayBinary(c, c.Param("version"))
+}
+
+// handleRollbackXrayBinary switches back to the previously active version
+func (s *Server) handleRollbackXrayBinary(c *gin.Context) {
+	previous := s.xrayBinaries.Previous()
+	if previous == "" {
+		jsonError(c, http.StatusBadRequest, "没有可回滚的版本")
+		return
+	}
+	s.switchXrayBinary(c, previous)
+}
+
+// handleDeleteXrayBinary removes an installed version
+func (s *Server) handleDeleteXrayBinary(c *gin.Context) {
+	version := c.Param("version")
+	if err := s.xrayBinaries.Remove(version); err != nil {
+		jsonError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logger.Info("Xray binary %s removed by %s", version, c.GetString("username"))
+	jsonOK(c, gin.H{"deleted": true})
+}
+
+// switchXrayBinary validates the config with the candidate, links it as the
+// active binary and restarts Xray. If Xray fails to restart the old binary is
+// restored.
+func (s *Server) switchXrayBinary(c *gin.Context, version string) {
+	info, err := s.xrayBinaries.Get(version)
+	if err != nil {
+		jsonError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := s.testXrayBinary(info); err != nil {
+		jsonError(c, http.StatusBadRequest, "配置校验失败，未切换: "+err.Error())
+		return
+	}
+
+	current := s.xrayBinaries.Active()
+	if err := s.xrayBinaries.Switch(version); err != nil {
+		jsonError(c, http.StatusInternalServerError, "切换失败: "+err.Error())
+		return
+	}
+
+	if err := s.restartXray(); err != nil {
+		msg := "Xray 重启失败: " + err.Error()
+		if current != "" {
+			if switchErr := s.xrayBinaries.Switch(current); switchErr == nil {
+				s.restartXray()
+				msg += "，已切回 " + current
+			}
+		}
+		logger.Error("Xray binary switch to %s failed: %v", version, err)
+		jsonError(c, http.StatusInternalServerError, msg)
+		return
+	}
+
+	logger.Info("Xray binary switched to %s by %s", version, c.GetString("username"))
+	jsonOK(c, gin.H{
+		"active":  version,
+		"message": fmt.Sprintf("已切换到 %s 并重启 Xray", version),
+	})
+}
+
+// testXrayBinary runs `-test` with the candidate binary on the config Xray
+// will load after a restart
+func (s *Server) testXrayBinary(info xray.BinaryInfo) error {
+	configJSON, err := s.activeXrayConfig()
+	if err != nil {
+		return err
+	}
+	return s.validateXrayConfigWith(info.Path, configJSON)
+}
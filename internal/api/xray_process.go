@@ -0,0 +1,63 @@
+package api
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"xray-panel/internal/logger"
+	"xray-panel/internal/service"
+	"xray-panel/internal/xray"
+)
+
+// startXrayProcess starts the supervised Xray process and stops it when the
+// panel receives SIGINT / SIGTERM, so no orphaned Xray is left behind
+func (s *Server) startXrayProcess() {
+	if err := s.xrayProcess.Start(); err != nil {
+		logger.Error("Supervised Xray failed to start, retrying in background: %v", err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		received := <-sig
+		logger.Info("Received %v, stopping Xray", received)
+		s.xrayProcess.Stop()
+		os.Exit(0)
+	}()
+}
+
+// supervisedXray adapts the built-in supervisor to service.Manager
+type supervisedXray struct {
+	p *xray.Process
+}
+
+func (x supervisedXray) Start() (string, error) { return "", x.p.Start() }
+func (x supervisedXray) Stop() (string, error)  { x.p.Stop(); return "", nil }
+
+func (x supervisedXray) Restart() (string, error) { return "", x.p.Restart() }
+
+// Reload restarts Xray, which has no in-place config reload
+func (x supervisedXray) Reload() (string, error) { return "", x.p.Restart() }
+
+func (x supervisedXray) Status() (service.Status, error) {
+	status := x.p.Status()
+	state := "inactive"
+	if status.Running {
+		state = "active"
+	}
+	return service.Status{Active: status.Running, State: state, Output: strings.Join(status.RecentOutput, "\n")}, nil
+}
+
+func (x supervisedXray) String() string { return "builtin:xray" }
+
+// restartXray restarts Xray through the configured service manager (or the
+// built-in supervisor when enabled)
+func (s *Server) restartXray() error {
+	out, err := s.xrayService.Restart()
+	if out = strings.TrimSpace(out); out != "" {
+		logger.Debug("Xray restart (%s): %s", s.xrayService, out)
+	}
+	return err
+}
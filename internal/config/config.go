@@ -59,14 +59,37 @@ type XrayConfig struct {
 	AssetsPath string `yaml:"assets_path"`
 	APIPort    int    `yaml:"api_port"`
 	SocketDir  string `yaml:"socket_dir"`
+	Supervise  bool   `yaml:"supervise"`  // 由面板直接运行并守护 Xray 进程，不依赖 systemd
+	BinaryDir  string `yaml:"binary_dir"` // 面板管理的多版本 Xray 内核目录，binary_path 指向其中的当前版本
+
+	Service ServiceConfig `yaml:"service"` // 未启用 supervise 时控制 xray 服务的方式
 }
 
 // NginxConfig holds Nginx settings
 type NginxConfig struct {
 	ConfigDir string `yaml:"config_dir"`
 	StreamDir string `yaml:"stream_dir"`
-	ReloadCmd string `yaml:"reload_cmd"`
+	ReloadCmd string `yaml:"reload_cmd"` // 已废弃，请使用 service.reload_cmd
 	CertDir   string `yaml:"cert_dir"`
+
+	Service ServiceConfig `yaml:"service"`
+}
+
+// ServiceConfig selects how the panel controls a system service
+type ServiceConfig struct {
+	Manager   string `yaml:"manager"`    // systemd（默认）/ openrc / supervisord / docker / none
+	Name      string `yaml:"name"`       // 服务名 / supervisord 程序名 / 容器名，默认 xray 或 nginx
+	ReloadCmd string `yaml:"reload_cmd"` // 自定义重载命令，docker 下在容器内执行
+}
+
+// NginxService returns the nginx service config, carrying over the legacy
+// nginx.reload_cmd when service.reload_cmd is not set
+func (c *Config) NginxService() ServiceConfig {
+	svc := c.Nginx.Service
+	if svc.ReloadCmd == "" && c.Nginx.ReloadCmd != "" && c.Nginx.ReloadCmd != "systemctl reload nginx" {
+		svc.ReloadCmd = c.Nginx.ReloadCmd
+	}
+	return svc
 }
 
 // Load reads configuration from a YAML file
@@ -102,6 +125,13 @@ func (c *Config) Validate() error {
 	if c.Server.Listen == "" {
 		return fmt.Errorf("server.listen 不能为空")
 	}
+	for name, svc := range map[string]ServiceConfig{"xray": c.Xray.Service, "nginx": c.Nginx.Service} {
+		switch svc.Manager {
+		case "", "systemd", "openrc", "supervisord", "docker", "none":
+		default:
+			return fmt.Errorf("%s.service.manager 不支持: %s", name, svc.Manager)
+		}
+	}
 	return nil
 }
 
@@ -138,6 +168,7 @@ func Default() *Config {
 			AssetsPath: "/usr/local/share/xray",
 			APIPort:    10085,
 			SocketDir:  "/dev/shm",
+			BinaryDir:  "/opt/xray-panel/xray",
 		},
 		Nginx: NginxConfig{
 			ConfigDir: "/etc/nginx/conf.d",
@@ -37,7 +37,7 @@ func Init(dbPath string) (*gorm.DB, error) {
 
 // Migrate runs auto-migrations for all models
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		&models.Admin{},
 		&models.User{},
 		&models.Domain{},
@@ -45,9 +45,35 @@ func Migrate(db *gorm.DB) error {
 		&models.Outbound{},
 		&models.RoutingRule{},
 		&models.NginxConfig{},
-		&models.Setting{})
+		&models.Setting{},
+		&models.Announcement{},
+		&models.SubscriptionSource{},
+		&models.OutboundGroup{},
+		&models.DNSServer{},
+		&models.DNSHost{},
+		&models.ConfigRevision{},
+		&models.UserOnlineIP{},
+		&models.AccessLog{},
+		&models.GeoDataUpdate{},
+		&models.CustomGeoList{},
+		&models.LocalInbound{}); err != nil {
+		return err
+	}
+	// Peers sharing an address would block the unique index
+	if err := models.DedupeWGPeerAddresses(db); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&models.WireGuardPeer{}); err != nil {
+		return err
+	}
+
+	// Data migrations
+	return models.MigrateRoutingRules(db)
 }
 
+// localInboundsSeededKey marks that the default local inbounds were created
+const localInboundsSeededKey = "local_inbounds_seeded"
+
 // Seed creates default admin and settings if they don't exist
 func Seed(db *gorm.DB, cfg *config.Config) error {
 	// 1. Check if admin exists
@@ -115,6 +141,27 @@ func Seed(db *gorm.DB, cfg *config.Config) error {
 		}
 	}
 
+	// 4. Default DNS servers
+	db.Model(&models.DNSServer{}).Count(&count)
+	if count == 0 {
+		for _, d := range models.DefaultDNSServers() {
+			db.Create(&d)
+		}
+	}
+
+	// 5. Default client-mode local inbounds, once: inbounds the admin deleted
+	// are not created again on the next start
+	var seeded models.Setting
+	if err := db.Where("key = ?", localInboundsSeededKey).First(&seeded).Error; err != nil {
+		db.Model(&models.LocalInbound{}).Count(&count)
+		if count == 0 {
+			for _, l := range models.DefaultLocalInbounds() {
+				db.Create(&l)
+			}
+		}
+		db.Create(&models.Setting{Key: localInboundsSeededKey, Value: "true", Type: "bool", Remark: "Default local inbounds created"})
+	}
+
 	return nil
 }
 
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gorml "gorm.io/gorm/logger"
+
+	"xray-panel/internal/config"
+	applogger "xray-panel/internal/logger"
+	"xray-panel/internal/models"
+)
+
+func TestSeedLocalInboundsOnce(t *testing.T) {
+	applogger.Init(&config.LogConfig{Level: "error"})
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gorml.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	cfg := config.Default()
+
+	if err := Seed(db, cfg); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	var count int64
+	db.Model(&models.LocalInbound{}).Count(&count)
+	if want := int64(len(models.DefaultLocalInbounds())); count != want {
+		t.Fatalf("first seed created %d local inbounds, want %d", count, want)
+	}
+
+	// 管理员删除全部本地入站后重启，不应再次创建
+	db.Where("1 = 1").Delete(&models.LocalInbound{})
+	if err := Seed(db, cfg); err != nil {
+		t.Fatalf("second seed: %v", err)
+	}
+	db.Model(&models.LocalInbound{}).Count(&count)
+	if count != 0 {
+		t.Errorf("second seed re-created %d local inbounds", count)
+	}
+}
+
+func TestMigrateDedupesWGPeerAddresses(t *testing.T) {
+	applogger.Init(&config.LogConfig{Level: "error"})
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gorml.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	// 旧版本没有唯一索引，可能存在重复地址
+	db.Migrator().DropIndex(&models.WireGuardPeer{}, "idx_wg_peer_inbound_address")
+	inbound := models.Inbound{Tag: "wg-in", Protocol: models.ProtocolWireGuard, Port: 51820, WGLocalIP: "10.9.0.1/24"}
+	db.Create(&inbound)
+	for _, name := range []string{"a", "b"} {
+		db.Create(&models.WireGuardPeer{InboundID: inbound.ID, Name: name, Email: name + "@wg-in", PublicKey: name, Address: "10.9.0.2/32"})
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate with duplicates: %v", err)
+	}
+	var addrs []string
+	db.Model(&models.WireGuardPeer{}).Order("address").Pluck("address", &addrs)
+	if len(addrs) != 2 || addrs[0] != "10.9.0.2/32" || addrs[1] != "10.9.0.3/32" {
+		t.Errorf("addresses after migrate = %v", addrs)
+	}
+	if !db.Migrator().HasIndex(&models.WireGuardPeer{}, "idx_wg_peer_inbound_address") {
+		t.Error("unique index not created")
+	}
+}
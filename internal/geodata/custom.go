@@ -0,0 +1,137 @@
+package geodata
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// domainTypeValues maps rule types to the protobuf Domain.Type enum
+var domainTypeValues = map[string]uint64{DomainKeyword: 0, DomainRegexp: 1, DomainSuffix: 2, DomainFull: 3}
+
+// ParseDomainRule parses one line of a custom domain list:
+//
+//	example.com                  该域名及其子域名（同 domain:）
+//	full:www.example.com @cn     完整匹配，带属性 cn
+//	keyword:google / regexp:\.cn$
+func ParseDomainRule(line string) (Domain, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return Domain{}, fmt.Errorf("空规则")
+	}
+
+	d := Domain{Type: DomainSuffix, Value: fields[0]}
+	if typ, value, ok := strings.Cut(fields[0], ":"); ok {
+		if _, known := domainTypeValues[typ]; !known {
+			return Domain{}, fmt.Errorf("未知的规则类型: %s", typ)
+		}
+		d.Type, d.Value = typ, value
+	}
+	if d.Value == "" {
+		return Domain{}, fmt.Errorf("规则内容为空: %s", line)
+	}
+	if d.Type == DomainRegexp {
+		if _, err := regexp.Compile(d.Value); err != nil {
+			return Domain{}, fmt.Errorf("正则无效: %s", d.Value)
+		}
+	} else {
+		d.Value = strings.ToLower(d.Value)
+	}
+
+	for _, attr := range fields[1:] {
+		if !strings.HasPrefix(attr, "@") || len(attr) == 1 {
+			return Domain{}, fmt.Errorf("属性需以 @ 开头: %s", attr)
+		}
+		d.Attributes = append(d.Attributes, strings.ToLower(attr[1:]))
+	}
+	return d, nil
+}
+
+// ParseCIDRRule parses one line of a custom IP list: a CIDR or a single address
+func ParseCIDRRule(line string) (netip.Prefix, error) {
+	line = strings.TrimSpace(line)
+	if addr, err := netip.ParseAddr(line); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(line)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("无效的 IP / CIDR: %s", line)
+	}
+	return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked(), nil
+}
+
+// EncodeGeoSite builds a GeoSiteList from categories of domain rules, in the
+// layout parseGeoSiteIndex reads. Categories are written sorted, with
+// upper-case codes like the official files.
+func EncodeGeoSite(categories map[string][]Domain) []byte {
+	var out []byte
+	for _, code := range sortedKeys(categories) {
+		site := appendString(nil, 1, strings.ToUpper(code))
+		for _, d := range categories[code] {
+			domain := appendVarintField(nil, 1, domainTypeValues[d.Type])
+			domain = appendString(domain, 2, d.Value)
+			for _, attr := range d.Attributes {
+				// Attribute { string key = 1; bool bool_value = 2; }
+				attribute := appendString(nil, 1, attr)
+				attribute = appendVarintField(attribute, 2, 1)
+				domain = appendBytes(domain, 3, attribute)
+			}
+			site = appendBytes(site, 2, domain)
+		}
+		out = appendBytes(out, 1, site)
+	}
+	return out
+}
+
+// EncodeGeoIP builds a GeoIPList from codes of CIDRs, in the layout
+// parseGeoIPIndex reads
+func EncodeGeoIP(codes map[string][]netip.Prefix) []byte {
+	var out []byte
+	for _, code := range sortedKeys(codes) {
+		geoip := appendString(nil, 1, strings.ToUpper(code))
+		for _, prefix := range codes[code] {
+			cidr := appendBytes(nil, 1, prefix.Addr().AsSlice())
+			cidr = appendVarintField(cidr, 2, uint64(prefix.Bits()))
+			geoip = appendBytes(geoip, 2, cidr)
+		}
+		out = appendBytes(out, 1, geoip)
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendVarint appends v in protobuf varint encoding
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendVarintField appends a wire type 0 field
+func appendVarintField(b []byte, field, v uint64) []byte {
+	return appendVarint(appendVarint(b, field<<3), v)
+}
+
+// appendBytes appends a wire type 2 (length-delimited) field
+func appendBytes(b []byte, field uint64, value []byte) []byte {
+	b = appendVarint(b, field<<3|2)
+	b = appendVarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendString(b []byte, field uint64, value string) []byte {
+	return appendBytes(b, field, []byte(value))
+}
@@ -0,0 +1,489 @@
+package geodata
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Domain rule types, named as in Xray's routing config
+const (
+	DomainKeyword = "keyword" // Plain: 子串匹配
+	DomainRegexp  = "regexp"  // Regex: 正则匹配
+	DomainSuffix  = "domain"  // Domain: 该域名及其子域名
+	DomainFull    = "full"    // Full: 完整匹配
+)
+
+// domainTypes maps the protobuf Domain.Type enum to rule types
+var domainTypes = map[uint64]string{0: DomainKeyword, 1: DomainRegexp, 2: DomainSuffix, 3: DomainFull}
+
+// Domain is one rule of a GeoSite category
+type Domain struct {
+	Type       string   `json:"type"`
+	Value      string   `json:"value"`
+	Attributes []string `json:"attributes,omitempty"` // e.g. "cn", "ads"
+}
+
+// String returns the rule in Xray's "type:value" notation
+func (d Domain) String() string {
+	return d.Type + ":" + d.Value
+}
+
+// HasAttribute reports whether the rule carries the attribute (geosite:name@attr)
+func (d Domain) HasAttribute(attr string) bool {
+	for _, a := range d.Attributes {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// GeoSiteMatch is a category rule that matches a domain
+type GeoSiteMatch struct {
+	Category string `json:"category"`
+	Rule     Domain `json:"rule"`
+}
+
+// GeoIPMatch is a geoip code whose CIDR contains an address
+type GeoIPMatch struct {
+	Code string `json:"code"`
+	CIDR string `json:"cidr"`
+}
+
+// domainRef points at one rule of a category
+type domainRef struct {
+	category string
+	index    int
+}
+
+// GeoSiteIndex holds the decoded geosite.dat with lookup indexes
+type GeoSiteIndex struct {
+	categories map[string][]Domain
+	full       map[string][]domainRef
+	suffix     map[string][]domainRef
+	keywords   []domainRef
+	regexps    []domainRef
+
+	regexpOnce sync.Once
+	compiled   []*regexp.Regexp // parallel to regexps, nil if invalid
+}
+
+// GeoIPIndex holds the decoded geoip.dat
+type GeoIPIndex struct {
+	codes        map[string][]netip.Prefix
+	reverseMatch map[string]bool
+}
+
+// GeoSite returns the cached geosite.dat index, re-parsed when the file changes
+func (p *GeoDataParser) GeoSite() (*GeoSiteIndex, error) {
+	return p.GeoSiteFile("geosite.dat")
+}
+
+// GeoSiteFile returns the index of a geosite-format file in the assets path,
+// such as one referenced by ext:<file>:<tag>
+func (p *GeoDataParser) GeoSiteFile(name string) (*GeoSiteIndex, error) {
+	v, err := siteIndexCache.load(filepath.Join(p.assetsPath, filepath.Base(name)), func(data []byte) (interface{}, error) {
+		return parseGeoSiteIndex(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*GeoSiteIndex), nil
+}
+
+// GeoIP returns the cached geoip.dat index, re-parsed when the file changes
+func (p *GeoDataParser) GeoIP() (*GeoIPIndex, error) {
+	return p.GeoIPFile("geoip.dat")
+}
+
+// GeoIPFile returns the index of a geoip-format file in the assets path
+func (p *GeoDataParser) GeoIPFile(name string) (*GeoIPIndex, error) {
+	v, err := ipIndexCache.load(filepath.Join(p.assetsPath, filepath.Base(name)), func(data []byte) (interface{}, error) {
+		return parseGeoIPIndex(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*GeoIPIndex), nil
+}
+
+// Categories returns all category names, sorted
+func (x *GeoSiteIndex) Categories() []string {
+	names := make([]string, 0, len(x.categories))
+	for name := range x.categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Domains returns the rules of a category, optionally only those carrying attr
+func (x *GeoSiteIndex) Domains(category, attr string) ([]Domain, bool) {
+	domains, ok := x.categories[strings.ToLower(category)]
+	if !ok || attr == "" {
+		return domains, ok
+	}
+	var filtered []Domain
+	for _, d := range domains {
+		if d.HasAttribute(attr) {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered, true
+}
+
+// Lookup returns every category rule that matches the domain
+func (x *GeoSiteIndex) Lookup(domain string) []GeoSiteMatch {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if domain == "" {
+		return nil
+	}
+
+	var refs []domainRef
+	refs = append(refs, x.full[domain]...)
+	// 依次检查 a.b.example.com、b.example.com、example.com、com
+	for name := domain; ; {
+		refs = append(refs, x.suffix[name]...)
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+	for _, ref := range x.keywords {
+		if strings.Contains(domain, x.categories[ref.category][ref.index].Value) {
+			refs = append(refs, ref)
+		}
+	}
+
+	x.regexpOnce.Do(x.compileRegexps)
+	for i, ref := range x.regexps {
+		if re := x.compiled[i]; re != nil && re.MatchString(domain) {
+			refs = append(refs, ref)
+		}
+	}
+
+	matches := make([]GeoSiteMatch, 0, len(refs))
+	for _, ref := range refs {
+		matches = append(matches, GeoSiteMatch{Category: ref.category, Rule: x.categories[ref.category][ref.index]})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Category < matches[j].Category })
+	return matches
+}
+
+// compileRegexps compiles the regexp rules on first use
+func (x *GeoSiteIndex) compileRegexps() {
+	x.compiled = make([]*regexp.Regexp, len(x.regexps))
+	for i, ref := range x.regexps {
+		x.compiled[i], _ = regexp.Compile(x.categories[ref.category][ref.index].Value)
+	}
+}
+
+// Codes returns all geoip codes, sorted
+func (x *GeoIPIndex) Codes() []string {
+	codes := make([]string, 0, len(x.codes))
+	for code := range x.codes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// CIDRs returns the CIDRs of a geoip code
+func (x *GeoIPIndex) CIDRs(code string) ([]netip.Prefix, bool) {
+	cidrs, ok := x.codes[strings.ToLower(code)]
+	return cidrs, ok
+}
+
+// Lookup returns every geoip code with a CIDR containing the address. Codes
+// with reverse_match set match addresses outside their CIDRs.
+func (x *GeoIPIndex) Lookup(addr netip.Addr) []GeoIPMatch {
+	addr = addr.Unmap()
+	var matches []GeoIPMatch
+	for code, cidrs := range x.codes {
+		var hit netip.Prefix
+		for _, cidr := range cidrs {
+			if cidr.Contains(addr) {
+				hit = cidr
+				break
+			}
+		}
+		switch {
+		case hit.IsValid() && !x.reverseMatch[code]:
+			matches = append(matches, GeoIPMatch{Code: code, CIDR: hit.String()})
+		case !hit.IsValid() && x.reverseMatch[code]:
+			matches = append(matches, GeoIPMatch{Code: code, CIDR: "!" + code})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Code < matches[j].Code })
+	return matches
+}
+
+// parseGeoSiteIndex decodes a GeoSiteList:
+//
+//	GeoSite { string country_code = 1; repeated Domain domain = 2; }
+//	Domain  { Type type = 1; string value = 2; repeated Attribute attribute = 3; }
+func parseGeoSiteIndex(data []byte) (*GeoSiteIndex, error) {
+	x := &GeoSiteIndex{
+		categories: make(map[string][]Domain),
+		full:       make(map[string][]domainRef),
+		suffix:     make(map[string][]domainRef),
+	}
+
+	err := forEachField(data, func(field, wireType uint64, value []byte) error {
+		if field != 1 || wireType != 2 {
+			return nil
+		}
+		var code string
+		var domains []Domain
+		err := forEachField(value, func(field, wireType uint64, value []byte) error {
+			switch {
+			case field == 1 && wireType == 2:
+				code = strings.ToLower(string(value))
+			case field == 2 && wireType == 2:
+				d, err := parseDomain(value)
+				if err != nil {
+					return err
+				}
+				domains = append(domains, d)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if code == "" {
+			return nil
+		}
+
+		base := len(x.categories[code])
+		x.categories[code] = append(x.categories[code], domains...)
+		for i, d := range domains {
+			ref := domainRef{category: code, index: base + i}
+			switch d.Type {
+			case DomainFull:
+				x.full[strings.ToLower(d.Value)] = append(x.full[strings.ToLower(d.Value)], ref)
+			case DomainSuffix:
+				x.suffix[strings.ToLower(d.Value)] = append(x.suffix[strings.ToLower(d.Value)], ref)
+			case DomainKeyword:
+				x.keywords = append(x.keywords, ref)
+			case DomainRegexp:
+				x.regexps = append(x.regexps, ref)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("解析 geosite.dat 失败: %w", err)
+	}
+	return x, nil
+}
+
+// parseDomain decodes one Domain message. Attributes are
+// { string key = 1; oneof { bool bool_value = 2; int64 int_value = 3; } };
+// int attributes are shown as key=value.
+func parseDomain(data []byte) (Domain, error) {
+	d := Domain{Type: DomainKeyword}
+	err := forEachField(data, func(field, wireType uint64, value []byte) error {
+		switch {
+		case field == 1 && wireType == 0:
+			if t, ok := domainTypes[decodeVarint(value)]; ok {
+				d.Type = t
+			}
+		case field == 2 && wireType == 2:
+			d.Value = string(value)
+		case field == 3 && wireType == 2:
+			var key string
+			var intValue uint64
+			hasInt := false
+			forEachField(value, func(field, wireType uint64, value []byte) error {
+				switch {
+				case field == 1 && wireType == 2:
+					key = string(value)
+				case field == 3 && wireType == 0:
+					intValue, hasInt = decodeVarint(value), true
+				}
+				return nil
+			})
+			if key != "" {
+				if hasInt {
+					key = fmt.Sprintf("%s=%d", key, int64(intValue))
+				}
+				d.Attributes = append(d.Attributes, key)
+			}
+		}
+		return nil
+	})
+	return d, err
+}
+
+// parseGeoIPIndex decodes a GeoIPList:
+//
+//	GeoIP { string country_code = 1; repeated CIDR cidr = 2; bool reverse_match = 3; }
+//	CIDR  { bytes ip = 1; uint32 prefix = 2; }
+func parseGeoIPIndex(data []byte) (*GeoIPIndex, error) {
+	x := &GeoIPIndex{
+		codes:        make(map[string][]netip.Prefix),
+		reverseMatch: make(map[string]bool),
+	}
+
+	err := forEachField(data, func(field, wireType uint64, value []byte) error {
+		if field != 1 || wireType != 2 {
+			return nil
+		}
+		var code string
+		var cidrs []netip.Prefix
+		reverse := false
+		err := forEachField(value, func(field, wireType uint64, value []byte) error {
+			switch {
+			case field == 1 && wireType == 2:
+				code = strings.ToLower(string(value))
+			case field == 2 && wireType == 2:
+				if cidr, ok := parseCIDR(value); ok {
+					cidrs = append(cidrs, cidr)
+				}
+			case field == 3 && wireType == 0:
+				reverse = decodeVarint(value) != 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if code != "" {
+			x.codes[code] = append(x.codes[code], cidrs...)
+			x.reverseMatch[code] = reverse
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("解析 geoip.dat 失败: %w", err)
+	}
+	return x, nil
+}
+
+// parseCIDR decodes one CIDR message
+func parseCIDR(data []byte) (netip.Prefix, bool) {
+	var ip []byte
+	var bits uint64
+	forEachField(data, func(field, wireType uint64, value []byte) error {
+		switch {
+		case field == 1 && wireType == 2:
+			ip = value
+		case field == 2 && wireType == 0:
+			bits = decodeVarint(value)
+		}
+		return nil
+	})
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	prefix, err := addr.Unmap().Prefix(int(bits))
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix, true
+}
+
+// forEachField calls fn for every top-level field of a protobuf message.
+// value is the raw payload: the varint bytes for wire type 0, the content
+// for wire type 2, and the fixed bytes for wire types 1 and 5.
+func forEachField(data []byte, fn func(field, wireType uint64, value []byte) error) error {
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		tag, err := readVarint(r)
+		if err != nil {
+			return err
+		}
+		field, wireType := tag>>3, tag&0x7
+
+		start := len(data) - r.Len()
+		var value []byte
+		switch wireType {
+		case 0:
+			if _, err := readVarint(r); err != nil {
+				return err
+			}
+			value = data[start : len(data)-r.Len()]
+		case 2:
+			length, err := readVarint(r)
+			if err != nil {
+				return err
+			}
+			offset := len(data) - r.Len()
+			if length > uint64(r.Len()) {
+				return io.ErrUnexpectedEOF
+			}
+			value = data[offset : offset+int(length)]
+			r.Seek(int64(length), io.SeekCurrent)
+		default:
+			if err := skipField(r, wireType); err != nil {
+				return err
+			}
+			value = data[start : len(data)-r.Len()]
+		}
+		if err := fn(field, wireType, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeVarint decodes varint bytes returned by forEachField
+func decodeVarint(b []byte) uint64 {
+	v, _ := readVarint(bytes.NewReader(b))
+	return v
+}
+
+// siteIndexCache and ipIndexCache cache parsed data files until their size
+// or mtime changes
+var (
+	siteIndexCache = &fileCache{entries: make(map[string]cacheEntry)}
+	ipIndexCache   = &fileCache{entries: make(map[string]cacheEntry)}
+)
+
+type fileCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	modTime time.Time
+	size    int64
+	value   interface{}
+}
+
+// load returns the cached value for path, parsing the file if it changed
+func (c *fileCache) load(path string, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[path]; ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.value, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	value, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[path] = cacheEntry{modTime: info.ModTime(), size: info.Size(), value: value}
+	return value, nil
+}
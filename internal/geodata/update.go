@@ -0,0 +1,217 @@
+package geodata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxGeoDataSize bounds a downloaded data file
+	maxGeoDataSize = 200 << 20
+	// backupSuffix is appended to the previous version of a replaced file
+	backupSuffix = ".bak"
+)
+
+var sha256HexPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// UpdateSource is a data file and where to download it from
+type UpdateSource struct {
+	Name        string // geosite.dat / geoip.dat
+	URL         string
+	ChecksumURL string // file containing the SHA-256, empty = URL + ".sha256sum"
+}
+
+// Update downloads the sources into a staging directory next to the assets,
+// verifies their SHA-256 checksums and that they parse, then atomically
+// replaces the files that changed. The replaced files are kept as
+// <name>.bak. Returns the names of the replaced files.
+func Update(assetsPath string, sources []UpdateSource) ([]string, error) {
+	staging, err := os.MkdirTemp(assetsPath, ".geodata-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	var changed []string
+	for _, src := range sources {
+		data, err := download(src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", src.Name, err)
+		}
+		if current, err := os.ReadFile(filepath.Join(assetsPath, src.Name)); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(staging, src.Name), data, 0644); err != nil {
+			return nil, err
+		}
+		changed = append(changed, src.Name)
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	// 激活前先解析，确认文件可用
+	info := NewGeoDataParser(staging).GetGeoDataInfo()
+	for _, name := range changed {
+		switch {
+		case name == "geosite.dat" && len(info.GeoSiteTags) == 0:
+			return nil, fmt.Errorf("geosite.dat 解析失败或不包含任何分类")
+		case name == "geoip.dat" && len(info.GeoIPCodes) == 0:
+			return nil, fmt.Errorf("geoip.dat 解析失败或不包含任何国家代码")
+		}
+	}
+
+	if err := replaceAll(assetsPath, staging, changed); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// Install writes generated data files into assetsPath, skipping files whose
+// content is unchanged. Like Update, the replaced files are kept as
+// <name>.bak. Returns the names of the written files.
+func Install(assetsPath string, files map[string][]byte) ([]string, error) {
+	staging, err := os.MkdirTemp(assetsPath, ".geodata-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	var changed []string
+	for name, data := range files {
+		if current, err := os.ReadFile(filepath.Join(assetsPath, name)); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(staging, name), data, 0644); err != nil {
+			return nil, err
+		}
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+
+	if err := replaceAll(assetsPath, staging, changed); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// Restore swaps the given files with their previous version, so restoring
+// twice returns to the newer files
+func Restore(assetsPath string, names []string) error {
+	for _, name := range names {
+		path := filepath.Join(assetsPath, name)
+		backup := path + backupSuffix
+		if _, err := os.Stat(backup); err != nil {
+			return fmt.Errorf("%s 没有可恢复的旧版本", name)
+		}
+
+		tmp := path + ".swap"
+		os.Remove(tmp)
+		if err := os.Link(path, tmp); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Rename(backup, path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if _, err := os.Stat(tmp); err == nil {
+			os.Rename(tmp, backup)
+		}
+	}
+	return nil
+}
+
+// HasBackup reports whether a previous version of the file is kept
+func HasBackup(assetsPath, name string) bool {
+	_, err := os.Stat(filepath.Join(assetsPath, name+backupSuffix))
+	return err == nil
+}
+
+// replaceAll moves the staged files over the current ones. If one fails the
+// files already replaced are restored, so all files stay at the same version.
+func replaceAll(assetsPath, staging string, names []string) error {
+	for i, name := range names {
+		if err := replace(assetsPath, filepath.Join(staging, name), name); err != nil {
+			Restore(assetsPath, names[:i])
+			return fmt.Errorf("替换 %s 失败: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// replace moves the staged file over the current one. The current file is
+// hard-linked as the backup first, so the data file is never missing.
+func replace(assetsPath, staged, name string) error {
+	path := filepath.Join(assetsPath, name)
+	backup := path + backupSuffix
+
+	os.Remove(backup)
+	if err := os.Link(path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(staged, path)
+}
+
+// download fetches a data file and verifies it against its published checksum
+func download(src UpdateSource) ([]byte, error) {
+	checksumURL := src.ChecksumURL
+	if checksumURL == "" {
+		checksumURL = src.URL + ".sha256sum"
+	}
+
+	sumData, err := fetch(checksumURL, 4096)
+	if err != nil {
+		return nil, fmt.Errorf("下载校验文件失败: %w", err)
+	}
+	fields := strings.Fields(string(sumData))
+	if len(fields) == 0 || !sha256HexPattern.MatchString(fields[0]) {
+		return nil, fmt.Errorf("校验文件格式无效: %s", checksumURL)
+	}
+	expected := strings.ToLower(fields[0])
+
+	data, err := fetch(src.URL, maxGeoDataSize)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return nil, fmt.Errorf("SHA-256 校验失败: 期望 %s，实际 %s", expected, actual)
+	}
+	return data, nil
+}
+
+// fetch downloads a URL, failing if the body exceeds limit bytes
+func fetch(url string, limit int64) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("下载地址必须以 http:// 或 https:// 开头: %s", url)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("下载失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载失败: %s HTTP %d", url, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("下载失败: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("文件过大: %s", url)
+	}
+	return data, nil
+}
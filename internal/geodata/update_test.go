@@ -0,0 +1,196 @@
+package geodata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mirror serves data files and their .sha256sum files like a release mirror
+type mirror struct {
+	*httptest.Server
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMirror(t *testing.T) *mirror {
+	t.Helper()
+	m := &mirror{files: make(map[string][]byte)}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		data, ok := m.files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// publish serves a file with the given checksum file content, the real
+// checksum when sum is empty
+func (m *mirror) publish(name string, data []byte, sum string) {
+	if sum == "" {
+		h := sha256.Sum256(data)
+		sum = hex.EncodeToString(h[:])
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = data
+	m.files[name+".sha256sum"] = []byte(sum + "  " + name + "\n")
+}
+
+func (m *mirror) sources() []UpdateSource {
+	return []UpdateSource{
+		{Name: "geosite.dat", URL: m.URL + "/geosite.dat"},
+		{Name: "geoip.dat", URL: m.URL + "/geoip.dat"},
+	}
+}
+
+func testGeoSite(domain string) []byte {
+	return EncodeGeoSite(map[string][]Domain{"test": {{Type: DomainSuffix, Value: domain}}})
+}
+
+func testGeoIP(cidr string) []byte {
+	return EncodeGeoIP(map[string][]netip.Prefix{"test": {netip.MustParsePrefix(cidr)}})
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return data
+}
+
+// assertNoStaging checks that no staging directory was left behind
+func assertNoStaging(t *testing.T, dir string) {
+	t.Helper()
+	if left, _ := filepath.Glob(filepath.Join(dir, ".geodata-*")); len(left) > 0 {
+		t.Errorf("staging left behind: %v", left)
+	}
+}
+
+func TestUpdateReplacesFiles(t *testing.T) {
+	dir := t.TempDir()
+	oldSite := testGeoSite("old.example")
+	os.WriteFile(filepath.Join(dir, "geosite.dat"), oldSite, 0644)
+
+	m := newMirror(t)
+	newSite, newIP := testGeoSite("new.example"), testGeoIP("192.0.2.0/24")
+	m.publish("geosite.dat", newSite, "")
+	m.publish("geoip.dat", newIP, "")
+
+	changed, err := Update(dir, m.sources())
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if strings.Join(changed, ",") != "geosite.dat,geoip.dat" {
+		t.Errorf("changed = %v", changed)
+	}
+	if !bytes.Equal(readFile(t, filepath.Join(dir, "geosite.dat")), newSite) {
+		t.Error("geosite.dat not replaced")
+	}
+	if !bytes.Equal(readFile(t, filepath.Join(dir, "geoip.dat")), newIP) {
+		t.Error("geoip.dat not installed")
+	}
+	if !bytes.Equal(readFile(t, filepath.Join(dir, "geosite.dat.bak")), oldSite) {
+		t.Error("previous geosite.dat not kept as backup")
+	}
+	assertNoStaging(t, dir)
+
+	// Same content again: nothing to do
+	if changed, err := Update(dir, m.sources()); err != nil || len(changed) != 0 {
+		t.Errorf("second update: changed=%v err=%v", changed, err)
+	}
+
+	if err := Restore(dir, []string{"geosite.dat"}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if !bytes.Equal(readFile(t, filepath.Join(dir, "geosite.dat")), oldSite) {
+		t.Error("restore did not bring back the previous geosite.dat")
+	}
+	if !bytes.Equal(readFile(t, filepath.Join(dir, "geosite.dat.bak")), newSite) {
+		t.Error("restore did not keep the newer geosite.dat as backup")
+	}
+}
+
+func TestUpdateChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	oldSite, oldIP := testGeoSite("old.example"), testGeoIP("198.51.100.0/24")
+	os.WriteFile(filepath.Join(dir, "geosite.dat"), oldSite, 0644)
+	os.WriteFile(filepath.Join(dir, "geoip.dat"), oldIP, 0644)
+
+	m := newMirror(t)
+	m.publish("geosite.dat", testGeoSite("new.example"), "")
+	m.publish("geoip.dat", testGeoIP("192.0.2.0/24"), strings.Repeat("0", 64))
+
+	_, err := Update(dir, m.sources())
+	if err == nil || !strings.Contains(err.Error(), "SHA-256") {
+		t.Fatalf("update error = %v, want a checksum mismatch", err)
+	}
+	// geosite.dat downloaded fine but must not be replaced on its own
+	if !bytes.Equal(readFile(t, filepath.Join(dir, "geosite.dat")), oldSite) {
+		t.Error("geosite.dat replaced although the update failed")
+	}
+	if !bytes.Equal(readFile(t, filepath.Join(dir, "geoip.dat")), oldIP) {
+		t.Error("geoip.dat replaced although its checksum did not match")
+	}
+	if HasBackup(dir, "geosite.dat") || HasBackup(dir, "geoip.dat") {
+		t.Error("failed update left backups")
+	}
+	assertNoStaging(t, dir)
+}
+
+func TestUpdateRejectsUnparsableFile(t *testing.T) {
+	dir := t.TempDir()
+	oldSite := testGeoSite("old.example")
+	os.WriteFile(filepath.Join(dir, "geosite.dat"), oldSite, 0644)
+
+	m := newMirror(t)
+	m.publish("geosite.dat", []byte("not a geosite file"), "")
+
+	if _, err := Update(dir, m.sources()[:1]); err == nil {
+		t.Fatal("update with an unparsable file succeeded")
+	}
+	if !bytes.Equal(readFile(t, filepath.Join(dir, "geosite.dat")), oldSite) {
+		t.Error("geosite.dat replaced by an unparsable file")
+	}
+	assertNoStaging(t, dir)
+}
+
+func TestUpdateDownloadErrors(t *testing.T) {
+	dir := t.TempDir()
+	m := newMirror(t)
+
+	if _, err := Update(dir, m.sources()[:1]); err == nil || !strings.Contains(err.Error(), "校验文件") {
+		t.Errorf("missing checksum file: err = %v", err)
+	}
+
+	m.mu.Lock()
+	m.files["geosite.dat.sha256sum"] = []byte("garbage\n")
+	m.mu.Unlock()
+	if _, err := Update(dir, m.sources()[:1]); err == nil || !strings.Contains(err.Error(), "格式无效") {
+		t.Errorf("invalid checksum file: err = %v", err)
+	}
+
+	if _, err := Update(dir, []UpdateSource{{Name: "geosite.dat", URL: "ftp://example.com/geosite.dat"}}); err == nil {
+		t.Error("non-http download succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "geosite.dat")); !os.IsNotExist(err) {
+		t.Error("failed download created geosite.dat")
+	}
+	assertNoStaging(t, dir)
+}
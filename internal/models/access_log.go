@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxAccessLogRows caps the access log table regardless of the retention period
+const MaxAccessLogRows = 500000
+
+// AccessLog is one connection parsed from the Xray access log
+type AccessLog struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Time        time.Time `json:"time" gorm:"index"`
+	SourceIP    string    `json:"source_ip" gorm:"index"`
+	UserKey     string    `json:"user_key" gorm:"index"` // 用户 StatsKey（Xray 中的 email）
+	Network     string    `json:"network"`               // tcp / udp
+	Destination string    `json:"destination" gorm:"index"`
+	Port        int       `json:"port"`
+	InboundTag  string    `json:"inbound_tag"`
+	OutboundTag string    `json:"outbound_tag"`
+	Accepted    bool      `json:"accepted"`
+}
+
+// AccessLogOptions controls Xray access log output and ingestion
+type AccessLogOptions struct {
+	Enabled       bool
+	Path          string
+	RetentionDays int
+}
+
+// PruneAccessLogs deletes records older than the retention period and keeps
+// at most MaxAccessLogRows of the newest records
+func PruneAccessLogs(db *gorm.DB, retentionDays int) error {
+	if retentionDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -retentionDays)
+		if err := db.Where("time < ?", cutoff).Delete(&AccessLog{}).Error; err != nil {
+			return err
+		}
+	}
+
+	var ids []uint
+	if err := db.Model(&AccessLog{}).Order("id DESC").Offset(MaxAccessLogRows).
+		Limit(1).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Where("id <= ?", ids[0]).Delete(&AccessLog{}).Error
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Announcement is an admin broadcast shown to all users as an informational
+// subscription node while it is within its display window
+type Announcement struct {
+	ID      string    `json:"id" form:"id" gorm:"primaryKey"`
+	Content string    `json:"content" form:"content" gorm:"not null"` // 节点名称中显示的公告文本
+	StartAt time.Time `json:"start_at" form:"start_at" gorm:"index"`  // 零值表示立即生效
+	EndAt   time.Time `json:"end_at" form:"end_at" gorm:"index"`      // 零值表示长期有效
+	Enabled bool      `json:"enabled" form:"enabled" gorm:"default:true"`
+
+	CreatedAt time.Time `json:"created_at" form:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" form:"updated_at"`
+}
+
+// BeforeCreate generates UUID for new announcement
+func (a *Announcement) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// IsActiveAt reports whether the announcement should be shown at time t
+func (a *Announcement) IsActiveAt(t time.Time) bool {
+	if !a.Enabled {
+		return false
+	}
+	if !a.StartAt.IsZero() && t.Before(a.StartAt) {
+		return false
+	}
+	if !a.EndAt.IsZero() && !t.Before(a.EndAt) {
+		return false
+	}
+	return true
+}
+
+// GetActiveAnnouncements returns announcements currently within their display window
+func GetActiveAnnouncements(db *gorm.DB) []Announcement {
+	var all []Announcement
+	if err := db.Where("enabled = ?", true).Order("start_at asc, created_at asc").Find(&all).Error; err != nil {
+		return nil
+	}
+	now := time.Now()
+	active := all[:0]
+	for _, a := range all {
+		if a.IsActiveAt(now) {
+			active = append(active, a)
+		}
+	}
+	return active
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxConfigRevisions is the number of revisions kept; older ones are pruned
+const MaxConfigRevisions = 50
+
+// Revision methods
+const (
+	RevisionApply    = "apply"    // 应用配置（写入并重启）
+	RevisionHot      = "hot"      // 热更新
+	RevisionAuto     = "auto"     // 订阅源自动应用
+	RevisionRollback = "rollback" // 回滚
+)
+
+// ConfigRevision is a snapshot of the files written by one config apply,
+// so a broken change can be rolled back without touching the database
+type ConfigRevision struct {
+	ID         string `json:"id" gorm:"primaryKey"`
+	Method     string `json:"method" gorm:"index"`
+	Admin      string `json:"admin"`
+	DBHash     string `json:"db_hash"` // hash of the config-relevant tables at apply time
+	XrayConfig string `json:"xray_config" gorm:"type:text"`
+	NginxFiles string `json:"nginx_files" gorm:"type:text"` // JSON object: path -> content
+	GeoData    string `json:"-" gorm:"type:text"`           // JSON object: custom .dat name -> content
+	RollbackOf string `json:"rollback_of"`                  // revision restored by a rollback
+
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// BeforeCreate generates UUID for new revision
+func (r *ConfigRevision) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// NginxFileMap decodes the stored nginx files
+func (r ConfigRevision) NginxFileMap() map[string]string {
+	files := make(map[string]string)
+	if r.NginxFiles != "" {
+		json.Unmarshal([]byte(r.NginxFiles), &files)
+	}
+	return files
+}
+
+// GeoDataFiles decodes the stored custom geo data files
+func (r ConfigRevision) GeoDataFiles() map[string][]byte {
+	files := make(map[string][]byte)
+	if r.GeoData != "" {
+		json.Unmarshal([]byte(r.GeoData), &files)
+	}
+	return files
+}
+
+// NginxFileCount returns the number of stored nginx files
+func (r ConfigRevision) NginxFileCount() int {
+	return len(r.NginxFileMap())
+}
+
+// ShortHash returns the abbreviated DB snapshot hash
+func (r ConfigRevision) ShortHash() string {
+	if len(r.DBHash) > 12 {
+		return r.DBHash[:12]
+	}
+	return r.DBHash
+}
+
+// PruneConfigRevisions deletes all but the newest MaxConfigRevisions revisions
+func PruneConfigRevisions(db *gorm.DB) error {
+	var keep []string
+	if err := db.Model(&ConfigRevision{}).Order("created_at DESC").
+		Limit(MaxConfigRevisions).Pluck("id", &keep).Error; err != nil {
+		return err
+	}
+	if len(keep) < MaxConfigRevisions {
+		return nil
+	}
+	return db.Where("id NOT IN ?", keep).Delete(&ConfigRevision{}).Error
+}
+
+// snapshotModels are the tables the generated configs are built from
+var snapshotModels = []interface{}{
+	&User{},
+	&Inbound{},
+	&Outbound{},
+	&RoutingRule{},
+	&Domain{},
+	&SubscriptionSource{},
+	&OutboundGroup{},
+	&DNSServer{},
+	&DNSHost{},
+	&Setting{},
+	&CustomGeoList{},
+	&LocalInbound{},
+	&WireGuardPeer{},
+}
+
+// volatileColumns change during normal operation without affecting the configs
+var volatileColumns = map[string]bool{
+	"updated_at":    true,
+	"traffic_used":  true,
+	"traffic_reset": true,
+	"last_fetch_at": true,
+	"last_error":    true,
+	"node_count":    true,
+	"kicked_until":  true,
+	"traffic_up":    true,
+	"traffic_down":  true,
+}
+
+// SnapshotHash returns a SHA-256 over the config-relevant tables, so two
+// revisions with the same hash were generated from the same database state
+func SnapshotHash(db *gorm.DB) (string, error) {
+	h := sha256.New()
+	for _, model := range snapshotModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return "", err
+		}
+		order := "id"
+		if stmt.Schema.PrioritizedPrimaryField != nil {
+			order = stmt.Schema.PrioritizedPrimaryField.DBName
+		}
+
+		var rows []map[string]interface{}
+		if err := db.Model(model).Order(order).Find(&rows).Error; err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "[%s]\n", stmt.Schema.Table)
+		for _, row := range rows {
+			cols := make([]string, 0, len(row))
+			for col := range row {
+				if !volatileColumns[col] {
+					cols = append(cols, col)
+				}
+			}
+			sort.Strings(cols)
+			for _, col := range cols {
+				fmt.Fprintf(h, "%s=%v\x1f", col, row[col])
+			}
+			h.Write([]byte{'\n'})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CustomGeoType selects the data file a custom list is compiled into
+type CustomGeoType string
+
+const (
+	CustomGeoSite CustomGeoType = "site" // Domain list -> custom.dat
+	CustomGeoIP   CustomGeoType = "ip"   // IP / CIDR list -> customip.dat
+)
+
+// Data files compiled from the custom lists. Xray loads ext: files in the
+// format the rule expects, so domain and IP lists need separate files.
+const (
+	CustomGeoSiteFile = "custom.dat"
+	CustomGeoIPFile   = "customip.dat"
+)
+
+// CustomGeoList is a named list of domains or CIDRs edited in the panel and
+// compiled into a geosite / geoip style data file in the Xray assets path
+// when the config is applied. Rules refer to it as ext:custom.dat:<tag>
+// (domains) or ext:customip.dat:<tag> (IPs).
+type CustomGeoList struct {
+	ID      string        `json:"id" form:"id" gorm:"primaryKey"`
+	Tag     string        `json:"tag" form:"tag" gorm:"uniqueIndex;not null"` // lower case, e.g. my-proxy
+	Type    CustomGeoType `json:"type" form:"type" gorm:"not null;default:site"`
+	Entries string        `json:"entries" form:"entries" gorm:"type:text"` // one rule per line, # starts a comment
+
+	Remark    string    `json:"remark" form:"remark"`
+	CreatedAt time.Time `json:"created_at" form:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" form:"updated_at"`
+}
+
+// BeforeCreate generates UUID for new list
+func (l *CustomGeoList) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == "" {
+		l.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// File returns the data file the list is compiled into
+func (l *CustomGeoList) File() string {
+	if l.Type == CustomGeoIP {
+		return CustomGeoIPFile
+	}
+	return CustomGeoSiteFile
+}
+
+// Reference returns how routing rules refer to the list
+func (l *CustomGeoList) Reference() string {
+	return "ext:" + l.File() + ":" + l.Tag
+}
+
+// EntryLines returns the non-empty entries with comments stripped
+func (l *CustomGeoList) EntryLines() []string {
+	var lines []string
+	for _, line := range strings.Split(l.Entries, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// ReferencedBy returns the routing rules and DNS servers that refer to the
+// list; Xray fails to load the config if the list is removed or renamed
+func (l *CustomGeoList) ReferencedBy(db *gorm.DB) []string {
+	ref := l.Reference()
+	pattern := "%" + ref + "%"
+	var names []string
+
+	var rules []RoutingRule
+	db.Where("domains LIKE ? OR ips LIKE ? OR source_ips LIKE ?", pattern, pattern, pattern).Find(&rules)
+	for _, r := range rules {
+		if containsItem(r.Domains, ref) || containsItem(r.IPs, ref) || containsItem(r.SourceIPs, ref) {
+			names = append(names, "路由规则 "+r.Name)
+		}
+	}
+
+	var servers []DNSServer
+	db.Where("domains LIKE ? OR expect_ips LIKE ?", pattern, pattern).Find(&servers)
+	for _, s := range servers {
+		if containsItem(s.Domains, ref) || containsItem(s.ExpectIPs, ref) {
+			names = append(names, "DNS 服务器 "+s.Address)
+		}
+	}
+	return names
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DNSScope selects the panel mode a DNS entry applies to
+type DNSScope string
+
+const (
+	DNSScopeAll    DNSScope = "all"    // Both server and client mode
+	DNSScopeServer DNSScope = "server" // Server mode only
+	DNSScopeClient DNSScope = "client" // Client mode only
+)
+
+// AppliesTo reports whether the scope includes the given panel mode
+func (s DNSScope) AppliesTo(panelMode string) bool {
+	return s == "" || s == DNSScopeAll || string(s) == panelMode
+}
+
+// DNSServer is an upstream resolver in the Xray "dns.servers" list.
+// Servers are queried in Priority order (lower = first).
+type DNSServer struct {
+	ID    string   `json:"id" form:"id" gorm:"primaryKey"`
+	Scope DNSScope `json:"scope" form:"scope" gorm:"default:all"`
+
+	// Address: 1.1.1.1, tcp://1.1.1.1, https://dns.google/dns-query,
+	// https+local://223.5.5.5/dns-query, quic+local://dns.adguard.com, localhost, fakedns
+	Address string `json:"address" form:"address" gorm:"not null"`
+	Port    int    `json:"port" form:"port"` // 0 = protocol default
+
+	Domains       string `json:"domains" form:"domains"`             // only use this server for these domains (geosite:cn, domain:x.com)
+	ExpectIPs     string `json:"expect_ips" form:"expect_ips"`       // discard answers outside these IPs (geoip:cn)
+	SkipFallback  bool   `json:"skip_fallback" form:"skip_fallback"` // skip this server when falling back
+	ClientIP      string `json:"client_ip" form:"client_ip"`         // EDNS client subnet for this server
+	QueryStrategy string `json:"query_strategy" form:"query_strategy"`
+
+	Priority  int       `json:"priority" form:"priority" gorm:"default:100"`
+	Enabled   bool      `json:"enabled" form:"enabled" gorm:"default:true"`
+	Remark    string    `json:"remark" form:"remark"`
+	CreatedAt time.Time `json:"created_at" form:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" form:"updated_at"`
+}
+
+// BeforeCreate generates UUID for new DNS server
+func (s *DNSServer) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// IsSimple reports whether the server can be written as a plain address string
+func (s *DNSServer) IsSimple() bool {
+	return s.Port == 0 && s.Domains == "" && s.ExpectIPs == "" && !s.SkipFallback &&
+		s.ClientIP == "" && s.QueryStrategy == ""
+}
+
+// DNSHost pins a domain to fixed addresses (Xray "dns.hosts")
+type DNSHost struct {
+	ID    string   `json:"id" form:"id" gorm:"primaryKey"`
+	Scope DNSScope `json:"scope" form:"scope" gorm:"default:all"`
+
+	// Domain: example.com, domain:example.com, geosite:category-ads-all, full:x.com
+	Domain string `json:"domain" form:"domain" gorm:"not null"`
+	// Addresses: comma separated IPs, or a single domain name to alias
+	Addresses string `json:"addresses" form:"addresses" gorm:"not null"`
+
+	Enabled   bool      `json:"enabled" form:"enabled" gorm:"default:true"`
+	Remark    string    `json:"remark" form:"remark"`
+	CreatedAt time.Time `json:"created_at" form:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" form:"updated_at"`
+}
+
+// BeforeCreate generates UUID for new DNS host
+func (h *DNSHost) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == "" {
+		h.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// AddressList returns the pinned addresses
+func (h DNSHost) AddressList() []string {
+	return SplitList(h.Addresses)
+}
+
+// DNSOptions holds the global Xray DNS options
+type DNSOptions struct {
+	QueryStrategy string // UseIP / UseIPv4 / UseIPv6
+	DisableCache  bool
+	ClientIP      string // EDNS client subnet sent to all servers
+}
+
+// FakeDNSOptions configures the client-mode FakeDNS pools. Domains matched by
+// Domains resolve to fake IPs; the sniffer maps them back to the domain so the
+// connection is routed (and resolved remotely) by domain.
+type FakeDNSOptions struct {
+	Enabled      bool
+	IPv4Pool     string // e.g. 198.18.0.0/15
+	IPv4PoolSize int
+	IPv6Pool     string // e.g. fc00::/18, empty = no IPv6 pool
+	IPv6PoolSize int
+	Domains      string // domains answered with fake IPs, comma / newline separated
+}
+
+// ValidQueryStrategy reports whether s is a supported Xray query strategy
+func ValidQueryStrategy(s string) bool {
+	switch s {
+	case "UseIP", "UseIPv4", "UseIPv6":
+		return true
+	}
+	return false
+}
+
+// DefaultDNSServers returns the resolvers the panel used before DNS became
+// configurable: a plain set for server mode and an anti-poisoning split for client mode
+func DefaultDNSServers() []DNSServer {
+	return []DNSServer{
+		{Scope: DNSScopeServer, Address: "1.1.1.1", Priority: 10, Enabled: true},
+		{Scope: DNSScopeServer, Address: "8.8.8.8", Priority: 20, Enabled: true},
+		{Scope: DNSScopeServer, Address: "localhost", Priority: 90, Enabled: true},
+		{
+			Scope:     DNSScopeClient,
+			Address:   "tcp://1.1.1.1",
+			Domains:   "geosite:geolocation-!cn",
+			ExpectIPs: "geoip:!cn",
+			Priority:  10,
+			Enabled:   true,
+			Remark:    "境外域名：tcp 查询经路由走代理，防污染",
+		},
+		{
+			Scope:     DNSScopeClient,
+			Address:   "https+local://223.5.5.5/dns-query",
+			Domains:   "geosite:cn",
+			ExpectIPs: "geoip:cn",
+			Priority:  20,
+			Enabled:   true,
+			Remark:    "国内域名：DoH 直连查询",
+		},
+		{Scope: DNSScopeClient, Address: "localhost", Priority: 90, Enabled: true},
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxGeoDataUpdates is the number of update records kept
+const MaxGeoDataUpdates = 100
+
+// Geo data update results
+const (
+	GeoDataUpdated   = "updated"   // 已下载并替换
+	GeoDataUnchanged = "unchanged" // 与当前文件相同
+	GeoDataFailed    = "failed"    // 下载、校验或重启失败，旧文件保持不变
+	GeoDataRestored  = "restored"  // 手动恢复上一版本
+)
+
+// GeoDataUpdate records one geosite.dat / geoip.dat update attempt
+type GeoDataUpdate struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Trigger   string    `json:"trigger"` // schedule / manual
+	Result    string    `json:"result" gorm:"index"`
+	Files     string    `json:"files"` // replaced files, comma separated
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// GeoDataOptions controls scheduled geo data downloads. An empty checksum URL
+// means "<url>.sha256sum".
+type GeoDataOptions struct {
+	Enabled          bool
+	Interval         time.Duration
+	GeoSiteURL       string
+	GeoSiteSHA256URL string
+	GeoIPURL         string
+	GeoIPSHA256URL   string
+}
+
+// LastGeoDataUpdate returns the most recent update record
+func LastGeoDataUpdate(db *gorm.DB) (GeoDataUpdate, bool) {
+	var update GeoDataUpdate
+	if err := db.Order("id DESC").First(&update).Error; err != nil {
+		return GeoDataUpdate{}, false
+	}
+	return update, true
+}
+
+// PruneGeoDataUpdates deletes all but the newest MaxGeoDataUpdates records
+func PruneGeoDataUpdates(db *gorm.DB) error {
+	var ids []uint
+	if err := db.Model(&GeoDataUpdate{}).Order("id DESC").Offset(MaxGeoDataUpdates).
+		Limit(1).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Where("id <= ?", ids[0]).Delete(&GeoDataUpdate{}).Error
+}
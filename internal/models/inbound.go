@@ -2,6 +2,9 @@ package models
 
 import (
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -64,16 +67,24 @@ type Inbound struct {
 	// CDN connect domain
 	ConnectDomain string `json:"connect_domain" form:"connect_domain"`
 
+	// Additional connect endpoints (CDN preferred IPs / alternate domains), one per line:
+	// address[:port][#remark], e.g. "104.16.1.1:2053#HK" or "[2606:4700::1]:8443"
+	// When set, subscriptions emit one node per endpoint instead of ConnectDomain.
+	ConnectEndpoints string `json:"connect_endpoints" form:"connect_endpoints"`
+
 	// WireGuard specific fields
-	WGSecretKey  string `json:"-" form:"wg_secret_key"`              // 服务端私钥（不暴露到 JSON）
-	WGPublicKey  string `json:"wg_public_key" form:"wg_public_key"`  // 服务端公钥（展示用）
+	WGSecretKey  string `json:"-" form:"wg_secret_key"`                 // 服务端私钥（不暴露到 JSON）
+	WGPublicKey  string `json:"wg_public_key" form:"wg_public_key"`     // 服务端公钥（展示用）
 	WGPeerPubKey string `json:"wg_peer_pub_key" form:"wg_peer_pub_key"` // 对端（出站节点）公钥
-	WGMTU        int    `json:"wg_mtu" form:"wg_mtu"`                // MTU，默认 1420
-	WGLocalIP    string `json:"wg_local_ip" form:"wg_local_ip"`      // 本端 WireGuard 虚拟 IP，如 10.0.0.1/24
+	WGMTU        int    `json:"wg_mtu" form:"wg_mtu"`                   // MTU，默认 1420
+	WGLocalIP    string `json:"wg_local_ip" form:"wg_local_ip"`         // 本端 WireGuard 虚拟 IP，如 10.0.0.1/24
 
 	// 是否排除在订阅链接之外（WireGuard 入站等内部中转节点不应出现在用户订阅中）
 	ExcludeFromSub bool `json:"exclude_from_sub" form:"exclude_from_sub" gorm:"default:false"`
 
+	// 高级 JSON：生成入站对象后再应用的 Merge Patch / JSON Patch
+	AdvancedJSON string `json:"advanced_json" form:"advanced_json"`
+
 	Enabled   bool      `json:"enabled" form:"enabled" gorm:"default:true;index"`
 	UseUDS    bool      `json:"use_uds" form:"use_uds" gorm:"default:true"`
 	Remark    string    `json:"remark" form:"remark"`
@@ -117,3 +128,83 @@ func (i *Inbound) SocketPath(socketDir string) string {
 	}
 	return fmt.Sprintf("%s/xray-%s.sock", socketDir, i.Tag)
 }
+
+// ConnectEndpoint is an address clients use to reach an inbound (via Nginx / CDN)
+type ConnectEndpoint struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Remark  string `json:"remark"`
+}
+
+// Endpoints parses ConnectEndpoints. Invalid lines are skipped; use
+// ParseConnectEndpoints to validate user input.
+func (i *Inbound) Endpoints() []ConnectEndpoint {
+	endpoints, _ := parseConnectEndpoints(i.ConnectEndpoints, false)
+	return endpoints
+}
+
+// ParseConnectEndpoints parses a newline-separated endpoint list.
+// Each line is address[:port][#remark]; port defaults to 443.
+// Blank lines and lines starting with "//" are ignored.
+func ParseConnectEndpoints(s string) ([]ConnectEndpoint, error) {
+	return parseConnectEndpoints(s, true)
+}
+
+func parseConnectEndpoints(s string, strict bool) ([]ConnectEndpoint, error) {
+	var endpoints []ConnectEndpoint
+	remarks := make(map[string]bool)
+	for n, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		ep, err := parseConnectEndpoint(line)
+		if err != nil {
+			if strict {
+				return nil, fmt.Errorf("line %d (%s): %w", n+1, line, err)
+			}
+			continue
+		}
+		// 备注用作节点名称后缀，重复会让客户端里出现同名节点
+		if strict && ep.Remark != "" {
+			if remarks[ep.Remark] {
+				return nil, fmt.Errorf("line %d (%s): duplicate remark %q", n+1, line, ep.Remark)
+			}
+			remarks[ep.Remark] = true
+		}
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints, nil
+}
+
+func parseConnectEndpoint(line string) (ConnectEndpoint, error) {
+	ep := ConnectEndpoint{Port: 443}
+
+	if idx := strings.Index(line, "#"); idx != -1 {
+		ep.Remark = strings.TrimSpace(line[idx+1:])
+		line = strings.TrimSpace(line[:idx])
+	}
+
+	host := line
+	// "[v6]:port", "host:port" or a bare IPv6 address
+	if h, p, err := net.SplitHostPort(line); err == nil {
+		port, err := strconv.Atoi(p)
+		if err != nil || port < 1 || port > 65535 {
+			return ep, fmt.Errorf("invalid port %q", p)
+		}
+		host, ep.Port = h, port
+	} else {
+		host = strings.Trim(host, "[]")
+	}
+
+	if host == "" || strings.ContainsAny(host, " /?@") {
+		return ep, fmt.Errorf("invalid address")
+	}
+	ep.Address = host
+	return ep, nil
+}
+
+// HostPort returns the endpoint in host:port form (IPv6 bracketed)
+func (e ConnectEndpoint) HostPort() string {
+	return net.JoinHostPort(e.Address, strconv.Itoa(e.Port))
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LocalInboundProtocol is the kind of client-mode local listener
+type LocalInboundProtocol string
+
+const (
+	LocalInboundSocks LocalInboundProtocol = "socks" // SOCKS5 proxy
+	LocalInboundHTTP  LocalInboundProtocol = "http"  // HTTP proxy
+	LocalInboundDNS   LocalInboundProtocol = "dns"   // DNS forwarded to Xray's DNS (dokodemo-door -> dns-out)
+)
+
+// LocalInbound is a listener Xray opens in client mode for local or LAN
+// devices. Server mode ignores them.
+type LocalInbound struct {
+	ID       string               `json:"id" form:"id" gorm:"primaryKey"`
+	Tag      string               `json:"tag" form:"tag" gorm:"uniqueIndex;not null"`
+	Protocol LocalInboundProtocol `json:"protocol" form:"protocol" gorm:"not null"`
+	Listen   string               `json:"listen" form:"listen" gorm:"default:127.0.0.1"` // 0.0.0.0 = share with the LAN
+	Port     int                  `json:"port" form:"port" gorm:"not null"`
+
+	// Optional auth (socks / http); empty username = no auth
+	Username string `json:"username" form:"username"`
+	Password string `json:"-" form:"password"`
+
+	// socks: relay UDP; dns: listen on UDP instead of TCP
+	UDP bool `json:"udp" form:"udp"`
+
+	// Sniffing; fakedns is added automatically while FakeDNS is enabled
+	Sniffing             bool   `json:"sniffing" form:"sniffing"`
+	SniffingDestOverride string `json:"sniffing_dest_override" form:"sniffing_dest_override"` // http,tls,quic
+	SniffingRouteOnly    bool   `json:"sniffing_route_only" form:"sniffing_route_only"`
+
+	Enabled   bool      `json:"enabled" form:"enabled" gorm:"default:true"`
+	Remark    string    `json:"remark" form:"remark"`
+	CreatedAt time.Time `json:"created_at" form:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" form:"updated_at"`
+}
+
+// BeforeCreate generates UUID for new local inbound
+func (l *LocalInbound) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == "" {
+		l.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// HasAuth reports whether clients must authenticate
+func (l *LocalInbound) HasAuth() bool {
+	return l.Username != "" && l.Protocol != LocalInboundDNS
+}
+
+// DestOverrideList returns the sniffing protocols
+func (l *LocalInbound) DestOverrideList() []string {
+	return SplitList(l.SniffingDestOverride)
+}
+
+// IsShared reports whether the listener is reachable from other hosts
+func (l *LocalInbound) IsShared() bool {
+	switch strings.TrimSpace(l.Listen) {
+	case "127.0.0.1", "::1", "localhost":
+		return false
+	}
+	return true
+}
+
+// DefaultLocalInbounds returns the listeners client mode used before they
+// became configurable
+func DefaultLocalInbounds() []LocalInbound {
+	return []LocalInbound{
+		{Tag: "dns-in", Protocol: LocalInboundDNS, Listen: "127.0.0.1", Port: 53, UDP: true, Enabled: true},
+		{
+			Tag: "socks-in", Protocol: LocalInboundSocks, Listen: "127.0.0.1", Port: 10808, UDP: true,
+			Sniffing: true, SniffingDestOverride: "http,tls,quic", SniffingRouteOnly: true, Enabled: true,
+		},
+		{
+			Tag: "http-in", Protocol: LocalInboundHTTP, Listen: "127.0.0.1", Port: 10809,
+			Sniffing: true, SniffingDestOverride: "http,tls,quic", SniffingRouteOnly: true, Enabled: true,
+		},
+	}
+}
+
+// TransparentProxyTag is the tag of the TPROXY inbound
+const TransparentProxyTag = "tproxy-in"
+
+// TransparentProxyOptions configures the client-mode LAN gateway. Xray gets a
+// dokodemo-door inbound with TPROXY sockopt; nftables diverts forwarded LAN
+// traffic to it with Mark, and policy routing delivers marked packets locally
+// through RouteTable.
+type TransparentProxyOptions struct {
+	Enabled     bool
+	Port        int
+	Mark        int
+	RouteTable  int
+	BypassCIDRs string // extra destinations that go direct, comma / newline separated
+	BypassCN    bool   // bypass geoip:cn in the firewall
+	IPv6        bool
+}
+
+// BypassCIDRList returns the extra bypass CIDRs
+func (o TransparentProxyOptions) BypassCIDRList() []string {
+	return SplitList(o.BypassCIDRs)
+}
+
+// TunTag is the tag of the TUN inbound
+const TunTag = "tun-in"
+
+// TunOptions configures the client-mode TUN inbound. Xray creates the
+// interface; the panel assigns Address and routes everything into it through
+// RouteTable, except Xray's own connections (marked with Mark), private
+// ranges and the proxy server endpoints.
+type TunOptions struct {
+	Enabled    bool
+	Name       string
+	MTU        int
+	Address    string // CIDRs, comma separated, e.g. 172.19.0.1/30,fdfe:dcba:9876::1/126
+	RouteTable int
+	Mark       int
+}
+
+// AddressList returns the interface addresses
+func (o TunOptions) AddressList() []string {
+	return SplitList(o.Address)
+}
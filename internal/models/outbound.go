@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -67,6 +69,17 @@ type Outbound struct {
 	RealityShortID string `json:"reality_short_id" form:"reality_short_id"`
 	RealitySNI     string `json:"reality_sni" form:"reality_sni"`
 
+	// Outbound chaining: dial this outbound through another outbound (sockopt.dialerProxy),
+	// e.g. WARP -> Trojan relay (链式代理 / 前置代理)
+	DialerProxy string `json:"dialer_proxy" form:"dialer_proxy"`
+
+	// Advanced JSON: merge patch / JSON Patch applied to the generated outbound object
+	AdvancedJSON string `json:"advanced_json" form:"advanced_json"`
+
+	// Subscription source (set for outbounds managed by a SubscriptionSource)
+	SourceID  string `json:"source_id" gorm:"index"`
+	SourceKey string `json:"-"` // identity of the node within its source (type|server|port|credential)
+
 	Enabled   bool      `json:"enabled" form:"enabled" gorm:"default:true"`
 	Priority  int       `json:"priority" form:"priority" gorm:"default:0"` // Higher = preferred
 	Remark    string    `json:"remark" form:"remark"`
@@ -115,7 +128,44 @@ func (o *Outbound) IsVLESS() bool {
 	return o.Type == OutboundVLESS
 }
 
+// IsFromSource returns true if this outbound is managed by a subscription source
+func (o *Outbound) IsFromSource() bool {
+	return o.SourceID != ""
+}
+
 // IsVMess returns true if this is a VMess outbound
 func (o *Outbound) IsVMess() bool {
 	return o.Type == OutboundVMess
 }
+
+// ResolveOutboundChain follows DialerProxy links starting at tag and returns the
+// chain in dial order (tag first, outermost upstream last). It fails on unknown
+// upstreams and on cycles.
+func ResolveOutboundChain(outbounds []Outbound, tag string) ([]Outbound, error) {
+	byTag := make(map[string]Outbound, len(outbounds))
+	for _, o := range outbounds {
+		byTag[o.Tag] = o
+	}
+
+	var chain []Outbound
+	visited := make(map[string]bool)
+	for current := tag; current != ""; {
+		if visited[current] {
+			path := make([]string, 0, len(chain)+1)
+			for _, o := range chain {
+				path = append(path, o.Tag)
+			}
+			path = append(path, current)
+			return nil, fmt.Errorf("链式代理存在循环: %s", strings.Join(path, " -> "))
+		}
+		visited[current] = true
+
+		o, ok := byTag[current]
+		if !ok {
+			return nil, fmt.Errorf("前置代理出站不存在: %s", current)
+		}
+		chain = append(chain, o)
+		current = o.DialerProxy
+	}
+	return chain, nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BalancerStrategy represents the outbound selection strategy of a group
+type BalancerStrategy string
+
+const (
+	BalancerRandom     BalancerStrategy = "random"     // Random member
+	BalancerRoundRobin BalancerStrategy = "roundRobin" // Rotate through members
+	BalancerLeastPing  BalancerStrategy = "leastPing"  // Lowest latency (observatory)
+	BalancerLeastLoad  BalancerStrategy = "leastLoad"  // Most stable latency (burstObservatory)
+)
+
+// OutboundGroup is a named set of outbounds rendered as an Xray routing balancer.
+// Routing rules target the group by setting OutboundTag to the group Tag.
+type OutboundGroup struct {
+	ID       string           `json:"id" form:"id" gorm:"primaryKey"`
+	Tag      string           `json:"tag" form:"tag" gorm:"uniqueIndex;not null"` // balancerTag
+	Strategy BalancerStrategy `json:"strategy" form:"strategy" gorm:"default:random"`
+
+	// Members: comma / newline separated outbound tags.
+	// A subscription source group tag expands to all nodes of that source.
+	Members string `json:"members" form:"members"`
+
+	// FallbackTag is used when no member is healthy (leastPing / leastLoad only)
+	FallbackTag string `json:"fallback_tag" form:"fallback_tag"`
+
+	Enabled   bool      `json:"enabled" form:"enabled" gorm:"default:true"`
+	Remark    string    `json:"remark" form:"remark"`
+	CreatedAt time.Time `json:"created_at" form:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" form:"updated_at"`
+}
+
+// BeforeCreate generates UUID for new outbound group
+func (g *OutboundGroup) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == "" {
+		g.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ValidBalancerStrategy reports whether s is a supported balancer strategy
+func ValidBalancerStrategy(s BalancerStrategy) bool {
+	switch s {
+	case BalancerRandom, BalancerRoundRobin, BalancerLeastPing, BalancerLeastLoad:
+		return true
+	}
+	return false
+}
+
+// UsesObservatory reports whether the strategy needs health probing
+func (g *OutboundGroup) UsesObservatory() bool {
+	return g.Strategy == BalancerLeastPing || g.Strategy == BalancerLeastLoad
+}
+
+// MemberTags returns the configured member tags
+func (g OutboundGroup) MemberTags() []string {
+	return SplitList(g.Members)
+}
+
+// HasMember reports whether tag is listed as a member
+func (g OutboundGroup) HasMember(tag string) bool {
+	return containsItem(g.Members, tag)
+}
+
+// SelectorPrefixConflict returns a balancer member that is a strict prefix of
+// another outbound tag. Xray matches selector entries by prefix, so such a
+// member would also pull in the other outbound. Subscription nodes are tagged
+// "<group tag>-<key>", so a source also claims every tag with that prefix.
+func SelectorPrefixConflict(groups []OutboundGroup, sources []SubscriptionSource, outbounds []Outbound) (member, other string) {
+	nodes := make(map[string][]string, len(sources))
+	groupTag := make(map[string]string, len(sources))
+	for _, src := range sources {
+		nodes[src.GroupTag] = nil
+		groupTag[src.ID] = src.GroupTag
+	}
+	tags := make([]string, 0, len(outbounds)+len(sources))
+	for _, o := range outbounds {
+		tags = append(tags, o.Tag)
+		if gt, ok := groupTag[o.SourceID]; ok && o.SourceID != "" {
+			nodes[gt] = append(nodes[gt], o.Tag)
+		}
+	}
+	for _, src := range sources {
+		tags = append(tags, src.GroupTag+"-")
+	}
+
+	var members []string
+	for _, n := range nodes {
+		members = append(members, n...)
+	}
+	for _, grp := range groups {
+		for _, m := range grp.MemberTags() {
+			if n, ok := nodes[m]; ok {
+				members = append(members, n...)
+			} else {
+				members = append(members, m)
+			}
+		}
+	}
+
+	for _, m := range members {
+		for _, t := range tags {
+			if t != m && strings.HasPrefix(t, m) {
+				return m, strings.TrimSuffix(t, "-")
+			}
+		}
+	}
+	return "", ""
+}
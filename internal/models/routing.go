@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,28 +18,34 @@ const (
 	RuleTypeGeoSite  RuleType = "geosite"  // GeoSite category routing
 	RuleTypeGeoIP    RuleType = "geoip"    // GeoIP country routing
 	RuleTypeProtocol RuleType = "protocol" // Protocol-based (e.g., bittorrent)
+
+	// RuleTypeMulti combines any of the conditions below (AND).
+	// Rules of the single-condition types above are migrated to it on startup.
+	RuleTypeMulti RuleType = "multi"
 )
 
-// RoutingRule represents a routing rule for Xray
-// Each rule matches ONLY ONE type of condition
+// RoutingRule represents a routing rule for Xray.
+// All non-empty conditions must match (AND); values within one condition are
+// alternatives (OR). Domains and GeoSiteTags share Xray's "domain" list, IPs
+// and GeoIPCodes share its "ip" list, so those pairs are OR-ed together.
 type RoutingRule struct {
 	ID   string   `json:"id" form:"id" gorm:"primaryKey"`
 	Name string   `json:"name" form:"name" gorm:"not null"`
-	Type RuleType `json:"type" form:"type" gorm:"not null"`
-
-	// Rule matching value (only one field is used based on Type)
-	// Type=inbound:  InboundTag (single inbound tag)
-	// Type=domain:   Domains (comma-separated domain rules)
-	// Type=ip:       IPs (comma-separated IP/CIDR)
-	// Type=geosite:  GeoSiteTags (comma-separated geosite tags)
-	// Type=geoip:    GeoIPCodes (comma-separated country codes)
-	// Type=protocol: Protocols (comma-separated protocols)
-	InboundTag  string `json:"inbound_tag" form:"inbound_tag"`   // For Type=inbound
-	Domains     string `json:"domains" form:"domains"`           // For Type=domain: domain:example.com, full:www.example.com
-	IPs         string `json:"ips" form:"ips"`                   // For Type=ip: 192.168.0.0/16, 8.8.8.8
-	GeoSiteTags string `json:"geosite_tags" form:"geosite_tags"` // For Type=geosite: category-ads, cn, geolocation-cn
-	GeoIPCodes  string `json:"geoip_codes" form:"geoip_codes"`   // For Type=geoip: cn, us, private
-	Protocols   string `json:"protocols" form:"protocols"`       // For Type=protocol: bittorrent, http, tls
+	Type RuleType `json:"type" form:"type" gorm:"not null;default:multi"`
+
+	// Conditions (comma / newline separated lists unless noted)
+	InboundTag  string `json:"inbound_tag" form:"inbound_tag"`   // inbound tags
+	Domains     string `json:"domains" form:"domains"`           // domain:example.com, full:www.example.com
+	IPs         string `json:"ips" form:"ips"`                   // 192.168.0.0/16, 8.8.8.8
+	GeoSiteTags string `json:"geosite_tags" form:"geosite_tags"` // category-ads, cn, geolocation-cn
+	GeoIPCodes  string `json:"geoip_codes" form:"geoip_codes"`   // cn, us, private
+	Protocols   string `json:"protocols" form:"protocols"`       // bittorrent, http, tls, quic
+	Users       string `json:"users" form:"users"`               // user stats keys (client email)
+	Port        string `json:"port" form:"port"`                 // destination port: 443, 1000-2000, 53,443
+	SourcePort  string `json:"source_port" form:"source_port"`   // source port, same format as Port
+	SourceIPs   string `json:"source_ips" form:"source_ips"`     // source IP / CIDR / geoip:xx
+	Network     string `json:"network" form:"network"`           // tcp, udp or tcp,udp
+	Attrs       string `json:"attrs" form:"attrs"`               // HTTP attributes, one key=value per line (:method=GET)
 
 	// Target outbound
 	OutboundTag string `json:"outbound_tag" form:"outbound_tag" gorm:"not null"` // direct, warp, block, etc.
@@ -60,13 +67,136 @@ func (r *RoutingRule) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// legacyRuleFields lists the only condition field used by each single-condition type
+var legacyRuleFields = map[RuleType]string{
+	RuleTypeInbound:  "inbound_tag",
+	RuleTypeDomain:   "domains",
+	RuleTypeIP:       "ips",
+	RuleTypeGeoSite:  "geosite_tags",
+	RuleTypeGeoIP:    "geoip_codes",
+	RuleTypeProtocol: "protocols",
+}
+
+// Normalize converts a single-condition rule to RuleTypeMulti, dropping values
+// left in the fields its type did not use. Returns whether the rule changed.
+func (r *RoutingRule) Normalize() bool {
+	if r.Type == RuleTypeMulti {
+		return false
+	}
+
+	// Unknown types keep whatever conditions are set
+	if field, ok := legacyRuleFields[r.Type]; ok {
+		keep := func(name, value string) string {
+			if name == field {
+				return value
+			}
+			return ""
+		}
+		r.InboundTag = keep("inbound_tag", r.InboundTag)
+		r.Domains = keep("domains", r.Domains)
+		r.IPs = keep("ips", r.IPs)
+		r.GeoSiteTags = keep("geosite_tags", r.GeoSiteTags)
+		r.GeoIPCodes = keep("geoip_codes", r.GeoIPCodes)
+		r.Protocols = keep("protocols", r.Protocols)
+	}
+	r.Type = RuleTypeMulti
+	return true
+}
+
+// HasCondition reports whether at least one condition is set
+func (r RoutingRule) HasCondition() bool {
+	for _, v := range []string{r.InboundTag, r.Domains, r.IPs, r.GeoSiteTags, r.GeoIPCodes,
+		r.Protocols, r.Users, r.Port, r.SourcePort, r.SourceIPs, r.Network, r.Attrs} {
+		if strings.TrimSpace(v) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCatchAll reports whether the rule sends traffic somewhere other than block
+// without looking at the destination or the user (e.g. inbound-only or
+// port 0-65535 rules). Per-user egress rules are placed before such rules.
+func (r RoutingRule) IsCatchAll() bool {
+	if r.OutboundTag == "block" {
+		return false
+	}
+	for _, v := range []string{r.Domains, r.IPs, r.GeoSiteTags, r.GeoIPCodes, r.Protocols, r.Users, r.Attrs} {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// AttrsMap parses Attrs ("key=value" per line) into a map
+func (r RoutingRule) AttrsMap() map[string]string {
+	attrs := make(map[string]string)
+	for _, line := range strings.Split(r.Attrs, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && strings.TrimSpace(key) != "" {
+			attrs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return attrs
+}
+
+// HasInboundTag reports whether the rule matches inbound tag
+func (r RoutingRule) HasInboundTag(tag string) bool {
+	return containsItem(r.InboundTag, tag)
+}
+
+// HasUser reports whether the rule matches the user stats key
+func (r RoutingRule) HasUser(key string) bool {
+	return containsItem(r.Users, key)
+}
+
+// SplitList splits a comma / newline separated list, dropping empty items
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// containsItem reports whether the comma / newline separated list contains v
+func containsItem(list, v string) bool {
+	for _, item := range SplitList(list) {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateRoutingRules converts single-condition rules to multi-condition rules
+func MigrateRoutingRules(db *gorm.DB) error {
+	var rules []RoutingRule
+	if err := db.Where("type <> ?", RuleTypeMulti).Find(&rules).Error; err != nil {
+		return err
+	}
+	for i := range rules {
+		if rules[i].Normalize() {
+			if err := db.Save(&rules[i]).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // DefaultRoutingRules returns the default basic routing rules
 func DefaultRoutingRules() []RoutingRule {
 	return []RoutingRule{
 		// Block Ads
 		{
 			Name:        "屏蔽广告域名",
-			Type:        RuleTypeGeoSite,
+			Type:        RuleTypeMulti,
 			GeoSiteTags: "category-ads,category-ads-all",
 			OutboundTag: "block",
 			Priority:    10,
@@ -76,7 +206,7 @@ func DefaultRoutingRules() []RoutingRule {
 		// Block BitTorrent
 		{
 			Name:        "屏蔽 BT 协议",
-			Type:        RuleTypeProtocol,
+			Type:        RuleTypeMulti,
 			Protocols:   "bittorrent",
 			OutboundTag: "block",
 			Priority:    20,
@@ -86,7 +216,7 @@ func DefaultRoutingRules() []RoutingRule {
 		// Private/LAN IPs - Direct
 		{
 			Name:        "私有网络直连",
-			Type:        RuleTypeGeoIP,
+			Type:        RuleTypeMulti,
 			GeoIPCodes:  "private",
 			OutboundTag: "direct",
 			Priority:    90,
@@ -103,7 +233,7 @@ func PresetRoutingRules() map[string][]RoutingRule {
 		"warp-china": {
 			{
 				Name:        "中国网站经 WARP",
-				Type:        RuleTypeGeoSite,
+				Type:        RuleTypeMulti,
 				GeoSiteTags: "cn,geolocation-cn",
 				OutboundTag: "warp", // User needs to create a WARP outbound first
 				Priority:    50,
@@ -112,7 +242,7 @@ func PresetRoutingRules() map[string][]RoutingRule {
 			},
 			{
 				Name:        "中国 IP 经 WARP",
-				Type:        RuleTypeGeoIP,
+				Type:        RuleTypeMulti,
 				GeoIPCodes:  "cn",
 				OutboundTag: "warp",
 				Priority:    51,
@@ -123,7 +253,7 @@ func PresetRoutingRules() map[string][]RoutingRule {
 		"warp-streaming": {
 			{
 				Name:        "流媒体经 WARP",
-				Type:        RuleTypeGeoSite,
+				Type:        RuleTypeMulti,
 				GeoSiteTags: "netflix,disney,youtube,spotify,hulu,hbo,primevideo",
 				OutboundTag: "warp",
 				Priority:    60,
@@ -134,7 +264,7 @@ func PresetRoutingRules() map[string][]RoutingRule {
 		"china-direct": {
 			{
 				Name:        "中国网站直连",
-				Type:        RuleTypeGeoSite,
+				Type:        RuleTypeMulti,
 				GeoSiteTags: "cn,geolocation-cn",
 				OutboundTag: "direct",
 				Priority:    50,
@@ -143,7 +273,7 @@ func PresetRoutingRules() map[string][]RoutingRule {
 			},
 			{
 				Name:        "中国 IP 直连",
-				Type:        RuleTypeGeoIP,
+				Type:        RuleTypeMulti,
 				GeoIPCodes:  "cn",
 				OutboundTag: "direct",
 				Priority:    51,
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -27,6 +31,7 @@ func DefaultSettings() []Setting {
 		{Key: "panel_title", Value: "Xray Panel", Type: "string", Remark: "Panel title"},
 		{Key: "panel_mode", Value: "server", Type: "string", Remark: "Panel working mode (server / client)"},
 		{Key: "client_routing_mode", Value: "white", Type: "string", Remark: "Client routing mode (white / black / custom)"},
+		{Key: "client_proxy_group", Value: "", Type: "string", Remark: "Outbound group / subscription group used as the client default proxy (empty = first outbound)"},
 		{Key: "sub_domain", Value: "", Type: "string", Remark: "Subscription domain"},
 		{Key: "sub_path", Value: "/d", Type: "string", Remark: "Subscription URL path prefix"},
 		{Key: "xray_log_level", Value: "warning", Type: "string", Remark: "Xray log level"},
@@ -35,9 +40,49 @@ func DefaultSettings() []Setting {
 		{Key: "default_traffic_limit", Value: "0", Type: "int", Remark: "Default traffic limit (0=unlimited)"},
 		{Key: "default_expire_days", Value: "30", Type: "int", Remark: "Default expiry days for new users"},
 		{Key: "direct_domain_strategy", Value: "UseIPv4", Type: "string", Remark: "Domain strategy for direct outbound"},
+		{Key: "observatory_probe_url", Value: "https://www.google.com/generate_204", Type: "string", Remark: "Probe URL for leastPing / leastLoad balancers"},
+		{Key: "observatory_probe_interval", Value: "1m", Type: "string", Remark: "Probe interval for leastPing / leastLoad balancers"},
+		{Key: "sub_info_nodes", Value: "false", Type: "bool", Remark: "Add remaining traffic / expiry pseudo-nodes to subscriptions"},
+		{Key: "dns_query_strategy", Value: "UseIP", Type: "string", Remark: "Xray DNS query strategy (UseIP / UseIPv4 / UseIPv6)"},
+		{Key: "dns_disable_cache", Value: "false", Type: "bool", Remark: "Disable Xray DNS cache"},
+		{Key: "dns_client_ip", Value: "", Type: "string", Remark: "EDNS client subnet IP sent to DNS servers"},
+		{Key: "fakedns_enabled", Value: "false", Type: "bool", Remark: "Enable FakeDNS in client mode"},
+		{Key: "fakedns_ipv4_pool", Value: "198.18.0.0/15", Type: "string", Remark: "FakeDNS IPv4 pool"},
+		{Key: "fakedns_ipv4_pool_size", Value: "65535", Type: "int", Remark: "FakeDNS IPv4 pool size"},
+		{Key: "fakedns_ipv6_pool", Value: "fc00::/18", Type: "string", Remark: "FakeDNS IPv6 pool (empty = disabled)"},
+		{Key: "fakedns_ipv6_pool_size", Value: "65535", Type: "int", Remark: "FakeDNS IPv6 pool size"},
+		{Key: "xray_config_patch", Value: "", Type: "json", Remark: "Merge patch / JSON Patch applied to the generated Xray config"},
+		{Key: "fakedns_domains", Value: "geosite:geolocation-!cn", Type: "string", Remark: "Domains answered with fake IPs"},
+		{Key: "device_limit_action", Value: "warn", Type: "string", Remark: "Action when a user exceeds its device limit (warn / kick / disable)"},
+		{Key: "device_limit_kick_minutes", Value: "10", Type: "int", Remark: "Minutes a kicked user stays removed from Xray"},
+		{Key: "access_log_enabled", Value: "false", Type: "bool", Remark: "Write and ingest the Xray access log"},
+		{Key: "access_log_path", Value: "/var/log/xray/access.log", Type: "string", Remark: "Xray access log path"},
+		{Key: "access_log_retention_days", Value: "7", Type: "int", Remark: "Days of parsed access log records to keep"},
+		{Key: "geodata_update_enabled", Value: "false", Type: "bool", Remark: "Download geosite.dat / geoip.dat on a schedule"},
+		{Key: "geodata_update_interval_hours", Value: "24", Type: "int", Remark: "Hours between geo data updates"},
+		{Key: "geodata_geosite_url", Value: "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geosite.dat", Type: "string", Remark: "geosite.dat download URL"},
+		{Key: "geodata_geosite_sha256_url", Value: "", Type: "string", Remark: "geosite.dat checksum URL (empty = <url>.sha256sum)"},
+		{Key: "geodata_geoip_url", Value: "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geoip.dat", Type: "string", Remark: "geoip.dat download URL"},
+		{Key: "geodata_geoip_sha256_url", Value: "", Type: "string", Remark: "geoip.dat checksum URL (empty = <url>.sha256sum)"},
+		{Key: "tproxy_enabled", Value: "false", Type: "bool", Remark: "Client mode transparent proxy gateway (TPROXY)"},
+		{Key: "tproxy_port", Value: "12345", Type: "int", Remark: "TPROXY inbound port"},
+		{Key: "tproxy_mark", Value: "1", Type: "int", Remark: "Firewall mark routed to the TPROXY inbound"},
+		{Key: "tproxy_route_table", Value: "100", Type: "int", Remark: "Policy routing table for marked packets"},
+		{Key: "tproxy_bypass_cidrs", Value: "", Type: "string", Remark: "Extra destination CIDRs that bypass the proxy (LAN subnets etc.)"},
+		{Key: "tproxy_bypass_cn", Value: "true", Type: "bool", Remark: "Bypass geoip:cn destinations in the firewall"},
+		{Key: "tproxy_ipv6", Value: "false", Type: "bool", Remark: "Also intercept IPv6 traffic"},
+		{Key: "tun_enabled", Value: "false", Type: "bool", Remark: "Client mode TUN inbound"},
+		{Key: "tun_name", Value: "xray0", Type: "string", Remark: "TUN interface name"},
+		{Key: "tun_mtu", Value: "1500", Type: "int", Remark: "TUN interface MTU"},
+		{Key: "tun_address", Value: "172.19.0.1/30", Type: "string", Remark: "TUN interface addresses (CIDR, comma separated)"},
+		{Key: "tun_route_table", Value: "110", Type: "int", Remark: "Policy routing table sending traffic into the TUN"},
+		{Key: "tun_mark", Value: "255", Type: "int", Remark: "Socket mark of Xray outbounds, excluded from the TUN"},
 	}
 }
 
+// tunNamePattern restricts TUN interface names to what Linux accepts
+var tunNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,15}$`)
+
 // GetPanelMode returns the current panel mode ("server" or "client")
 func GetPanelMode(db *gorm.DB) string {
 	var setting Setting
@@ -62,6 +107,16 @@ func GetClientRoutingMode(db *gorm.DB) string {
 	return "white"
 }
 
+// GetClientProxyGroup returns the group tag picked as the client default
+// proxy, empty when the first outbound is used
+func GetClientProxyGroup(db *gorm.DB) string {
+	var setting Setting
+	if err := db.First(&setting, "key = ?", "client_proxy_group").Error; err != nil {
+		return ""
+	}
+	return setting.Value
+}
+
 // GetDirectDomainStrategy returns the domain strategy for direct outbound
 func GetDirectDomainStrategy(db *gorm.DB) string {
 	var setting Setting
@@ -85,3 +140,249 @@ func GetSubPath(db *gorm.DB) string {
 	}
 	return "/d"
 }
+
+// GetSubInfoNodes returns whether subscriptions include remaining traffic / expiry pseudo-nodes
+func GetSubInfoNodes(db *gorm.DB) bool {
+	var setting Setting
+	if err := db.First(&setting, "key = ?", "sub_info_nodes").Error; err != nil {
+		return false
+	}
+	return setting.Value == "true"
+}
+
+// GetObservatoryProbe returns the balancer health probe URL and interval
+func GetObservatoryProbe(db *gorm.DB) (string, string) {
+	probeURL, interval := "https://www.google.com/generate_204", "1m"
+	var settings []Setting
+	db.Where("key IN ?", []string{"observatory_probe_url", "observatory_probe_interval"}).Find(&settings)
+	for _, s := range settings {
+		if s.Value == "" {
+			continue
+		}
+		if s.Key == "observatory_probe_url" {
+			probeURL = s.Value
+		} else {
+			interval = s.Value
+		}
+	}
+	return probeURL, interval
+}
+
+// GetDNSOptions returns the global Xray DNS options
+func GetDNSOptions(db *gorm.DB) DNSOptions {
+	opts := DNSOptions{QueryStrategy: "UseIP"}
+	var settings []Setting
+	db.Where("key IN ?", []string{"dns_query_strategy", "dns_disable_cache", "dns_client_ip"}).Find(&settings)
+	for _, s := range settings {
+		switch s.Key {
+		case "dns_query_strategy":
+			if ValidQueryStrategy(s.Value) {
+				opts.QueryStrategy = s.Value
+			}
+		case "dns_disable_cache":
+			opts.DisableCache = s.Value == "true"
+		case "dns_client_ip":
+			opts.ClientIP = s.Value
+		}
+	}
+	return opts
+}
+
+// GetFakeDNSOptions returns the client-mode FakeDNS options. Invalid pools
+// fall back to the defaults; an invalid IPv6 pool disables the IPv6 pool.
+func GetFakeDNSOptions(db *gorm.DB) FakeDNSOptions {
+	opts := FakeDNSOptions{
+		IPv4Pool:     "198.18.0.0/15",
+		IPv4PoolSize: 65535,
+		IPv6Pool:     "fc00::/18",
+		IPv6PoolSize: 65535,
+		Domains:      "geosite:geolocation-!cn",
+	}
+	var settings []Setting
+	db.Where("key LIKE ?", "fakedns_%").Find(&settings)
+	for _, s := range settings {
+		value := strings.TrimSpace(s.Value)
+		switch s.Key {
+		case "fakedns_enabled":
+			opts.Enabled = value == "true"
+		case "fakedns_ipv4_pool":
+			if ip, _, err := net.ParseCIDR(value); err == nil && ip.To4() != nil {
+				opts.IPv4Pool = value
+			}
+		case "fakedns_ipv6_pool":
+			if ip, _, err := net.ParseCIDR(value); err == nil && ip.To4() == nil {
+				opts.IPv6Pool = value
+			} else {
+				opts.IPv6Pool = ""
+			}
+		case "fakedns_ipv4_pool_size":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				opts.IPv4PoolSize = n
+			}
+		case "fakedns_ipv6_pool_size":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				opts.IPv6PoolSize = n
+			}
+		case "fakedns_domains":
+			if value != "" {
+				opts.Domains = value
+			}
+		}
+	}
+	return opts
+}
+
+// GetConfigPatch returns the global override applied to the generated Xray config
+func GetConfigPatch(db *gorm.DB) string {
+	var setting Setting
+	if err := db.First(&setting, "key = ?", "xray_config_patch").Error; err != nil {
+		return ""
+	}
+	return setting.Value
+}
+
+// GetDeviceLimitPolicy returns the action taken when a user exceeds its device limit
+func GetDeviceLimitPolicy(db *gorm.DB) DeviceLimitPolicy {
+	policy := DeviceLimitPolicy{Action: DeviceLimitWarn, KickDuration: 10 * time.Minute}
+	var settings []Setting
+	db.Where("key IN ?", []string{"device_limit_action", "device_limit_kick_minutes"}).Find(&settings)
+	for _, s := range settings {
+		value := strings.TrimSpace(s.Value)
+		switch s.Key {
+		case "device_limit_action":
+			if ValidDeviceLimitAction(value) {
+				policy.Action = value
+			}
+		case "device_limit_kick_minutes":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				policy.KickDuration = time.Duration(n) * time.Minute
+			}
+		}
+	}
+	return policy
+}
+
+// GetAccessLogOptions returns the Xray access log options
+func GetAccessLogOptions(db *gorm.DB) AccessLogOptions {
+	opts := AccessLogOptions{Path: "/var/log/xray/access.log", RetentionDays: 7}
+	var settings []Setting
+	db.Where("key LIKE ?", "access_log_%").Find(&settings)
+	for _, s := range settings {
+		value := strings.TrimSpace(s.Value)
+		switch s.Key {
+		case "access_log_enabled":
+			opts.Enabled = value == "true"
+		case "access_log_path":
+			if value != "" {
+				opts.Path = value
+			}
+		case "access_log_retention_days":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				opts.RetentionDays = n
+			}
+		}
+	}
+	return opts
+}
+
+// GetGeoDataOptions returns the scheduled geo data update options
+func GetGeoDataOptions(db *gorm.DB) GeoDataOptions {
+	opts := GeoDataOptions{Interval: 24 * time.Hour}
+	var settings []Setting
+	db.Where("key LIKE ?", "geodata_%").Find(&settings)
+	for _, s := range settings {
+		value := strings.TrimSpace(s.Value)
+		switch s.Key {
+		case "geodata_update_enabled":
+			opts.Enabled = value == "true"
+		case "geodata_update_interval_hours":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				opts.Interval = time.Duration(n) * time.Hour
+			}
+		case "geodata_geosite_url":
+			opts.GeoSiteURL = value
+		case "geodata_geosite_sha256_url":
+			opts.GeoSiteSHA256URL = value
+		case "geodata_geoip_url":
+			opts.GeoIPURL = value
+		case "geodata_geoip_sha256_url":
+			opts.GeoIPSHA256URL = value
+		}
+	}
+	return opts
+}
+
+// GetTransparentProxyOptions returns the client-mode TPROXY gateway options
+func GetTransparentProxyOptions(db *gorm.DB) TransparentProxyOptions {
+	opts := TransparentProxyOptions{Port: 12345, Mark: 1, RouteTable: 100, BypassCN: true}
+	var settings []Setting
+	db.Where("key LIKE ?", "tproxy_%").Find(&settings)
+	for _, s := range settings {
+		value := strings.TrimSpace(s.Value)
+		switch s.Key {
+		case "tproxy_enabled":
+			opts.Enabled = value == "true"
+		case "tproxy_port":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 && n <= 65535 {
+				opts.Port = n
+			}
+		case "tproxy_mark":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				opts.Mark = n
+			}
+		case "tproxy_route_table":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 && n < 253 {
+				opts.RouteTable = n
+			}
+		case "tproxy_bypass_cidrs":
+			opts.BypassCIDRs = value
+		case "tproxy_bypass_cn":
+			opts.BypassCN = value == "true"
+		case "tproxy_ipv6":
+			opts.IPv6 = value == "true"
+		}
+	}
+	return opts
+}
+
+// GetTunOptions returns the client-mode TUN options. Invalid addresses are
+// dropped; without any the default address is used.
+func GetTunOptions(db *gorm.DB) TunOptions {
+	opts := TunOptions{Name: "xray0", MTU: 1500, Address: "172.19.0.1/30", RouteTable: 110, Mark: 255}
+	var settings []Setting
+	db.Where("key LIKE ?", "tun_%").Find(&settings)
+	for _, s := range settings {
+		value := strings.TrimSpace(s.Value)
+		switch s.Key {
+		case "tun_enabled":
+			opts.Enabled = value == "true"
+		case "tun_name":
+			if tunNamePattern.MatchString(value) {
+				opts.Name = value
+			}
+		case "tun_mtu":
+			if n, err := strconv.Atoi(value); err == nil && n >= 576 && n <= 65535 {
+				opts.MTU = n
+			}
+		case "tun_address":
+			var valid []string
+			for _, addr := range SplitList(value) {
+				if _, _, err := net.ParseCIDR(addr); err == nil {
+					valid = append(valid, addr)
+				}
+			}
+			if len(valid) > 0 {
+				opts.Address = strings.Join(valid, ",")
+			}
+		case "tun_route_table":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 && n < 253 {
+				opts.RouteTable = n
+			}
+		case "tun_mark":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				opts.Mark = n
+			}
+		}
+	}
+	return opts
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SubscriptionSource is a remote subscription whose nodes are kept in sync as
+// Outbound rows (Outbound.SourceID). Routing rules reference the source by its
+// stable GroupTag, so refreshes never touch the rules themselves.
+type SubscriptionSource struct {
+	ID       string `json:"id" form:"id" gorm:"primaryKey"`
+	Name     string `json:"name" form:"name" gorm:"not null"`
+	URL      string `json:"url" form:"url" gorm:"not null"`
+	GroupTag string `json:"group_tag" form:"group_tag" gorm:"uniqueIndex;not null"` // 路由规则中引用的稳定分组名
+
+	RefreshInterval int    `json:"refresh_interval" form:"refresh_interval" gorm:"default:360"` // minutes
+	NameFilter      string `json:"name_filter" form:"name_filter"`                              // regexp, keep only matching remarks
+	ExcludeFilter   string `json:"exclude_filter" form:"exclude_filter"`                        // regexp, drop matching remarks (e.g. 剩余流量/到期 信息节点)
+	AutoApply       bool   `json:"auto_apply" form:"auto_apply" gorm:"default:false"`           // apply Xray config after nodes change
+	Enabled         bool   `json:"enabled" form:"enabled" gorm:"default:true"`
+
+	// Last refresh state
+	LastFetchAt time.Time `json:"last_fetch_at"`
+	LastError   string    `json:"last_error"`
+	NodeCount   int       `json:"node_count"`
+
+	Remark    string    `json:"remark" form:"remark"`
+	CreatedAt time.Time `json:"created_at" form:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" form:"updated_at"`
+}
+
+// BeforeCreate generates UUID for new subscription source
+func (s *SubscriptionSource) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// groupTagPattern restricts group tags to characters safe in Xray tags
+var groupTagPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidGroupTag reports whether tag can be used as a routing group tag
+func ValidGroupTag(tag string) bool {
+	switch tag {
+	case "direct", "block", "api", "dns-out":
+		return false
+	}
+	return groupTagPattern.MatchString(tag)
+}
+
+// IsDue reports whether the source should be refreshed at time t
+func (s *SubscriptionSource) IsDue(t time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	if s.LastFetchAt.IsZero() {
+		return true
+	}
+	interval := s.RefreshInterval
+	if interval <= 0 {
+		interval = 360
+	}
+	return t.Sub(s.LastFetchAt) >= time.Duration(interval)*time.Minute
+}
@@ -20,6 +20,9 @@ type User struct {
 	Enabled      bool      `json:"enabled" form:"enabled" gorm:"default:true;index"`
 	SubPath      string    `json:"sub_path" form:"sub_path" gorm:"uniqueIndex"`
 	Note         string    `json:"note" form:"note"`
+	EgressTag    string    `json:"egress_tag" form:"egress_tag"`     // 默认出口：出站 / 订阅分组 / 出站组标签，空表示跟随路由规则
+	DeviceLimit  int       `json:"device_limit" form:"device_limit"` // 同时在线 IP 上限，0 表示不限制
+	KickedUntil  time.Time `json:"kicked_until" form:"-"`            // 超出设备数被临时踢下线的截止时间
 	CreatedAt    time.Time `json:"created_at" form:"created_at" gorm:"index"`
 	UpdatedAt    time.Time `json:"updated_at" form:"updated_at"`
 }
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// Device limit actions
+const (
+	DeviceLimitWarn    = "warn"    // 仅记录警告
+	DeviceLimitKick    = "kick"    // 临时从 Xray 移除用户
+	DeviceLimitDisable = "disable" // 禁用用户
+)
+
+// UserOnlineIP is a source IP seen online for a user in the latest sync
+type UserOnlineIP struct {
+	UserID   string    `json:"user_id" gorm:"primaryKey"`
+	IP       string    `json:"ip" gorm:"primaryKey"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// DeviceLimitPolicy controls what happens when a user exceeds DeviceLimit
+type DeviceLimitPolicy struct {
+	Action       string
+	KickDuration time.Duration
+}
+
+// ValidDeviceLimitAction reports whether action is a known device limit action
+func ValidDeviceLimitAction(action string) bool {
+	switch action {
+	case DeviceLimitWarn, DeviceLimitKick, DeviceLimitDisable:
+		return true
+	}
+	return false
+}
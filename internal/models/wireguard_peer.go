@@ -0,0 +1,200 @@
+package models
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WireGuardPeer is a client of a WireGuard inbound: a panel user's device or
+// a named relay node. The panel keeps the private key so it can hand out the
+// complete client config.
+type WireGuardPeer struct {
+	ID        string `json:"id" form:"id" gorm:"primaryKey"`
+	InboundID string `json:"inbound_id" form:"inbound_id" gorm:"not null;uniqueIndex:idx_wg_peer_inbound_address,priority:1"`
+	UserID    string `json:"user_id" form:"user_id" gorm:"index"` // 空表示中转节点
+	User      *User  `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Name      string `json:"name" form:"name" gorm:"not null"`      // 用户名或节点名
+	Email     string `json:"email" form:"email" gorm:"uniqueIndex"` // 流量统计标识：<name>@<inbound tag>
+
+	PrivateKey   string `json:"-" form:"-"`
+	PublicKey    string `json:"public_key" form:"-" gorm:"not null"`
+	PresharedKey string `json:"-" form:"-"`
+	Address      string `json:"address" form:"-" gorm:"not null;uniqueIndex:idx_wg_peer_inbound_address,priority:2"` // 隧道地址，如 10.0.0.2/32
+
+	Enabled     bool      `json:"enabled" form:"enabled" gorm:"default:true"`
+	TrafficUp   int64     `json:"traffic_up" form:"-"`
+	TrafficDown int64     `json:"traffic_down" form:"-"`
+	Remark      string    `json:"remark" form:"remark"`
+	CreatedAt   time.Time `json:"created_at" form:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" form:"updated_at"`
+}
+
+// BeforeCreate generates UUID for new peer
+func (p *WireGuardPeer) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// StatsTag is the tag of the loopback outbound the peer's traffic passes,
+// its outbound stats are the peer's traffic
+func (p *WireGuardPeer) StatsTag() string {
+	return "wg-peer:" + p.Email
+}
+
+// IsRelay reports whether the peer is a relay node rather than a user
+func (p *WireGuardPeer) IsRelay() bool {
+	return p.UserID == ""
+}
+
+// TunnelIP returns the peer address without the prefix length
+func (p *WireGuardPeer) TunnelIP() string {
+	if prefix, err := netip.ParsePrefix(p.Address); err == nil {
+		return prefix.Addr().String()
+	}
+	return p.Address
+}
+
+// ClientConfig renders the wg-quick config of the peer
+func (p *WireGuardPeer) ClientConfig(inbound Inbound, serverPublicKey, endpoint string) string {
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "PrivateKey = %s\n", p.PrivateKey)
+	fmt.Fprintf(&b, "Address = %s\n", p.Address)
+	b.WriteString("DNS = 1.1.1.1\n")
+	if inbound.WGMTU > 0 {
+		fmt.Fprintf(&b, "MTU = %d\n", inbound.WGMTU)
+	}
+	b.WriteString("\n[Peer]\n")
+	fmt.Fprintf(&b, "PublicKey = %s\n", serverPublicKey)
+	if p.PresharedKey != "" {
+		fmt.Fprintf(&b, "PresharedKey = %s\n", p.PresharedKey)
+	}
+	fmt.Fprintf(&b, "Endpoint = %s\n", endpoint)
+	b.WriteString("AllowedIPs = 0.0.0.0/0, ::/0\n")
+	b.WriteString("PersistentKeepalive = 25\n")
+	return b.String()
+}
+
+// WGSubnet returns the tunnel subnet of a WireGuard inbound and the server's
+// own address in it. A host address (or no prefix) means the /24 (IPv4) or
+// /64 (IPv6) around it.
+func (i *Inbound) WGSubnet() (netip.Prefix, netip.Addr, error) {
+	localIP := strings.TrimSpace(i.WGLocalIP)
+	if localIP == "" {
+		localIP = "10.0.0.1"
+	}
+	if !strings.Contains(localIP, "/") {
+		localIP += "/32"
+		if strings.Contains(localIP, ":") {
+			localIP = strings.TrimSuffix(localIP, "/32") + "/128"
+		}
+	}
+	prefix, err := netip.ParsePrefix(localIP)
+	if err != nil {
+		return netip.Prefix{}, netip.Addr{}, fmt.Errorf("无效的本端虚拟 IP: %s", i.WGLocalIP)
+	}
+	server := prefix.Addr().Unmap()
+	bits := prefix.Bits()
+	if server.Is4() && bits > 30 {
+		bits = 24
+	} else if server.Is6() && bits > 126 {
+		bits = 64
+	}
+	subnet, _ := server.Prefix(bits)
+	return subnet, server, nil
+}
+
+// AllocateWGPeerAddress returns the first free host address of the inbound's
+// tunnel subnet, skipping the network, broadcast and server addresses
+func AllocateWGPeerAddress(db *gorm.DB, inbound Inbound) (string, error) {
+	subnet, server, err := inbound.WGSubnet()
+	if err != nil {
+		return "", err
+	}
+
+	var peers []WireGuardPeer
+	db.Select("address").Where("inbound_id = ?", inbound.ID).Find(&peers)
+	used := map[netip.Addr]bool{server: true}
+	// 旧版单对端的客户端配置使用本端 IP + 1
+	if inbound.WGPeerPubKey != "" {
+		used[server.Next()] = true
+	}
+	for _, p := range peers {
+		if prefix, err := netip.ParsePrefix(p.Address); err == nil {
+			used[prefix.Addr()] = true
+		}
+	}
+
+	hostBits := server.BitLen()
+	for addr, n := subnet.Addr().Next(), 0; subnet.Contains(addr) && n < 65536; addr, n = addr.Next(), n+1 {
+		// IPv4 广播地址不可用
+		if addr.Is4() && !subnet.Contains(addr.Next()) {
+			break
+		}
+		if !used[addr] {
+			return netip.PrefixFrom(addr, hostBits).String(), nil
+		}
+	}
+	return "", fmt.Errorf("子网 %s 已无可用地址", subnet)
+}
+
+// CreateWGPeer allocates the next free tunnel address and creates the peer in
+// one transaction. Two concurrent requests may pick the same address; the
+// loser hits the (inbound_id, address) unique index and retries.
+func CreateWGPeer(db *gorm.DB, inbound Inbound, peer *WireGuardPeer) error {
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			address, err := AllocateWGPeerAddress(tx, inbound)
+			if err != nil {
+				return err
+			}
+			peer.Address = address
+			return tx.Create(peer).Error
+		})
+		if err == nil || !isUniqueViolation(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// DedupeWGPeerAddresses moves peers sharing a tunnel address to a free one,
+// so the (inbound_id, address) unique index can be created on upgrade
+func DedupeWGPeerAddresses(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&WireGuardPeer{}) {
+		return nil
+	}
+	var dups []WireGuardPeer
+	if err := db.Raw(`SELECT * FROM wire_guard_peers p WHERE EXISTS (
+		SELECT 1 FROM wire_guard_peers q WHERE q.inbound_id = p.inbound_id AND q.address = p.address
+		AND (q.created_at < p.created_at OR (q.created_at = p.created_at AND q.id < p.id)))`).Scan(&dups).Error; err != nil {
+		return err
+	}
+	for _, p := range dups {
+		var inbound Inbound
+		if err := db.First(&inbound, "id = ?", p.InboundID).Error; err != nil {
+			continue
+		}
+		address, err := AllocateWGPeerAddress(db, inbound)
+		if err != nil {
+			return fmt.Errorf("wireguard peer %s: %w", p.Email, err)
+		}
+		if err := db.Model(&WireGuardPeer{}).Where("id = ?", p.ID).Update("address", address).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,11 +5,12 @@ import (
 	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"xray-panel/internal/config"
 	"xray-panel/internal/models"
+	"xray-panel/internal/service"
 
 	"gorm.io/gorm"
 )
@@ -22,7 +23,7 @@ const (
 type ConfigGenerator struct {
 	configDir string
 	streamDir string
-	reloadCmd string
+	service   service.Manager
 	db        *gorm.DB
 	socketDir string
 }
@@ -32,7 +33,6 @@ func NewGenerator(configDir, streamDir string) *ConfigGenerator {
 	return &ConfigGenerator{
 		configDir: configDir,
 		streamDir: streamDir,
-		reloadCmd: "systemctl reload nginx",
 		socketDir: "/dev/shm",
 	}
 }
@@ -42,9 +42,9 @@ func (g *ConfigGenerator) SetDB(db *gorm.DB) {
 	g.db = db
 }
 
-// SetReloadCmd sets custom reload command
-func (g *ConfigGenerator) SetReloadCmd(cmd string) {
-	g.reloadCmd = cmd
+// SetService sets the service manager used to reload Nginx
+func (g *ConfigGenerator) SetService(m service.Manager) {
+	g.service = m
 }
 
 // SetSocketDir sets the Unix Domain Socket directory
@@ -56,12 +56,12 @@ func (g *ConfigGenerator) SetSocketDir(dir string) {
 
 // Reload reloads Nginx configuration
 func (g *ConfigGenerator) Reload() error {
-	parts := strings.Fields(g.reloadCmd)
-	if len(parts) == 0 {
-		return fmt.Errorf("empty reload command")
+	m := g.service
+	if m == nil {
+		m, _ = service.New(config.ServiceConfig{}, "nginx")
 	}
-	cmd := exec.Command(parts[0], parts[1:]...)
-	return cmd.Run()
+	_, err := m.Reload()
+	return err
 }
 
 // recordConfig records a generated Nginx config in database
@@ -274,3 +274,72 @@ func (g *ConfigGenerator) buildServerBlock(domain string, inbounds []models.Inbo
 
 	return buf.String()
 }
+
+// ManagedFiles returns the content of every panel-managed config file in the
+// HTTP and stream config directories, keyed by path
+func (g *ConfigGenerator) ManagedFiles() (map[string]string, error) {
+	files := make(map[string]string)
+	for _, dir := range []string{g.configDir, g.streamDir} {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !g.isManagedFile(path) {
+				continue
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			files[path] = string(content)
+		}
+	}
+	return files, nil
+}
+
+// RestoreManagedFiles replaces the managed config files with a snapshot taken
+// by ManagedFiles: managed files missing from the snapshot are removed
+func (g *ConfigGenerator) RestoreManagedFiles(files map[string]string) error {
+	for path, content := range files {
+		dir := filepath.Dir(path)
+		if dir != filepath.Clean(g.configDir) && dir != filepath.Clean(g.streamDir) {
+			return fmt.Errorf("refusing to restore %s outside the nginx config directories", path)
+		}
+		if !strings.HasPrefix(content, ManagedHeader) {
+			return fmt.Errorf("refusing to restore %s: missing managed header", path)
+		}
+		// Never overwrite a file the admin manages by hand
+		if _, err := os.Stat(path); err == nil && !g.isManagedFile(path) {
+			return fmt.Errorf("file %s exists and is not managed by Xray Panel", path)
+		}
+	}
+
+	current, err := g.ManagedFiles()
+	if err != nil {
+		return err
+	}
+	for path := range current {
+		if _, ok := files[path]; !ok {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"xray-panel/internal/config"
+	"xray-panel/internal/logger"
+)
+
+// Supported service managers
+const (
+	ManagerSystemd     = "systemd"
+	ManagerOpenRC      = "openrc"
+	ManagerSupervisord = "supervisord"
+	ManagerDocker      = "docker"
+	ManagerNone        = "none" // 不执行任何命令，只记录日志（dry-run）
+)
+
+// Manager controls one system service (xray or nginx). Every method returns
+// the captured command output.
+type Manager interface {
+	Start() (string, error)
+	Stop() (string, error)
+	Restart() (string, error)
+	Reload() (string, error)
+	Status() (Status, error)
+	String() string
+}
+
+// Status is the state reported by a service manager
+type Status struct {
+	Active bool   `json:"active"`
+	State  string `json:"state"`
+	Output string `json:"output,omitempty"`
+}
+
+// New returns the manager configured for a service. defaultName is used
+// when the config does not name the service / program / container.
+func New(cfg config.ServiceConfig, defaultName string) (Manager, error) {
+	name := cfg.Name
+	if name == "" {
+		name = defaultName
+	}
+
+	m := &commandManager{kind: cfg.Manager, name: name}
+	switch cfg.Manager {
+	case "", ManagerSystemd:
+		m.kind = ManagerSystemd
+		m.action = func(action string) []string { return []string{"systemctl", action, name} }
+		m.status = []string{"systemctl", "is-active", name}
+		m.active = func(out string) bool { return out == "active" }
+	case ManagerOpenRC:
+		m.action = func(action string) []string { return []string{"rc-service", name, action} }
+		m.status = []string{"rc-service", name, "status"}
+		m.active = func(out string) bool { return strings.Contains(out, "started") }
+	case ManagerSupervisord:
+		m.action = func(action string) []string {
+			if action == "reload" {
+				return []string{"supervisorctl", "signal", "HUP", name}
+			}
+			return []string{"supervisorctl", action, name}
+		}
+		m.status = []string{"supervisorctl", "status", name}
+		m.active = func(out string) bool { return strings.Contains(out, "RUNNING") }
+	case ManagerDocker:
+		m.action = func(action string) []string {
+			if action == "reload" {
+				return []string{"docker", "kill", "--signal", "HUP", name}
+			}
+			return []string{"docker", action, name}
+		}
+		m.status = []string{"docker", "inspect", "-f", "{{.State.Status}}", name}
+		m.active = func(out string) bool { return out == "running" }
+	case ManagerNone:
+		m.action = func(action string) []string { return []string{action, name} }
+	default:
+		return nil, fmt.Errorf("unknown service manager %q", cfg.Manager)
+	}
+
+	if cmd := strings.TrimSpace(cfg.ReloadCmd); cmd != "" {
+		// 自定义重载命令通过 shell 执行，与旧版 nginx.reload_cmd 行为一致
+		m.reload = []string{"sh", "-c", cmd}
+		if m.kind == ManagerDocker {
+			// docker 下在容器内执行
+			m.reload = append([]string{"docker", "exec", name}, m.reload...)
+		}
+	}
+	return m, nil
+}
+
+// commandManager controls a service through its manager's CLI
+type commandManager struct {
+	kind   string
+	name   string
+	action func(action string) []string
+	reload []string // custom reload command, overrides action("reload")
+	status []string
+	active func(out string) bool
+}
+
+func (m *commandManager) Start() (string, error)   { return m.run(m.action("start")) }
+func (m *commandManager) Stop() (string, error)    { return m.run(m.action("stop")) }
+func (m *commandManager) Restart() (string, error) { return m.run(m.action("restart")) }
+
+func (m *commandManager) Reload() (string, error) {
+	if len(m.reload) > 0 {
+		return m.run(m.reload)
+	}
+	return m.run(m.action("reload"))
+}
+
+func (m *commandManager) Status() (Status, error) {
+	if m.kind == ManagerNone {
+		return Status{State: "unmanaged"}, nil
+	}
+	out, err := m.run(m.status)
+	state := strings.TrimSpace(out)
+	if i := strings.IndexByte(state, '\n'); i >= 0 {
+		state = state[:i]
+	}
+	// is-active / status exit non-zero for stopped services, which is not an error
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		err = nil
+	}
+	return Status{Active: m.active(strings.TrimSpace(out)), State: state, Output: out}, err
+}
+
+func (m *commandManager) String() string {
+	return m.kind + ":" + m.name
+}
+
+// run executes a manager command and captures its combined output
+func (m *commandManager) run(args []string) (string, error) {
+	if m.kind == ManagerNone {
+		logger.Info("Service %s: dry-run %s", m.name, strings.Join(args, " "))
+		return "", nil
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	output := out.String()
+	if err != nil {
+		return output, fmt.Errorf("%s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(output))
+	}
+	logger.Debug("Service %s: %s", m.name, strings.Join(args, " "))
+	return output, nil
+}
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffEdits bounds the Myers search; beyond it the texts are reported as
+// fully replaced, which keeps memory bounded for unrelated inputs
+const maxDiffEdits = 2000
+
+// diffLine is one line of an edit script: ' ' (kept), '-' (removed) or '+' (added)
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// UnifiedDiff returns a unified diff of two texts with the given number of
+// context lines, or "" when they are identical
+func UnifiedDiff(a, b, fromName, toName string, context int) string {
+	if a == b {
+		return ""
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	// Group changes into hunks, merging those separated by at most 2*context kept lines
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		stop := end + context + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		aStart, bStart := 1, 1
+		for _, l := range lines[:start] {
+			if l.kind != '+' {
+				aStart++
+			}
+			if l.kind != '-' {
+				bStart++
+			}
+		}
+		aLen, bLen := 0, 0
+		for _, l := range lines[start:stop] {
+			if l.kind != '+' {
+				aLen++
+			}
+			if l.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+		for _, l := range lines[start:stop] {
+			sb.WriteByte(l.kind)
+			sb.WriteString(l.text)
+			sb.WriteByte('\n')
+		}
+		i = stop
+	}
+	return sb.String()
+}
+
+// splitLines splits text into lines without the trailing newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script between a and b (Myers)
+func diffLines(a, b []string) []diffLine {
+	// Common prefix and suffix never need the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var out []diffLine
+	for _, l := range a[:prefix] {
+		out = append(out, diffLine{' ', l})
+	}
+	out = append(out, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		out = append(out, diffLine{' ', l})
+	}
+	return out
+}
+
+// myers runs the Myers O(ND) algorithm, keeping only the window of V that
+// backtracking needs for each d
+func myers(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= max && d <= maxDiffEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	if !found {
+		out := make([]diffLine, 0, n+m)
+		for _, l := range a {
+			out = append(out, diffLine{'-', l})
+		}
+		for _, l := range b {
+			out = append(out, diffLine{'+', l})
+		}
+		return out
+	}
+
+	// Backtrack from (n, m), collecting the script in reverse
+	var rev []diffLine
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		window := trace[d]
+		at := func(k int) int { return window[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			rev = append(rev, diffLine{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, diffLine{'+', b[y-1]})
+			} else {
+				rev = append(rev, diffLine{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	out := make([]diffLine, len(rev))
+	for i, l := range rev {
+		out[len(rev)-1-i] = l
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxSubscriptionSize limits how much of a remote subscription is read (10 MB)
+const maxSubscriptionSize = 10 << 20
+
+// FetchSubscription downloads a remote subscription body
+func FetchSubscription(subURL string) ([]byte, error) {
+	if !strings.HasPrefix(subURL, "http://") && !strings.HasPrefix(subURL, "https://") {
+		return nil, fmt.Errorf("订阅地址必须以 http:// 或 https:// 开头")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, subURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("订阅地址无效: %v", err)
+	}
+	// 部分机场按 UA 返回不同格式，使用通用 UA 以获取 base64 分享链接
+	req.Header.Set("User-Agent", "v2rayN/6.0")
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("下载订阅失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载订阅失败: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSubscriptionSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取订阅失败: %v", err)
+	}
+	if len(data) > maxSubscriptionSize {
+		return nil, fmt.Errorf("订阅内容过大 (超过 %d MB)", maxSubscriptionSize>>20)
+	}
+	return data, nil
+}
+
+// DecodeSubscription splits subscription content into share links.
+// The content may be plain text (one link per line) or base64 encoded.
+func DecodeSubscription(data []byte) []string {
+	content := strings.TrimSpace(string(data))
+	if !strings.Contains(content, "://") {
+		if decoded, ok := decodeBase64(content); ok {
+			content = decoded
+		}
+	}
+
+	var links []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || !strings.Contains(line, "://") {
+			continue
+		}
+		links = append(links, line)
+	}
+	return links
+}
+
+// decodeBase64 tries standard and URL-safe base64, with or without padding
+func decodeBase64(s string) (string, bool) {
+	s = strings.Join(strings.Fields(s), "")
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding,
+		base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		if decoded, err := enc.DecodeString(s); err == nil {
+			return string(decoded), true
+		}
+	}
+	return "", false
+}
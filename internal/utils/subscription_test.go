@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xray-panel/internal/models"
+)
+
+func TestDecodeSubscription(t *testing.T) {
+	links := "vless://a@h1:443#A\r\n\ntrojan://p@h2:443#B\n"
+	want := []string{"vless://a@h1:443#A", "trojan://p@h2:443#B"}
+
+	for name, data := range map[string]string{
+		"plain":     links,
+		"base64":    base64.StdEncoding.EncodeToString([]byte(links)),
+		"raw url":   base64.RawURLEncoding.EncodeToString([]byte(links)),
+		"wrapped64": strings.Join(splitEvery(base64.StdEncoding.EncodeToString([]byte(links)), 16), "\n"),
+	} {
+		got := DecodeSubscription([]byte(data))
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func splitEvery(s string, n int) []string {
+	var parts []string
+	for len(s) > n {
+		parts, s = append(parts, s[:n]), s[n:]
+	}
+	return append(parts, s)
+}
+
+func TestParseShareLink(t *testing.T) {
+	o, err := ParseShareLink("vless://uuid-1@example.com:8443?type=xhttp&security=tls&sni=sni.example.com&alpn=h2&path=%2Fx&flow=xtls-rprx-vision#Node%20A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Type != models.OutboundVLESS || o.Server != "example.com" || o.Port != 8443 || o.UUID != "uuid-1" ||
+		o.Network != "xhttp" || !o.TLS || o.TLSServerName != "sni.example.com" || o.TLSALPN != "h2" ||
+		o.Path != "/x" || o.Flow != "xtls-rprx-vision" || o.Remark != "Node A" || o.Security != "none" {
+		t.Errorf("vless parsed as %+v", o)
+	}
+
+	vmess := base64.StdEncoding.EncodeToString([]byte(`{"v":"2","ps":"VM","add":"vm.example.com","port":"443","id":"uuid-2","net":"ws","host":"h.example.com","path":"/vm","tls":"tls"}`))
+	o, err = ParseShareLink("vmess://" + vmess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Type != models.OutboundVMess || o.Port != 443 || o.Security != "auto" || o.RequestHost != "h.example.com" || !o.TLS {
+		t.Errorf("vmess parsed as %+v", o)
+	}
+
+	if _, err := ParseShareLink("ss://x@y:1"); err == nil {
+		t.Error("ss:// should be rejected")
+	}
+}
+
+func TestFetchSubscription(t *testing.T) {
+	var ua string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.UserAgent()
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte("vless://a@h:1#A"))
+		case "/big":
+			w.Write(make([]byte, maxSubscriptionSize+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	data, err := FetchSubscription(srv.URL + "/ok")
+	if err != nil || string(data) != "vless://a@h:1#A" {
+		t.Errorf("fetch = %q, %v", data, err)
+	}
+	if ua != "v2rayN/6.0" {
+		t.Errorf("User-Agent = %q", ua)
+	}
+	if _, err := FetchSubscription(srv.URL + "/missing"); err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("404: %v", err)
+	}
+	if _, err := FetchSubscription(srv.URL + "/big"); err == nil {
+		t.Error("oversized subscription should be rejected")
+	}
+	if _, err := FetchSubscription("ftp://example.com/sub"); err == nil {
+		t.Error("non-http scheme should be rejected")
+	}
+}
@@ -12,11 +12,13 @@ import (
 	"strings"
 	"time"
 
+	"xray-panel/internal/geodata"
 	"xray-panel/internal/logger"
 	"xray-panel/internal/models"
 	"xray-panel/internal/nginx"
 	"xray-panel/internal/system"
 	"xray-panel/internal/utils"
+	"xray-panel/internal/xray"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -26,12 +28,37 @@ import (
 type Handler struct {
 	db    *gorm.DB
 	nginx *nginx.ConfigGenerator
+
+	// validateConfig runs `xray -test` on the config with a pending inbound
+	// or outbound in place; nil skips the check
+	validateConfig func(inbound *models.Inbound, outbound *models.Outbound) error
 }
 
 func NewHandler(db *gorm.DB, nginxGen *nginx.ConfigGenerator) *Handler {
 	return &Handler{db: db, nginx: nginxGen}
 }
 
+// SetConfigValidator sets the check run before saving advanced JSON
+func (h *Handler) SetConfigValidator(fn func(inbound *models.Inbound, outbound *models.Outbound) error) {
+	h.validateConfig = fn
+}
+
+// checkAdvancedJSON validates the full config when the pending inbound or
+// outbound carries advanced JSON; returns the error message or ""
+func (h *Handler) checkAdvancedJSON(inbound *models.Inbound, outbound *models.Outbound) string {
+	if h.validateConfig == nil {
+		return ""
+	}
+	if (inbound == nil || strings.TrimSpace(inbound.AdvancedJSON) == "") &&
+		(outbound == nil || strings.TrimSpace(outbound.AdvancedJSON) == "") {
+		return ""
+	}
+	if err := h.validateConfig(inbound, outbound); err != nil {
+		return "高级 JSON 导致配置校验失败: " + err.Error()
+	}
+	return ""
+}
+
 // ============ Page Handlers ============
 
 func (h *Handler) LoginPage(c *gin.Context) {
@@ -52,6 +79,7 @@ func (h *Handler) renderPage(c *gin.Context, template string, data gin.H) {
 	data["ClientRoutingMode"] = models.GetClientRoutingMode(h.db)
 	data["DirectDomainStrategy"] = models.GetDirectDomainStrategy(h.db)
 	data["SubPath"] = models.GetSubPath(h.db)
+	data["SubInfoNodes"] = models.GetSubInfoNodes(h.db)
 
 	c.HTML(http.StatusOK, template, data)
 }
@@ -72,8 +100,11 @@ func (h *Handler) UsersPage(c *gin.Context) {
 
 func (h *Handler) InboundsPage(c *gin.Context) {
 	h.renderPage(c, "inbounds", gin.H{
-		"Title": "Inbounds",
-		"Page":  "inbounds",
+		"Title":     "Inbounds",
+		"Page":      "inbounds",
+		"PanelMode": models.GetPanelMode(h.db),
+		"TProxy":    models.GetTransparentProxyOptions(h.db),
+		"Tun":       models.GetTunOptions(h.db),
 	})
 }
 
@@ -98,11 +129,63 @@ func (h *Handler) DomainsPage(c *gin.Context) {
 	})
 }
 
+func (h *Handler) DNSPage(c *gin.Context) {
+	h.renderPage(c, "dns", gin.H{
+		"Title":      "DNS",
+		"Page":       "dns",
+		"DNSOptions": models.GetDNSOptions(h.db),
+		"FakeDNS":    models.GetFakeDNSOptions(h.db),
+	})
+}
+
 func (h *Handler) SettingsPage(c *gin.Context) {
+	deviceLimit := models.GetDeviceLimitPolicy(h.db)
+	geoData := models.GetGeoDataOptions(h.db)
+	var proxyGroups []string
+	h.db.Model(&models.OutboundGroup{}).Order("tag").Pluck("tag", &proxyGroups)
+	var sourceGroups []string
+	h.db.Model(&models.SubscriptionSource{}).Order("group_tag").Pluck("group_tag", &sourceGroups)
 	h.renderPage(c, "settings", gin.H{
-		"Title": "Settings",
-		"Page":  "settings",
-		"Time":  time.Now().Format("2006-01-02 15:04:05"),
+		"Title":                  "Settings",
+		"Page":                   "settings",
+		"Time":                   time.Now().Format("2006-01-02 15:04:05"),
+		"ConfigPatch":            models.GetConfigPatch(h.db),
+		"DeviceLimit":            deviceLimit,
+		"DeviceLimitKickMinutes": int(deviceLimit.KickDuration / time.Minute),
+		"GeoData":                geoData,
+		"GeoDataIntervalHours":   int(geoData.Interval / time.Hour),
+		"ProxyGroups":            append(proxyGroups, sourceGroups...),
+		"ClientProxyGroup":       models.GetClientProxyGroup(h.db),
+	})
+}
+
+func (h *Handler) AccessLogsPage(c *gin.Context) {
+	var users []models.User
+	h.db.Select("id", "name", "email").Order("name").Find(&users)
+
+	h.renderPage(c, "access-logs", gin.H{
+		"Title":     "Access Logs",
+		"Page":      "access-logs",
+		"AccessLog": models.GetAccessLogOptions(h.db),
+		"Users":     users,
+		"Filter": gin.H{
+			"User": c.Query("user"),
+			"Dest": c.Query("dest"),
+		},
+	})
+}
+
+func (h *Handler) RevisionsPage(c *gin.Context) {
+	h.renderPage(c, "revisions", gin.H{
+		"Title": "Revisions",
+		"Page":  "revisions",
+	})
+}
+
+func (h *Handler) XrayBinariesPage(c *gin.Context) {
+	h.renderPage(c, "xray-binaries", gin.H{
+		"Title": "Xray Binaries",
+		"Page":  "xray-binaries",
 	})
 }
 
@@ -181,7 +264,18 @@ func (h *Handler) UsersTable(c *gin.Context) {
 		CreatedAt  string
 		SubURL     string
 		ExpiryDate string
+		OnlineIPs  []models.UserOnlineIP
+		Kicked     bool
+	}
+
+	// 在线 IP 由后台同步任务定期刷新
+	var onlineIPs []models.UserOnlineIP
+	h.db.Order("ip").Find(&onlineIPs)
+	onlineByUser := make(map[string][]models.UserOnlineIP)
+	for _, ip := range onlineIPs {
+		onlineByUser[ip.UserID] = append(onlineByUser[ip.UserID], ip)
 	}
+	now := time.Now()
 
 	// Get base URL from request
 	// 优先检查 X-Forwarded-Proto 头（当面板通过 Nginx 反代时）
@@ -216,6 +310,8 @@ func (h *Handler) UsersTable(c *gin.Context) {
 			CreatedAt:  u.CreatedAt.Format("2006-01-02 15:04"),
 			SubURL:     subURL,
 			ExpiryDate: expiryDate,
+			OnlineIPs:  onlineByUser[u.ID],
+			Kicked:     u.KickedUntil.After(now),
 		}
 	}
 
@@ -225,9 +321,49 @@ func (h *Handler) UsersTable(c *gin.Context) {
 }
 
 func (h *Handler) NewUserForm(c *gin.Context) {
-	c.HTML(http.StatusOK, "components/user-form.html", gin.H{
-		"GeneratedUUID": generateUUID(),
-	})
+	data := h.egressFormData()
+	data["GeneratedUUID"] = generateUUID()
+	c.HTML(http.StatusOK, "components/user-form.html", data)
+}
+
+// egressFormData loads the selectable egress targets for the user form
+func (h *Handler) egressFormData() gin.H {
+	var outbounds []models.Outbound
+	h.db.Where("source_id = ? OR source_id IS NULL", "").Order("priority DESC").Find(&outbounds)
+
+	var sources []models.SubscriptionSource
+	h.db.Find(&sources)
+
+	var groups []models.OutboundGroup
+	h.db.Find(&groups)
+
+	return gin.H{
+		"Outbounds": outbounds,
+		"Sources":   sources,
+		"Groups":    groups,
+	}
+}
+
+// validateEgressTag checks that a user egress tag names an outbound, a
+// subscription group or an outbound group
+func (h *Handler) validateEgressTag(tag string) string {
+	if tag == "" || tag == "direct" || tag == "block" {
+		return ""
+	}
+	var count int64
+	h.db.Model(&models.Outbound{}).Where("tag = ?", tag).Count(&count)
+	if count > 0 {
+		return ""
+	}
+	h.db.Model(&models.SubscriptionSource{}).Where("group_tag = ?", tag).Count(&count)
+	if count > 0 {
+		return ""
+	}
+	h.db.Model(&models.OutboundGroup{}).Where("tag = ?", tag).Count(&count)
+	if count > 0 {
+		return ""
+	}
+	return "默认出口不存在: " + tag
 }
 
 func (h *Handler) EditUserForm(c *gin.Context) {
@@ -238,9 +374,9 @@ func (h *Handler) EditUserForm(c *gin.Context) {
 		return
 	}
 
-	c.HTML(http.StatusOK, "components/user-form.html", gin.H{
-		"User": user,
-	})
+	data := h.egressFormData()
+	data["User"] = user
+	c.HTML(http.StatusOK, "components/user-form.html", data)
 }
 
 func (h *Handler) CreateUser(c *gin.Context) {
@@ -263,6 +399,11 @@ func (h *Handler) CreateUser(c *gin.Context) {
 		c.String(http.StatusBadRequest, "UUID 不能为空")
 		return
 	}
+	user.EgressTag = strings.TrimSpace(user.EgressTag)
+	if msg := h.validateEgressTag(user.EgressTag); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
 
 	// Convert traffic_limit from GB to bytes if provided
 	if trafficGB := c.PostForm("traffic_limit"); trafficGB != "" {
@@ -275,6 +416,9 @@ func (h *Handler) CreateUser(c *gin.Context) {
 	// Set default values
 	user.CreatedAt = time.Now()
 	user.TrafficUsed = 0
+	if user.DeviceLimit < 0 {
+		user.DeviceLimit = 0
+	}
 
 	if err := h.db.Create(&user).Error; err != nil {
 		logger.Error("Failed to create user %s: %v", user.Email, err)
@@ -315,6 +459,11 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 		c.String(http.StatusBadRequest, "UUID 不能为空")
 		return
 	}
+	user.EgressTag = strings.TrimSpace(user.EgressTag)
+	if msg := h.validateEgressTag(user.EgressTag); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
 
 	// Convert traffic_limit from GB to bytes if provided
 	if trafficGB := c.PostForm("traffic_limit"); trafficGB != "" {
@@ -324,8 +473,12 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 		}
 	}
 
-	// Preserve traffic used
+	// Preserve traffic used and kick state
 	user.TrafficUsed = existingUser.TrafficUsed
+	user.KickedUntil = existingUser.KickedUntil
+	if user.DeviceLimit < 0 {
+		user.DeviceLimit = 0
+	}
 
 	// Use Save to avoid GORM skipping zero-value bool fields (e.g. Enabled=false)
 	user.ID = existingUser.ID
@@ -353,6 +506,8 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "Error deleting user")
 		return
 	}
+	h.db.Delete(&models.UserOnlineIP{}, "user_id = ?", id)
+	h.db.Delete(&models.WireGuardPeer{}, "user_id = ?", id)
 
 	c.String(http.StatusOK, "")
 }
@@ -439,58 +594,20 @@ func (h *Handler) EditInboundForm(c *gin.Context) {
 	})
 }
 
-func (h *Handler) WGClientConfig(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) CreateInbound(c *gin.Context) {
 	var inbound models.Inbound
-	if err := h.db.First(&inbound, "id = ?", id).Error; err != nil {
-		c.String(http.StatusNotFound, "Inbound not found")
+	if err := c.ShouldBind(&inbound); err != nil {
+		c.String(http.StatusBadRequest, "Invalid input")
 		return
 	}
 
-	if inbound.Protocol != models.ProtocolWireGuard {
-		c.String(http.StatusBadRequest, "Not a WireGuard inbound")
+	// Validate connect endpoint list (one address[:port][#remark] per line)
+	if _, err := models.ParseConnectEndpoints(inbound.ConnectEndpoints); err != nil {
+		c.String(http.StatusBadRequest, "连接端点格式错误: "+err.Error())
 		return
 	}
-
-	// Calculate a simple peer IP based on server IP
-	peerIP := "10.0.0.2/32"
-	if inbound.WGLocalIP != "" {
-		ipPart := inbound.WGLocalIP
-		if idx := strings.Index(ipPart, "/"); idx != -1 {
-			ipPart = ipPart[:idx]
-		}
-		ip := net.ParseIP(ipPart)
-		if ip != nil {
-			ip = ip.To4()
-			if ip != nil {
-				ip[3]++ // Increment last octet
-				peerIP = ip.String() + "/32"
-			}
-		}
-	}
-
-	// Get server IP
-	serverIP := ""
-	host := c.GetHeader("X-Forwarded-Host")
-	if host == "" {
-		host = c.Request.Host
-	}
-	if idx := strings.Index(host, ":"); idx != -1 {
-		host = host[:idx]
-	}
-	serverIP = host
-
-	c.HTML(http.StatusOK, "components/wg-client-config.html", gin.H{
-		"Inbound":  inbound,
-		"PeerIP":   peerIP,
-		"ServerIP": serverIP,
-	})
-}
-
-func (h *Handler) CreateInbound(c *gin.Context) {
-	var inbound models.Inbound
-	if err := c.ShouldBind(&inbound); err != nil {
-		c.String(http.StatusBadRequest, "Invalid input")
+	if err := xray.ValidatePatch(inbound.AdvancedJSON); err != nil {
+		c.String(http.StatusBadRequest, "高级 JSON 格式错误: "+err.Error())
 		return
 	}
 
@@ -512,6 +629,10 @@ func (h *Handler) CreateInbound(c *gin.Context) {
 		inbound.UseUDS = false
 		inbound.DomainID = ""
 		inbound.ActualDomain = ""
+		if msg := h.checkAdvancedJSON(&inbound, nil); msg != "" {
+			c.String(http.StatusBadRequest, msg)
+			return
+		}
 		if err := h.db.Create(&inbound).Error; err != nil {
 			logger.Error("Failed to create wireguard inbound %s: %v", inbound.Tag, err)
 			c.String(http.StatusInternalServerError, "Error creating inbound")
@@ -554,6 +675,10 @@ func (h *Handler) CreateInbound(c *gin.Context) {
 		logger.Info("CreateInbound: No DomainID provided")
 	}
 
+	if msg := h.checkAdvancedJSON(&inbound, nil); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
 	if err := h.db.Create(&inbound).Error; err != nil {
 		logger.Error("Failed to create inbound %s: %v", inbound.Tag, err)
 		c.String(http.StatusInternalServerError, "Error creating inbound")
@@ -598,6 +723,16 @@ func (h *Handler) UpdateInbound(c *gin.Context) {
 	existingInbound.Remark = c.PostForm("remark")
 	existingInbound.ConnectDomain = c.PostForm("connect_domain")
 	existingInbound.CustomSNI = c.PostForm("custom_sni")
+	existingInbound.ConnectEndpoints = c.PostForm("connect_endpoints")
+	if _, err := models.ParseConnectEndpoints(existingInbound.ConnectEndpoints); err != nil {
+		c.String(http.StatusBadRequest, "连接端点格式错误: "+err.Error())
+		return
+	}
+	existingInbound.AdvancedJSON = c.PostForm("advanced_json")
+	if err := xray.ValidatePatch(existingInbound.AdvancedJSON); err != nil {
+		c.String(http.StatusBadRequest, "高级 JSON 格式错误: "+err.Error())
+		return
+	}
 
 	// WireGuard specific fields
 	if c.PostForm("wg_secret_key") != "" {
@@ -627,6 +762,10 @@ func (h *Handler) UpdateInbound(c *gin.Context) {
 		existingInbound.UseUDS = false
 		existingInbound.DomainID = ""
 		existingInbound.ActualDomain = ""
+		if msg := h.checkAdvancedJSON(&existingInbound, nil); msg != "" {
+			c.String(http.StatusBadRequest, msg)
+			return
+		}
 		if err := h.db.Save(&existingInbound).Error; err != nil {
 			c.String(http.StatusInternalServerError, "Error updating inbound")
 			return
@@ -669,6 +808,10 @@ func (h *Handler) UpdateInbound(c *gin.Context) {
 		existingInbound.ActualDomain = ""
 	}
 
+	if msg := h.checkAdvancedJSON(&existingInbound, nil); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
 	if err := h.db.Save(&existingInbound).Error; err != nil {
 		c.String(http.StatusInternalServerError, "Error updating inbound")
 		return
@@ -724,6 +867,7 @@ func (h *Handler) DeleteInbound(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "Error deleting inbound")
 		return
 	}
+	h.db.Delete(&models.WireGuardPeer{}, "inbound_id = ?", id)
 
 	c.String(http.StatusOK, "")
 }
@@ -768,7 +912,7 @@ func (h *Handler) DomainsTable(c *gin.Context) {
 			Domain:  d,
 			HasCert: false,
 		}
-		
+
 		if d.CertPath != "" {
 			if expiry, err := utils.ParseCertificateExpiry(d.CertPath); err == nil {
 				view.HasCert = true
@@ -934,7 +1078,17 @@ func (h *Handler) OutboundsTable(c *gin.Context) {
 }
 
 func (h *Handler) NewOutboundForm(c *gin.Context) {
-	c.HTML(http.StatusOK, "components/outbound-form.html", nil)
+	c.HTML(http.StatusOK, "components/outbound-form.html", gin.H{
+		"Upstreams": h.upstreamOutbounds(""),
+	})
+}
+
+// upstreamOutbounds lists the outbounds selectable as dialer proxy, excluding excludeID
+func (h *Handler) upstreamOutbounds(excludeID string) []models.Outbound {
+	var outbounds []models.Outbound
+	h.db.Where("id <> ? AND type NOT IN ?", excludeID, []models.OutboundType{models.OutboundDirect, models.OutboundBlackhole}).
+		Order("priority DESC").Find(&outbounds)
+	return outbounds
 }
 
 func (h *Handler) ImportOutboundForm(c *gin.Context) {
@@ -977,7 +1131,8 @@ func (h *Handler) EditOutboundForm(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "components/outbound-form.html", gin.H{
-		"Outbound": outbound,
+		"Outbound":  outbound,
+		"Upstreams": h.upstreamOutbounds(outbound.ID),
 	})
 }
 
@@ -1021,6 +1176,22 @@ func (h *Handler) CreateOutbound(c *gin.Context) {
 		c.String(http.StatusBadRequest, "Tag is required")
 		return
 	}
+	if msg := h.validateDialerProxy(&outbound); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	if msg := h.selectorConflict(nil, nil, &outbound); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	if err := xray.ValidatePatch(outbound.AdvancedJSON); err != nil {
+		c.String(http.StatusBadRequest, "高级 JSON 格式错误: "+err.Error())
+		return
+	}
+	if msg := h.checkAdvancedJSON(nil, &outbound); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
 
 	// Set timestamps
 	outbound.CreatedAt = time.Now()
@@ -1084,7 +1255,34 @@ func (h *Handler) UpdateOutbound(c *gin.Context) {
 	}
 	outbound.ID = existing.ID
 	outbound.Enabled = existing.Enabled // Preserve enabled status
-	if err := h.db.Save(&outbound).Error; err != nil {
+	outbound.SourceID = existing.SourceID
+	outbound.SourceKey = existing.SourceKey
+	if msg := h.validateDialerProxy(&outbound); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	if msg := h.selectorConflict(nil, nil, &outbound); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	if err := xray.ValidatePatch(outbound.AdvancedJSON); err != nil {
+		c.String(http.StatusBadRequest, "高级 JSON 格式错误: "+err.Error())
+		return
+	}
+	if msg := h.checkAdvancedJSON(nil, &outbound); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&outbound).Error; err != nil {
+			return err
+		}
+		if outbound.Tag == existing.Tag {
+			return nil
+		}
+		return renameTagReferences(tx, existing.Tag, outbound.Tag)
+	})
+	if err != nil {
 		logger.Error("Failed to update outbound %s: %v", id, err)
 		c.String(http.StatusInternalServerError, "Error updating outbound: "+err.Error())
 		return
@@ -1094,6 +1292,71 @@ func (h *Handler) UpdateOutbound(c *gin.Context) {
 	h.OutboundsTable(c)
 }
 
+// renameTagReferences points everything that references oldTag (user egress,
+// routing rules, chains, group members / fallback, the client default proxy)
+// at newTag
+func renameTagReferences(tx *gorm.DB, oldTag, newTag string) error {
+	if err := tx.Model(&models.User{}).Where("egress_tag = ?", oldTag).
+		Update("egress_tag", newTag).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.RoutingRule{}).Where("outbound_tag = ?", oldTag).
+		Update("outbound_tag", newTag).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Outbound{}).Where("dialer_proxy = ?", oldTag).
+		Update("dialer_proxy", newTag).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Setting{}).Where("key = ? AND value = ?", "client_proxy_group", oldTag).
+		Update("value", newTag).Error; err != nil {
+		return err
+	}
+
+	var groups []models.OutboundGroup
+	if err := tx.Find(&groups).Error; err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if !g.HasMember(oldTag) && g.FallbackTag != oldTag {
+			continue
+		}
+		members := g.MemberTags()
+		for i, m := range members {
+			if m == oldTag {
+				members[i] = newTag
+			}
+		}
+		updates := map[string]interface{}{"members": strings.Join(members, ",")}
+		if g.FallbackTag == oldTag {
+			updates["fallback_tag"] = newTag
+		}
+		if err := tx.Model(&g).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDialerProxy checks that the upstream of a chained outbound exists
+// and that saving the outbound would not create a chaining cycle
+func (h *Handler) validateDialerProxy(outbound *models.Outbound) string {
+	outbound.DialerProxy = strings.TrimSpace(outbound.DialerProxy)
+	if outbound.DialerProxy == "" {
+		return ""
+	}
+	if outbound.DialerProxy == outbound.Tag {
+		return "前置代理不能是出站自身"
+	}
+
+	var others []models.Outbound
+	h.db.Where("id <> ?", outbound.ID).Find(&others)
+	if _, err := models.ResolveOutboundChain(append(others, *outbound), outbound.Tag); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
 func (h *Handler) ToggleOutbound(c *gin.Context) {
 	id := c.Param("id")
 
@@ -1116,6 +1379,15 @@ func (h *Handler) ToggleOutbound(c *gin.Context) {
 
 func (h *Handler) DeleteOutbound(c *gin.Context) {
 	id := c.Param("id")
+	var outbound models.Outbound
+	if err := h.db.First(&outbound, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Outbound not found")
+		return
+	}
+	if refs := h.tagReferences([]string{outbound.Tag}); len(refs) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "出站仍被引用，请先修改: " + strings.Join(refs, "、")})
+		return
+	}
 	if err := h.db.Delete(&models.Outbound{}, "id = ?", id).Error; err != nil {
 		c.String(http.StatusInternalServerError, "Error deleting outbound")
 		return
@@ -1124,148 +1396,1026 @@ func (h *Handler) DeleteOutbound(c *gin.Context) {
 	c.String(http.StatusOK, "")
 }
 
-// ============ Routing API ============
+// ============ Subscription Sources API ============
 
-func (h *Handler) RoutingTable(c *gin.Context) {
-	var rules []models.RoutingRule
-	if err := h.db.Order("priority ASC, created_at DESC").Find(&rules).Error; err != nil {
-		c.String(http.StatusInternalServerError, "Error loading routing rules")
+func (h *Handler) SubscriptionSourcesTable(c *gin.Context) {
+	var sources []models.SubscriptionSource
+	if err := h.db.Order("created_at ASC").Find(&sources).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error loading subscription sources")
 		return
 	}
 
-	c.HTML(http.StatusOK, "components/routing-table.html", gin.H{
-		"Rules": rules,
+	c.HTML(http.StatusOK, "components/subscription-sources-table.html", gin.H{
+		"Sources": sources,
 	})
 }
 
-func (h *Handler) NewRoutingForm(c *gin.Context) {
-	var outbounds []models.Outbound
-	h.db.Find(&outbounds)
-
-	var inbounds []models.Inbound
-	h.db.Find(&inbounds)
-
-	c.HTML(http.StatusOK, "components/routing-form.html", gin.H{
-		"Outbounds": outbounds,
-		"Inbounds":  inbounds,
-	})
+func (h *Handler) NewSubscriptionSourceForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "components/subscription-source-form.html", nil)
 }
 
-func (h *Handler) EditRoutingForm(c *gin.Context) {
+func (h *Handler) EditSubscriptionSourceForm(c *gin.Context) {
 	id := c.Param("id")
-	var rule models.RoutingRule
-	if err := h.db.First(&rule, "id = ?", id).Error; err != nil {
-		c.String(http.StatusNotFound, "Routing rule not found")
+	var source models.SubscriptionSource
+	if err := h.db.First(&source, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Subscription source not found")
 		return
 	}
 
-	var outbounds []models.Outbound
-	h.db.Find(&outbounds)
+	c.HTML(http.StatusOK, "components/subscription-source-form.html", gin.H{
+		"Source": source,
+	})
+}
 
-	var inbounds []models.Inbound
-	h.db.Find(&inbounds)
+// bindSubscriptionSource reads and validates the subscription source form
+func (h *Handler) bindSubscriptionSource(c *gin.Context, source *models.SubscriptionSource) string {
+	source.Name = strings.TrimSpace(c.PostForm("name"))
+	source.URL = strings.TrimSpace(c.PostForm("url"))
+	source.GroupTag = strings.TrimSpace(c.PostForm("group_tag"))
+	source.NameFilter = strings.TrimSpace(c.PostForm("name_filter"))
+	source.ExcludeFilter = strings.TrimSpace(c.PostForm("exclude_filter"))
+	source.Remark = c.PostForm("remark")
+	source.AutoApply = c.PostForm("auto_apply") == "true"
 
-	c.HTML(http.StatusOK, "components/routing-form.html", gin.H{
-		"Rule":      rule,
-		"Outbounds": outbounds,
-		"Inbounds":  inbounds,
-	})
+	if source.Name == "" {
+		return "名称不能为空"
+	}
+	if !strings.HasPrefix(source.URL, "http://") && !strings.HasPrefix(source.URL, "https://") {
+		return "订阅地址必须以 http:// 或 https:// 开头"
+	}
+	if !models.ValidGroupTag(source.GroupTag) {
+		return "分组标签只能包含字母、数字、- 和 _，且不能为保留标签"
+	}
+	var count int64
+	h.db.Model(&models.Outbound{}).Where("tag = ?", source.GroupTag).Count(&count)
+	if count > 0 {
+		return "分组标签与已有出站标签冲突"
+	}
+	h.db.Model(&models.SubscriptionSource{}).Where("group_tag = ? AND id <> ?", source.GroupTag, source.ID).Count(&count)
+	if count > 0 {
+		return "分组标签已被其他订阅源使用"
+	}
+	h.db.Model(&models.OutboundGroup{}).Where("tag = ?", source.GroupTag).Count(&count)
+	if count > 0 {
+		return "分组标签与已有出站组冲突"
+	}
+	if _, err := regexp.Compile(source.NameFilter); err != nil {
+		return "名称过滤表达式无效: " + err.Error()
+	}
+	if _, err := regexp.Compile(source.ExcludeFilter); err != nil {
+		return "排除过滤表达式无效: " + err.Error()
+	}
+	if msg := h.selectorConflict(nil, source, nil); msg != "" {
+		return msg
+	}
+
+	source.RefreshInterval = 360
+	if v, err := strconv.Atoi(c.PostForm("refresh_interval")); err == nil && v > 0 {
+		if v < 5 {
+			v = 5 // 避免过于频繁地请求机场
+		}
+		source.RefreshInterval = v
+	}
+	return ""
 }
 
-func (h *Handler) CreateRouting(c *gin.Context) {
-	var rule models.RoutingRule
-	if err := c.ShouldBind(&rule); err != nil {
-		c.String(http.StatusBadRequest, "Invalid input")
+func (h *Handler) CreateSubscriptionSource(c *gin.Context) {
+	var source models.SubscriptionSource
+	if msg := h.bindSubscriptionSource(c, &source); msg != "" {
+		c.String(http.StatusBadRequest, msg)
 		return
 	}
+	source.Enabled = true
 
-	if err := h.db.Create(&rule).Error; err != nil {
-		c.String(http.StatusInternalServerError, "Error creating routing rule")
+	if err := h.db.Create(&source).Error; err != nil {
+		logger.Error("Failed to create subscription source %s: %v", source.Name, err)
+		c.String(http.StatusInternalServerError, "Error creating subscription source: "+err.Error())
 		return
 	}
 
-	h.RoutingTable(c)
+	logger.Info("Subscription source created: %s (%s)", source.Name, source.GroupTag)
+	h.SubscriptionSourcesTable(c)
 }
 
-func (h *Handler) UpdateRouting(c *gin.Context) {
+func (h *Handler) UpdateSubscriptionSource(c *gin.Context) {
 	id := c.Param("id")
-	var rule models.RoutingRule
-	if err := c.ShouldBind(&rule); err != nil {
-		c.String(http.StatusBadRequest, "Invalid input")
+	var source models.SubscriptionSource
+	if err := h.db.First(&source, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Subscription source not found")
 		return
 	}
 
-	// Use Save to avoid GORM skipping zero-value bool fields (e.g. Enabled=false)
-	var existing models.RoutingRule
-	if err := h.db.First(&existing, "id = ?", id).Error; err != nil {
-		c.String(http.StatusNotFound, "Routing rule not found")
+	oldGroupTag := source.GroupTag
+	oldURL := source.URL
+	if msg := h.bindSubscriptionSource(c, &source); msg != "" {
+		c.String(http.StatusBadRequest, msg)
 		return
 	}
-	rule.ID = existing.ID
-	rule.Enabled = existing.Enabled // Preserve enabled status
-	if err := h.db.Save(&rule).Error; err != nil {
-		c.String(http.StatusInternalServerError, "Error updating routing rule")
+	if source.URL != oldURL {
+		source.LastFetchAt = time.Time{} // refresh on next sync run
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&source).Error; err != nil {
+			return err
+		}
+		if source.GroupTag == oldGroupTag {
+			return nil
+		}
+		// Rename member outbounds and rules targeting the group
+		var members []models.Outbound
+		if err := tx.Where("source_id = ?", source.ID).Find(&members).Error; err != nil {
+			return err
+		}
+		for _, m := range members {
+			newTag := source.GroupTag + strings.TrimPrefix(m.Tag, oldGroupTag)
+			if err := tx.Model(&models.Outbound{}).Where("id = ?", m.ID).Update("tag", newTag).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.User{}).Where("egress_tag = ?", oldGroupTag).
+			Update("egress_tag", source.GroupTag).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Setting{}).Where("key = ? AND value = ?", "client_proxy_group", oldGroupTag).
+			Update("value", source.GroupTag).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RoutingRule{}).Where("outbound_tag = ?", oldGroupTag).
+			Update("outbound_tag", source.GroupTag).Error
+	})
+	if err != nil {
+		logger.Error("Failed to update subscription source %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error updating subscription source: "+err.Error())
 		return
 	}
 
-	h.RoutingTable(c)
+	logger.Info("Subscription source updated: %s (%s)", source.Name, source.GroupTag)
+	h.SubscriptionSourcesTable(c)
 }
 
-func (h *Handler) ToggleRouting(c *gin.Context) {
+func (h *Handler) ToggleSubscriptionSource(c *gin.Context) {
 	id := c.Param("id")
 
-	var rule models.RoutingRule
-	if err := h.db.First(&rule, "id = ?", id).Error; err != nil {
-		c.String(http.StatusNotFound, "Routing rule not found")
+	var source models.SubscriptionSource
+	if err := h.db.First(&source, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Subscription source not found")
 		return
 	}
 
-	rule.Enabled = !rule.Enabled
-	if err := h.db.Save(&rule).Error; err != nil {
-		logger.Error("Failed to toggle routing rule %s: %v", id, err)
-		c.String(http.StatusInternalServerError, "Error toggling routing rule")
+	source.Enabled = !source.Enabled
+	if err := h.db.Save(&source).Error; err != nil {
+		logger.Error("Failed to toggle subscription source %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error toggling subscription source")
 		return
 	}
 
-	logger.Info("Routing rule toggled: %s (Enabled: %v)", rule.Name, rule.Enabled)
-	h.RoutingTable(c)
+	logger.Info("Subscription source toggled: %s (Enabled: %v)", source.Name, source.Enabled)
+	h.SubscriptionSourcesTable(c)
 }
 
-func (h *Handler) DeleteRouting(c *gin.Context) {
+func (h *Handler) DeleteSubscriptionSource(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.db.Delete(&models.RoutingRule{}, "id = ?", id).Error; err != nil {
-		c.String(http.StatusInternalServerError, "Error deleting routing rule")
+	var source models.SubscriptionSource
+	if err := h.db.First(&source, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Subscription source not found")
+		return
+	}
+	// 分组标签及其节点都可能被规则、用户出口或出站组引用
+	tags := []string{source.GroupTag}
+	var nodeTags []string
+	h.db.Model(&models.Outbound{}).Where("source_id = ?", id).Pluck("tag", &nodeTags)
+	tags = append(tags, nodeTags...)
+	if refs := h.tagReferences(tags); len(refs) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "订阅源仍被引用，请先修改: " + strings.Join(refs, "、")})
+		return
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.Outbound{}, "source_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.SubscriptionSource{}, "id = ?", id).Error
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error deleting subscription source")
 		return
 	}
 
 	c.String(http.StatusOK, "")
 }
 
-// ============ Nginx Config Helper ============
+// ============ Outbound Groups API ============
 
-// generateNginxConfigForInbound generates Nginx reverse proxy config for a single inbound
-func (h *Handler) generateNginxConfigForInbound(inbound *models.Inbound) error {
-	if h.nginx == nil {
-		return fmt.Errorf("nginx generator not configured")
+func (h *Handler) OutboundGroupsTable(c *gin.Context) {
+	var groups []models.OutboundGroup
+	if err := h.db.Order("created_at ASC").Find(&groups).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error loading outbound groups")
+		return
 	}
 
-	if inbound.Domain == nil {
-		// Try to load domain if not preloaded
-		if inbound.DomainID != "" {
-			var domain models.Domain
-			if err := h.db.First(&domain, "id = ?", inbound.DomainID).Error; err != nil {
-				return fmt.Errorf("failed to load domain: %v", err)
-			}
-			inbound.Domain = &domain
-		} else {
-			return fmt.Errorf("inbound has no domain configured")
-		}
-	}
+	c.HTML(http.StatusOK, "components/outbound-groups-table.html", gin.H{
+		"Groups": groups,
+	})
+}
 
-	// Generate config for this single inbound
-	inbounds := []models.Inbound{*inbound}
-	if err := h.nginx.GenerateHTTPConfig(inbounds); err != nil {
-		return fmt.Errorf("failed to generate HTTP config: %v", err)
+// outboundGroupFormData loads the selectable members for the outbound group form
+func (h *Handler) outboundGroupFormData() gin.H {
+	var outbounds []models.Outbound
+	h.db.Where("source_id = ? OR source_id IS NULL", "").Order("priority DESC").Find(&outbounds)
+
+	var sources []models.SubscriptionSource
+	h.db.Find(&sources)
+
+	return gin.H{
+		"Outbounds": outbounds,
+		"Sources":   sources,
+	}
+}
+
+func (h *Handler) NewOutboundGroupForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "components/outbound-group-form.html", h.outboundGroupFormData())
+}
+
+func (h *Handler) EditOutboundGroupForm(c *gin.Context) {
+	id := c.Param("id")
+	var group models.OutboundGroup
+	if err := h.db.First(&group, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Outbound group not found")
+		return
+	}
+
+	data := h.outboundGroupFormData()
+	data["Group"] = group
+	c.HTML(http.StatusOK, "components/outbound-group-form.html", data)
+}
+
+// bindOutboundGroup reads and validates the outbound group form
+func (h *Handler) bindOutboundGroup(c *gin.Context, group *models.OutboundGroup) string {
+	group.Tag = strings.TrimSpace(c.PostForm("tag"))
+	group.Strategy = models.BalancerStrategy(c.PostForm("strategy"))
+	group.FallbackTag = strings.TrimSpace(c.PostForm("fallback_tag"))
+	group.Remark = c.PostForm("remark")
+
+	var members []string
+	seen := make(map[string]bool)
+	for _, v := range c.PostFormArray("members") {
+		v = strings.TrimSpace(v)
+		if v != "" && !seen[v] {
+			seen[v] = true
+			members = append(members, v)
+		}
+	}
+	group.Members = strings.Join(members, ",")
+
+	if !models.ValidGroupTag(group.Tag) {
+		return "组标签只能包含字母、数字、- 和 _，且不能为保留标签"
+	}
+	var count int64
+	h.db.Model(&models.Outbound{}).Where("tag = ?", group.Tag).Count(&count)
+	if count > 0 {
+		return "组标签与已有出站标签冲突"
+	}
+	h.db.Model(&models.SubscriptionSource{}).Where("group_tag = ?", group.Tag).Count(&count)
+	if count > 0 {
+		return "组标签与订阅源分组冲突"
+	}
+	h.db.Model(&models.OutboundGroup{}).Where("tag = ? AND id <> ?", group.Tag, group.ID).Count(&count)
+	if count > 0 {
+		return "组标签已被其他出站组使用"
+	}
+	if !models.ValidBalancerStrategy(group.Strategy) {
+		return "无效的负载均衡策略"
+	}
+	if len(members) == 0 {
+		return "请至少选择一个成员"
+	}
+	for _, m := range members {
+		if m == group.Tag {
+			return "出站组不能包含自身"
+		}
+		h.db.Model(&models.OutboundGroup{}).Where("tag = ?", m).Count(&count)
+		if count > 0 {
+			return "出站组不能嵌套其他出站组: " + m
+		}
+	}
+	if group.FallbackTag != "" && group.FallbackTag != "direct" && group.FallbackTag != "block" {
+		h.db.Model(&models.Outbound{}).Where("tag = ?", group.FallbackTag).Count(&count)
+		if count == 0 {
+			return "回退出站不存在: " + group.FallbackTag
+		}
+	}
+	return h.selectorConflict(group, nil, nil)
+}
+
+// selectorConflict checks the balancer selectors as they would be after
+// saving the given group, source or outbound (nil = unchanged); returns the
+// error message or ""
+func (h *Handler) selectorConflict(group *models.OutboundGroup, source *models.SubscriptionSource, outbound *models.Outbound) string {
+	var groups []models.OutboundGroup
+	h.db.Find(&groups)
+	var sources []models.SubscriptionSource
+	h.db.Find(&sources)
+	var outbounds []models.Outbound
+	h.db.Select("id", "tag", "source_id").Find(&outbounds)
+
+	if group != nil {
+		found := false
+		for i := range groups {
+			if groups[i].ID == group.ID {
+				groups[i], found = *group, true
+			}
+		}
+		if !found {
+			groups = append(groups, *group)
+		}
+	}
+	if source != nil {
+		found := false
+		for i := range sources {
+			if sources[i].ID == source.ID {
+				sources[i], found = *source, true
+			}
+		}
+		if !found {
+			sources = append(sources, *source)
+		}
+	}
+	if outbound != nil {
+		found := false
+		for i := range outbounds {
+			if outbounds[i].ID == outbound.ID {
+				outbounds[i], found = *outbound, true
+			}
+		}
+		if !found {
+			outbounds = append(outbounds, *outbound)
+		}
+	}
+
+	if member, other := models.SelectorPrefixConflict(groups, sources, outbounds); member != "" {
+		// Xray 按前缀匹配负载均衡成员
+		return fmt.Sprintf("出站组成员 %s 是 %s 的前缀，会被一并选中，请修改标签", member, other)
+	}
+	return ""
+}
+
+// tagReferences lists what still targets the given outbound / group tags:
+// routing rules, user egress, outbound groups, chained outbounds and the
+// client default proxy
+func (h *Handler) tagReferences(tags []string) []string {
+	var refs []string
+
+	var rules []models.RoutingRule
+	h.db.Where("outbound_tag IN ?", tags).Find(&rules)
+	for _, r := range rules {
+		refs = append(refs, "路由规则 "+r.Name)
+	}
+
+	var users []models.User
+	h.db.Select("name").Where("egress_tag IN ?", tags).Find(&users)
+	for _, u := range users {
+		refs = append(refs, "用户 "+u.Name)
+	}
+
+	var groups []models.OutboundGroup
+	h.db.Find(&groups)
+	for _, g := range groups {
+		for _, tag := range tags {
+			if g.Tag != tag && (g.HasMember(tag) || g.FallbackTag == tag) {
+				refs = append(refs, "出站组 "+g.Tag)
+				break
+			}
+		}
+	}
+
+	var outbounds []models.Outbound
+	h.db.Select("tag").Where("dialer_proxy IN ?", tags).Find(&outbounds)
+	for _, o := range outbounds {
+		refs = append(refs, "出站 "+o.Tag)
+	}
+
+	proxyGroup := models.GetClientProxyGroup(h.db)
+	for _, tag := range tags {
+		if proxyGroup != "" && proxyGroup == tag {
+			refs = append(refs, "客户端默认代理")
+		}
+	}
+	return refs
+}
+
+func (h *Handler) CreateOutboundGroup(c *gin.Context) {
+	var group models.OutboundGroup
+	if msg := h.bindOutboundGroup(c, &group); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	group.Enabled = true
+
+	if err := h.db.Create(&group).Error; err != nil {
+		logger.Error("Failed to create outbound group %s: %v", group.Tag, err)
+		c.String(http.StatusInternalServerError, "Error creating outbound group: "+err.Error())
+		return
+	}
+
+	logger.Info("Outbound group created: %s (%s)", group.Tag, group.Strategy)
+	h.OutboundGroupsTable(c)
+}
+
+func (h *Handler) UpdateOutboundGroup(c *gin.Context) {
+	id := c.Param("id")
+	var group models.OutboundGroup
+	if err := h.db.First(&group, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Outbound group not found")
+		return
+	}
+
+	oldTag := group.Tag
+	if msg := h.bindOutboundGroup(c, &group); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&group).Error; err != nil {
+			return err
+		}
+		if group.Tag == oldTag {
+			return nil
+		}
+		return renameTagReferences(tx, oldTag, group.Tag)
+	})
+	if err != nil {
+		logger.Error("Failed to update outbound group %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error updating outbound group: "+err.Error())
+		return
+	}
+
+	logger.Info("Outbound group updated: %s (%s)", group.Tag, group.Strategy)
+	h.OutboundGroupsTable(c)
+}
+
+func (h *Handler) ToggleOutboundGroup(c *gin.Context) {
+	id := c.Param("id")
+
+	var group models.OutboundGroup
+	if err := h.db.First(&group, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Outbound group not found")
+		return
+	}
+
+	group.Enabled = !group.Enabled
+	if err := h.db.Save(&group).Error; err != nil {
+		logger.Error("Failed to toggle outbound group %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error toggling outbound group")
+		return
+	}
+
+	logger.Info("Outbound group toggled: %s (Enabled: %v)", group.Tag, group.Enabled)
+	h.OutboundGroupsTable(c)
+}
+
+func (h *Handler) DeleteOutboundGroup(c *gin.Context) {
+	id := c.Param("id")
+	var group models.OutboundGroup
+	if err := h.db.First(&group, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Outbound group not found")
+		return
+	}
+	if refs := h.tagReferences([]string{group.Tag}); len(refs) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "出站组仍被引用，请先修改: " + strings.Join(refs, "、")})
+		return
+	}
+	if err := h.db.Delete(&models.OutboundGroup{}, "id = ?", id).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error deleting outbound group")
+		return
+	}
+
+	c.String(http.StatusOK, "")
+}
+
+// ============ DNS API ============
+
+func (h *Handler) DNSServersTable(c *gin.Context) {
+	var servers []models.DNSServer
+	if err := h.db.Order("priority ASC, created_at ASC").Find(&servers).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error loading DNS servers")
+		return
+	}
+
+	c.HTML(http.StatusOK, "components/dns-servers-table.html", gin.H{
+		"Servers": servers,
+	})
+}
+
+func (h *Handler) NewDNSServerForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "components/dns-server-form.html", nil)
+}
+
+func (h *Handler) EditDNSServerForm(c *gin.Context) {
+	id := c.Param("id")
+	var server models.DNSServer
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "DNS server not found")
+		return
+	}
+
+	c.HTML(http.StatusOK, "components/dns-server-form.html", gin.H{
+		"Server": server,
+	})
+}
+
+// bindDNSServer reads and validates the DNS server form
+func bindDNSServer(c *gin.Context, server *models.DNSServer) string {
+	server.Scope = models.DNSScope(c.PostForm("scope"))
+	server.Address = strings.TrimSpace(c.PostForm("address"))
+	server.Domains = strings.TrimSpace(c.PostForm("domains"))
+	server.ExpectIPs = strings.TrimSpace(c.PostForm("expect_ips"))
+	server.SkipFallback = c.PostForm("skip_fallback") == "true"
+	server.ClientIP = strings.TrimSpace(c.PostForm("client_ip"))
+	server.QueryStrategy = c.PostForm("query_strategy")
+	server.Remark = c.PostForm("remark")
+
+	switch server.Scope {
+	case models.DNSScopeAll, models.DNSScopeServer, models.DNSScopeClient:
+	default:
+		return "无效的适用模式"
+	}
+	if server.Address == "" || strings.ContainsAny(server.Address, " \t,") {
+		return "服务器地址无效"
+	}
+	if server.QueryStrategy != "" && !models.ValidQueryStrategy(server.QueryStrategy) {
+		return "无效的查询策略"
+	}
+	if server.ClientIP != "" && net.ParseIP(server.ClientIP) == nil {
+		return "Client IP 必须是 IP 地址"
+	}
+
+	server.Port = 0
+	if v := strings.TrimSpace(c.PostForm("port")); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 0 || port > 65535 {
+			return "端口无效"
+		}
+		server.Port = port
+	}
+	server.Priority = 100
+	if v, err := strconv.Atoi(c.PostForm("priority")); err == nil {
+		server.Priority = v
+	}
+	return ""
+}
+
+func (h *Handler) CreateDNSServer(c *gin.Context) {
+	var server models.DNSServer
+	if msg := bindDNSServer(c, &server); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	server.Enabled = true
+
+	if err := h.db.Create(&server).Error; err != nil {
+		logger.Error("Failed to create DNS server %s: %v", server.Address, err)
+		c.String(http.StatusInternalServerError, "Error creating DNS server: "+err.Error())
+		return
+	}
+
+	logger.Info("DNS server created: %s (%s)", server.Address, server.Scope)
+	h.DNSServersTable(c)
+}
+
+func (h *Handler) UpdateDNSServer(c *gin.Context) {
+	id := c.Param("id")
+	var server models.DNSServer
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "DNS server not found")
+		return
+	}
+	if msg := bindDNSServer(c, &server); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := h.db.Save(&server).Error; err != nil {
+		logger.Error("Failed to update DNS server %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error updating DNS server: "+err.Error())
+		return
+	}
+
+	logger.Info("DNS server updated: %s (%s)", server.Address, server.Scope)
+	h.DNSServersTable(c)
+}
+
+func (h *Handler) ToggleDNSServer(c *gin.Context) {
+	id := c.Param("id")
+
+	var server models.DNSServer
+	if err := h.db.First(&server, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "DNS server not found")
+		return
+	}
+
+	server.Enabled = !server.Enabled
+	if err := h.db.Save(&server).Error; err != nil {
+		logger.Error("Failed to toggle DNS server %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error toggling DNS server")
+		return
+	}
+
+	logger.Info("DNS server toggled: %s (Enabled: %v)", server.Address, server.Enabled)
+	h.DNSServersTable(c)
+}
+
+func (h *Handler) DeleteDNSServer(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.db.Delete(&models.DNSServer{}, "id = ?", id).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error deleting DNS server")
+		return
+	}
+
+	c.String(http.StatusOK, "")
+}
+
+func (h *Handler) DNSHostsTable(c *gin.Context) {
+	var hosts []models.DNSHost
+	if err := h.db.Order("domain ASC").Find(&hosts).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error loading DNS hosts")
+		return
+	}
+
+	c.HTML(http.StatusOK, "components/dns-hosts-table.html", gin.H{
+		"Hosts": hosts,
+	})
+}
+
+func (h *Handler) NewDNSHostForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "components/dns-host-form.html", nil)
+}
+
+func (h *Handler) EditDNSHostForm(c *gin.Context) {
+	id := c.Param("id")
+	var host models.DNSHost
+	if err := h.db.First(&host, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "DNS host not found")
+		return
+	}
+
+	c.HTML(http.StatusOK, "components/dns-host-form.html", gin.H{
+		"Host": host,
+	})
+}
+
+// bindDNSHost reads and validates the DNS host form
+func bindDNSHost(c *gin.Context, host *models.DNSHost) string {
+	host.Scope = models.DNSScope(c.PostForm("scope"))
+	host.Domain = strings.TrimSpace(c.PostForm("domain"))
+	host.Addresses = strings.Join(models.SplitList(c.PostForm("addresses")), ",")
+	host.Remark = c.PostForm("remark")
+
+	switch host.Scope {
+	case models.DNSScopeAll, models.DNSScopeServer, models.DNSScopeClient:
+	default:
+		return "无效的适用模式"
+	}
+	if host.Domain == "" || strings.ContainsAny(host.Domain, " \t,") {
+		return "域名无效"
+	}
+	addrs := host.AddressList()
+	if len(addrs) == 0 {
+		return "地址不能为空"
+	}
+	if len(addrs) > 1 {
+		for _, a := range addrs {
+			if net.ParseIP(a) == nil {
+				return "多个地址时必须全部为 IP: " + a
+			}
+		}
+	}
+	return ""
+}
+
+func (h *Handler) CreateDNSHost(c *gin.Context) {
+	var host models.DNSHost
+	if msg := bindDNSHost(c, &host); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	host.Enabled = true
+
+	if err := h.db.Create(&host).Error; err != nil {
+		logger.Error("Failed to create DNS host %s: %v", host.Domain, err)
+		c.String(http.StatusInternalServerError, "Error creating DNS host: "+err.Error())
+		return
+	}
+
+	logger.Info("DNS host created: %s -> %s", host.Domain, host.Addresses)
+	h.DNSHostsTable(c)
+}
+
+func (h *Handler) UpdateDNSHost(c *gin.Context) {
+	id := c.Param("id")
+	var host models.DNSHost
+	if err := h.db.First(&host, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "DNS host not found")
+		return
+	}
+	if msg := bindDNSHost(c, &host); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := h.db.Save(&host).Error; err != nil {
+		logger.Error("Failed to update DNS host %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error updating DNS host: "+err.Error())
+		return
+	}
+
+	logger.Info("DNS host updated: %s -> %s", host.Domain, host.Addresses)
+	h.DNSHostsTable(c)
+}
+
+func (h *Handler) ToggleDNSHost(c *gin.Context) {
+	id := c.Param("id")
+
+	var host models.DNSHost
+	if err := h.db.First(&host, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "DNS host not found")
+		return
+	}
+
+	host.Enabled = !host.Enabled
+	if err := h.db.Save(&host).Error; err != nil {
+		logger.Error("Failed to toggle DNS host %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error toggling DNS host")
+		return
+	}
+
+	logger.Info("DNS host toggled: %s (Enabled: %v)", host.Domain, host.Enabled)
+	h.DNSHostsTable(c)
+}
+
+func (h *Handler) DeleteDNSHost(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.db.Delete(&models.DNSHost{}, "id = ?", id).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error deleting DNS host")
+		return
+	}
+
+	c.String(http.StatusOK, "")
+}
+
+// ============ Local Inbounds ============
+
+func (h *Handler) NewLocalInboundForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "components/local-inbound-form.html", nil)
+}
+
+func (h *Handler) EditLocalInboundForm(c *gin.Context) {
+	id := c.Param("id")
+	var local models.LocalInbound
+	if err := h.db.First(&local, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Local inbound not found")
+		return
+	}
+
+	c.HTML(http.StatusOK, "components/local-inbound-form.html", gin.H{
+		"Local": local,
+	})
+}
+
+// ============ Config Revisions API ============
+
+func (h *Handler) RevisionsTable(c *gin.Context) {
+	var revisions []models.ConfigRevision
+	// The stored Xray config can be large; the table does not need it
+	if err := h.db.Omit("xray_config").Order("created_at DESC").Find(&revisions).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error loading revisions")
+		return
+	}
+
+	c.HTML(http.StatusOK, "components/revisions-table.html", gin.H{
+		"Revisions": revisions,
+	})
+}
+
+// ============ Routing API ============
+
+func (h *Handler) RoutingTable(c *gin.Context) {
+	var rules []models.RoutingRule
+	if err := h.db.Order("priority ASC, created_at DESC").Find(&rules).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error loading routing rules")
+		return
+	}
+
+	c.HTML(http.StatusOK, "components/routing-table.html", gin.H{
+		"Rules": rules,
+	})
+}
+
+func (h *Handler) NewRoutingForm(c *gin.Context) {
+	var outbounds []models.Outbound
+	h.db.Where("source_id = ? OR source_id IS NULL", "").Find(&outbounds)
+
+	var sources []models.SubscriptionSource
+	h.db.Find(&sources)
+
+	var groups []models.OutboundGroup
+	h.db.Find(&groups)
+
+	var inbounds []models.Inbound
+	h.db.Find(&inbounds)
+	var localInbounds []models.LocalInbound
+	h.db.Order("port ASC").Find(&localInbounds)
+
+	var users []models.User
+	h.db.Order("name ASC").Find(&users)
+
+	c.HTML(http.StatusOK, "components/routing-form.html", gin.H{
+		"Outbounds":     outbounds,
+		"Sources":       sources,
+		"Groups":        groups,
+		"Inbounds":      inbounds,
+		"LocalInbounds": localInbounds,
+		"Users":         users,
+	})
+}
+
+func (h *Handler) EditRoutingForm(c *gin.Context) {
+	id := c.Param("id")
+	var rule models.RoutingRule
+	if err := h.db.First(&rule, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Routing rule not found")
+		return
+	}
+
+	var outbounds []models.Outbound
+	h.db.Where("source_id = ? OR source_id IS NULL", "").Find(&outbounds)
+
+	var sources []models.SubscriptionSource
+	h.db.Find(&sources)
+
+	var groups []models.OutboundGroup
+	h.db.Find(&groups)
+
+	var inbounds []models.Inbound
+	h.db.Find(&inbounds)
+	var localInbounds []models.LocalInbound
+	h.db.Order("port ASC").Find(&localInbounds)
+
+	var users []models.User
+	h.db.Order("name ASC").Find(&users)
+
+	c.HTML(http.StatusOK, "components/routing-form.html", gin.H{
+		"Rule":          rule,
+		"Outbounds":     outbounds,
+		"Sources":       sources,
+		"Groups":        groups,
+		"Inbounds":      inbounds,
+		"LocalInbounds": localInbounds,
+		"Users":         users,
+	})
+}
+
+// bindRoutingRule reads and validates the multi-condition routing rule form
+func bindRoutingRule(c *gin.Context, rule *models.RoutingRule) string {
+	if err := c.ShouldBind(rule); err != nil {
+		return "Invalid input"
+	}
+
+	// Multi-value checkboxes
+	rule.InboundTag = strings.Join(c.PostFormArray("inbound_tag"), ",")
+	rule.Users = strings.Join(c.PostFormArray("users"), ",")
+	rule.Type = models.RuleTypeMulti
+
+	if strings.TrimSpace(rule.OutboundTag) == "" {
+		return "请选择目标出站"
+	}
+	if !rule.HasCondition() {
+		return "请至少填写一个匹配条件"
+	}
+	for _, p := range []struct{ name, value string }{{"目标端口", rule.Port}, {"来源端口", rule.SourcePort}} {
+		if p.value != "" && !validPortList(p.value) {
+			return p.name + "格式无效，应为 443、1000-2000 或 53,443"
+		}
+	}
+	for _, line := range strings.Split(rule.Attrs, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.Contains(line, "=") {
+			return "HTTP 属性格式无效: " + line
+		}
+	}
+	return ""
+}
+
+// portListPattern matches Xray port lists: 443, 1000-2000, 53,443
+var portListPattern = regexp.MustCompile(`^\d+(-\d+)?(\s*,\s*\d+(-\d+)?)*$`)
+
+// validPortList reports whether s is a valid Xray port list with ports in range
+func validPortList(s string) bool {
+	s = strings.TrimSpace(s)
+	if !portListPattern.MatchString(s) {
+		return false
+	}
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '-' || r == ' ' }) {
+		if n, err := strconv.Atoi(part); err != nil || n > 65535 {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Handler) CreateRouting(c *gin.Context) {
+	var rule models.RoutingRule
+	if msg := bindRoutingRule(c, &rule); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := h.db.Create(&rule).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error creating routing rule")
+		return
+	}
+
+	h.RoutingTable(c)
+}
+
+func (h *Handler) UpdateRouting(c *gin.Context) {
+	id := c.Param("id")
+	var rule models.RoutingRule
+	if msg := bindRoutingRule(c, &rule); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+
+	// Use Save to avoid GORM skipping zero-value bool fields (e.g. Enabled=false)
+	var existing models.RoutingRule
+	if err := h.db.First(&existing, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Routing rule not found")
+		return
+	}
+	rule.ID = existing.ID
+	rule.Enabled = existing.Enabled // Preserve enabled status
+	if err := h.db.Save(&rule).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error updating routing rule")
+		return
+	}
+
+	h.RoutingTable(c)
+}
+
+func (h *Handler) ToggleRouting(c *gin.Context) {
+	id := c.Param("id")
+
+	var rule models.RoutingRule
+	if err := h.db.First(&rule, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Routing rule not found")
+		return
+	}
+
+	rule.Enabled = !rule.Enabled
+	if err := h.db.Save(&rule).Error; err != nil {
+		logger.Error("Failed to toggle routing rule %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error toggling routing rule")
+		return
+	}
+
+	logger.Info("Routing rule toggled: %s (Enabled: %v)", rule.Name, rule.Enabled)
+	h.RoutingTable(c)
+}
+
+func (h *Handler) DeleteRouting(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.db.Delete(&models.RoutingRule{}, "id = ?", id).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error deleting routing rule")
+		return
+	}
+
+	c.String(http.StatusOK, "")
+}
+
+// ============ Nginx Config Helper ============
+
+// generateNginxConfigForInbound generates Nginx reverse proxy config for a single inbound
+func (h *Handler) generateNginxConfigForInbound(inbound *models.Inbound) error {
+	if h.nginx == nil {
+		return fmt.Errorf("nginx generator not configured")
+	}
+
+	if inbound.Domain == nil {
+		// Try to load domain if not preloaded
+		if inbound.DomainID != "" {
+			var domain models.Domain
+			if err := h.db.First(&domain, "id = ?", inbound.DomainID).Error; err != nil {
+				return fmt.Errorf("failed to load domain: %v", err)
+			}
+			inbound.Domain = &domain
+		} else {
+			return fmt.Errorf("inbound has no domain configured")
+		}
+	}
+
+	// Generate config for this single inbound
+	inbounds := []models.Inbound{*inbound}
+	if err := h.nginx.GenerateHTTPConfig(inbounds); err != nil {
+		return fmt.Errorf("failed to generate HTTP config: %v", err)
 	}
 
 	// Reload Nginx
@@ -1276,3 +2426,243 @@ func (h *Handler) generateNginxConfigForInbound(inbound *models.Inbound) error {
 
 	return nil
 }
+
+// ============ Access Logs API ============
+
+// accessLogCount is one row of an access log aggregation
+type accessLogCount struct {
+	Key     string
+	Count   int64
+	Percent int
+}
+
+func (h *Handler) AccessLogsTable(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	userKey := strings.TrimSpace(c.Query("user"))
+	dest := strings.TrimSpace(c.Query("dest"))
+	sourceIP := strings.TrimSpace(c.Query("ip"))
+
+	filtered := func() *gorm.DB {
+		q := h.db.Model(&models.AccessLog{}).Where("time >= ?", time.Now().Add(-time.Duration(hours)*time.Hour))
+		if userKey != "" {
+			q = q.Where("user_key = ?", userKey)
+		}
+		if dest != "" {
+			q = q.Where("destination LIKE ?", "%"+dest+"%")
+		}
+		if sourceIP != "" {
+			q = q.Where("source_ip = ?", sourceIP)
+		}
+		return q
+	}
+
+	var records []models.AccessLog
+	if err := filtered().Order("time DESC, id DESC").Limit(200).Find(&records).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error loading access logs")
+		return
+	}
+	var total int64
+	filtered().Count(&total)
+
+	topCounts := func(column string, limit int) []accessLogCount {
+		var rows []accessLogCount
+		filtered().Select(column + " AS key, COUNT(*) AS count").Where(column + " <> ''").
+			Group(column).Order("count DESC").Limit(limit).Scan(&rows)
+		for i := range rows {
+			rows[i].Percent = int(rows[i].Count * 100 / rows[0].Count)
+		}
+		return rows
+	}
+	topDestinations := topCounts("destination", 20)
+	var topUsers []accessLogCount
+	if userKey == "" {
+		topUsers = topCounts("user_key", 10)
+	}
+
+	// StatsKey → 用户名
+	var users []models.User
+	h.db.Select("id", "name").Find(&users)
+	userNames := make(map[string]string, len(users))
+	for _, u := range users {
+		userNames[u.StatsKey()] = u.Name
+	}
+
+	c.HTML(http.StatusOK, "components/access-logs-table.html", gin.H{
+		"Records":         records,
+		"Total":           total,
+		"Hours":           hours,
+		"TopDestinations": topDestinations,
+		"TopUsers":        topUsers,
+		"UserNames":       userNames,
+	})
+}
+
+// ============ Geo Data Handlers ============
+
+func (h *Handler) GeoDataBrowser(c *gin.Context) {
+	c.HTML(http.StatusOK, "components/geodata-browser.html", gin.H{
+		"Category": c.Query("category"),
+	})
+}
+
+func (h *Handler) RoutingSimulator(c *gin.Context) {
+	var inboundTags []string
+	h.db.Model(&models.Inbound{}).Where("enabled = ?", true).Order("tag ASC").Pluck("tag", &inboundTags)
+	var localTags []string
+	h.db.Model(&models.LocalInbound{}).Where("enabled = ?", true).Order("tag ASC").Pluck("tag", &localTags)
+	inboundTags = append(inboundTags, localTags...)
+	if models.GetTransparentProxyOptions(h.db).Enabled {
+		inboundTags = append(inboundTags, models.TransparentProxyTag)
+	}
+	if models.GetTunOptions(h.db).Enabled {
+		inboundTags = append(inboundTags, models.TunTag)
+	}
+	var users []models.User
+	h.db.Where("enabled = ?", true).Order("name ASC").Find(&users)
+
+	c.HTML(http.StatusOK, "components/routing-simulator.html", gin.H{
+		"InboundTags": inboundTags,
+		"Users":       users,
+	})
+}
+
+func (h *Handler) GeoDataUpdatesTable(c *gin.Context) {
+	var updates []models.GeoDataUpdate
+	h.db.Order("id DESC").Limit(10).Find(&updates)
+
+	c.HTML(http.StatusOK, "components/geodata-updates-table.html", gin.H{
+		"Updates": updates,
+	})
+}
+
+// ============ Custom Geo Lists API ============
+
+// customGeoTagPattern restricts list tags to what Xray accepts after "ext:file:"
+var customGeoTagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.!-]*$`)
+
+func (h *Handler) CustomGeoListsTable(c *gin.Context) {
+	var lists []models.CustomGeoList
+	if err := h.db.Order("type ASC, tag ASC").Find(&lists).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error loading custom geo lists")
+		return
+	}
+
+	c.HTML(http.StatusOK, "components/custom-geo-lists-table.html", gin.H{
+		"Lists": lists,
+	})
+}
+
+func (h *Handler) NewCustomGeoListForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "components/custom-geo-list-form.html", nil)
+}
+
+func (h *Handler) EditCustomGeoListForm(c *gin.Context) {
+	id := c.Param("id")
+	var list models.CustomGeoList
+	if err := h.db.First(&list, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Custom geo list not found")
+		return
+	}
+
+	c.HTML(http.StatusOK, "components/custom-geo-list-form.html", gin.H{
+		"List": list,
+	})
+}
+
+// bindCustomGeoList reads and validates the custom geo list form
+func bindCustomGeoList(c *gin.Context, list *models.CustomGeoList) string {
+	list.Tag = strings.ToLower(strings.TrimSpace(c.PostForm("tag")))
+	list.Type = models.CustomGeoType(c.PostForm("type"))
+	list.Entries = strings.TrimSpace(strings.ReplaceAll(c.PostForm("entries"), "\r\n", "\n"))
+	list.Remark = c.PostForm("remark")
+
+	if !customGeoTagPattern.MatchString(list.Tag) {
+		return "标签只能包含小写字母、数字和 _ . ! -"
+	}
+	for _, line := range list.EntryLines() {
+		var err error
+		switch list.Type {
+		case models.CustomGeoSite:
+			_, err = geodata.ParseDomainRule(line)
+		case models.CustomGeoIP:
+			_, err = geodata.ParseCIDRRule(line)
+		default:
+			return "无效的列表类型"
+		}
+		if err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+func (h *Handler) CreateCustomGeoList(c *gin.Context) {
+	var list models.CustomGeoList
+	if msg := bindCustomGeoList(c, &list); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := h.db.Create(&list).Error; err != nil {
+		logger.Error("Failed to create custom geo list %s: %v", list.Tag, err)
+		c.String(http.StatusInternalServerError, "Error creating custom geo list: "+err.Error())
+		return
+	}
+
+	logger.Info("Custom geo list created: %s (%d entries)", list.Reference(), len(list.EntryLines()))
+	h.CustomGeoListsTable(c)
+}
+
+func (h *Handler) UpdateCustomGeoList(c *gin.Context) {
+	id := c.Param("id")
+	var list models.CustomGeoList
+	if err := h.db.First(&list, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Custom geo list not found")
+		return
+	}
+	old := list
+	if msg := bindCustomGeoList(c, &list); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	// 改名或换类型后原引用会失效
+	if old.Reference() != list.Reference() {
+		if users := old.ReferencedBy(h.db); len(users) > 0 {
+			c.String(http.StatusBadRequest, old.Reference()+" 正在被使用: "+strings.Join(users, ", "))
+			return
+		}
+	}
+
+	if err := h.db.Save(&list).Error; err != nil {
+		logger.Error("Failed to update custom geo list %s: %v", id, err)
+		c.String(http.StatusInternalServerError, "Error updating custom geo list: "+err.Error())
+		return
+	}
+
+	logger.Info("Custom geo list updated: %s (%d entries)", list.Reference(), len(list.EntryLines()))
+	h.CustomGeoListsTable(c)
+}
+
+func (h *Handler) DeleteCustomGeoList(c *gin.Context) {
+	id := c.Param("id")
+	var list models.CustomGeoList
+	if err := h.db.First(&list, "id = ?", id).Error; err != nil {
+		c.String(http.StatusNotFound, "Custom geo list not found")
+		return
+	}
+	if users := list.ReferencedBy(h.db); len(users) > 0 {
+		c.String(http.StatusBadRequest, list.Reference()+" 正在被使用: "+strings.Join(users, ", "))
+		return
+	}
+
+	if err := h.db.Delete(&list).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Error deleting custom geo list")
+		return
+	}
+
+	logger.Info("Custom geo list deleted: %s", list.Reference())
+	c.String(http.StatusOK, "")
+}
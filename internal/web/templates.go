@@ -79,8 +79,12 @@ func LoadTemplates(templateFS fs.FS) (*template.Template, error) {
 		"templates/pages/inbounds.html",
 		"templates/pages/outbounds.html",
 		"templates/pages/routing.html",
+		"templates/pages/dns.html",
 		"templates/pages/domains.html",
 		"templates/pages/settings.html",
+		"templates/pages/revisions.html",
+		"templates/pages/access-logs.html",
+		"templates/pages/xray-binaries.html",
 	}
 	for _, page := range pages {
 		if err := loadTemplate(tmpl, templateFS, page); err != nil {
@@ -101,9 +105,27 @@ func LoadTemplates(templateFS fs.FS) (*template.Template, error) {
 		"templates/components/outbound-form.html",
 		"templates/components/routing-table.html",
 		"templates/components/routing-form.html",
-		"templates/components/wg-client-config.html",
+		"templates/components/wg-peers.html",
 		"templates/components/import-outbound-form.html",
 		"templates/components/certificates-scan-result.html",
+		"templates/components/subscription-sources-table.html",
+		"templates/components/subscription-source-form.html",
+		"templates/components/outbound-groups-table.html",
+		"templates/components/outbound-group-form.html",
+		"templates/components/dns-servers-table.html",
+		"templates/components/dns-server-form.html",
+		"templates/components/dns-hosts-table.html",
+		"templates/components/dns-host-form.html",
+		"templates/components/revisions-table.html",
+		"templates/components/access-logs-table.html",
+		"templates/components/xray-binaries-table.html",
+		"templates/components/geodata-updates-table.html",
+		"templates/components/geodata-browser.html",
+		"templates/components/routing-simulator.html",
+		"templates/components/local-inbounds-table.html",
+		"templates/components/local-inbound-form.html",
+		"templates/components/custom-geo-lists-table.html",
+		"templates/components/custom-geo-list-form.html",
 	}
 	for _, comp := range components {
 		if err := loadTemplate(tmpl, templateFS, comp); err != nil {
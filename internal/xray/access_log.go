@@ -0,0 +1,69 @@
+package xray
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"xray-panel/internal/models"
+)
+
+// accessLogPattern matches Xray access log lines, e.g.
+//
+//	2024/01/02 15:04:05.123456 from 1.2.3.4:51234 accepted tcp:www.example.com:443 [vless-in -> proxy] email: <stats key>
+//
+// Older cores use ">>" instead of "->" between the inbound and outbound tags.
+var accessLogPattern = regexp.MustCompile(
+	`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})(?:\.\d+)? from (?:(?:tcp|udp):)?(\S+) (accepted|rejected) (?:(tcp|udp):)?(\S+)(?: \[([^\]]*)\])?(?: email: (\S+))?`,
+)
+
+// ParseAccessLogLine parses one Xray access log line. Lines that are not
+// connection records (DNS queries, errors) return false.
+func ParseAccessLogLine(line string, loc *time.Location) (models.AccessLog, bool) {
+	m := accessLogPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return models.AccessLog{}, false
+	}
+
+	t, err := time.ParseInLocation("2006/01/02 15:04:05", m[1], loc)
+	if err != nil {
+		return models.AccessLog{}, false
+	}
+
+	entry := models.AccessLog{
+		Time:     t,
+		SourceIP: m[2],
+		Accepted: m[3] == "accepted",
+		Network:  m[4],
+		UserKey:  m[7],
+	}
+	if host, _, err := net.SplitHostPort(m[2]); err == nil {
+		entry.SourceIP = host
+	}
+	if entry.Network == "" {
+		entry.Network = "tcp"
+	}
+
+	entry.Destination = m[5]
+	if host, port, err := net.SplitHostPort(m[5]); err == nil {
+		entry.Destination = host
+		entry.Port, _ = strconv.Atoi(port)
+	}
+
+	// [inbound -> outbound] / [inbound >> outbound] / [inbound]
+	tags := m[6]
+	for _, sep := range []string{" -> ", " >> "} {
+		if i := strings.Index(tags, sep); i >= 0 {
+			entry.InboundTag = tags[:i]
+			entry.OutboundTag = tags[i+len(sep):]
+			tags = ""
+			break
+		}
+	}
+	if tags != "" {
+		entry.InboundTag = tags
+	}
+	return entry, true
+}
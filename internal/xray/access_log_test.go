@@ -0,0 +1,74 @@
+package xray
+
+import (
+	"testing"
+	"time"
+
+	"xray-panel/internal/models"
+)
+
+func TestParseAccessLogLine(t *testing.T) {
+	at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name string
+		line string
+		want models.AccessLog
+		ok   bool
+	}{
+		{
+			name: "arrow separator",
+			line: "2024/01/02 15:04:05.123456 from 1.2.3.4:51234 accepted tcp:www.example.com:443 [vless-in -> proxy] email: alice",
+			want: models.AccessLog{Time: at, SourceIP: "1.2.3.4", Accepted: true, Network: "tcp", Destination: "www.example.com", Port: 443, InboundTag: "vless-in", OutboundTag: "proxy", UserKey: "alice"},
+			ok:   true,
+		},
+		{
+			name: "old separator",
+			line: "2024/01/02 15:04:05 from 1.2.3.4:51234 accepted udp:8.8.8.8:53 [vless-in >> direct] email: bob",
+			want: models.AccessLog{Time: at, SourceIP: "1.2.3.4", Accepted: true, Network: "udp", Destination: "8.8.8.8", Port: 53, InboundTag: "vless-in", OutboundTag: "direct", UserKey: "bob"},
+			ok:   true,
+		},
+		{
+			name: "network prefixed source",
+			line: "2024/01/02 15:04:05 from tcp:1.2.3.4:51234 accepted tcp:example.org:80 [socks-in -> proxy]",
+			want: models.AccessLog{Time: at, SourceIP: "1.2.3.4", Accepted: true, Network: "tcp", Destination: "example.org", Port: 80, InboundTag: "socks-in", OutboundTag: "proxy"},
+			ok:   true,
+		},
+		{
+			name: "ipv6 source and destination",
+			line: "2024/01/02 15:04:05 from [::1]:40000 accepted tcp:[2001:db8::1]:443 [vless-in -> proxy] email: alice",
+			want: models.AccessLog{Time: at, SourceIP: "::1", Accepted: true, Network: "tcp", Destination: "2001:db8::1", Port: 443, InboundTag: "vless-in", OutboundTag: "proxy", UserKey: "alice"},
+			ok:   true,
+		},
+		{
+			name: "no email no outbound",
+			line: "2024/01/02 15:04:05 from 1.2.3.4:51234 accepted www.example.com:443 [vless-in]",
+			want: models.AccessLog{Time: at, SourceIP: "1.2.3.4", Accepted: true, Network: "tcp", Destination: "www.example.com", Port: 443, InboundTag: "vless-in"},
+			ok:   true,
+		},
+		{
+			name: "rejected",
+			line: "2024/01/02 15:04:05 from 1.2.3.4:51234 rejected tcp:ads.example.com:443 [vless-in -> block] email: alice",
+			want: models.AccessLog{Time: at, SourceIP: "1.2.3.4", Network: "tcp", Destination: "ads.example.com", Port: 443, InboundTag: "vless-in", OutboundTag: "block", UserKey: "alice"},
+			ok:   true,
+		},
+		{
+			name: "dns query",
+			line: "2024/01/02 15:04:05 localhost got answer: www.example.com. TypeA -> [93.184.216.34] 1ms",
+		},
+		{
+			name: "garbage",
+			line: "not a log line",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseAccessLogLine(tt.line, time.UTC)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != tt.want {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
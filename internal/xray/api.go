@@ -109,6 +109,57 @@ func (c *APIClient) GetStats(name string, reset bool) (int64, error) {
 	return 0, nil
 }
 
+// GetOnlineIPs returns the source IPs currently online for a user, keyed by IP
+// with the last-seen unix time (`xray api statsonlineiplist`, requires the
+// statsUserOnline policy)
+func (c *APIClient) GetOnlineIPs(email string) (map[string]int64, error) {
+	cmd := exec.Command(c.xrayBinary, "api", "statsonlineiplist",
+		"--server=127.0.0.1:"+strconv.Itoa(c.apiPort),
+		"-email", email,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		// 用户不在线时 Xray 返回 not found
+		if bytes.Contains(output, []byte("not found")) {
+			return map[string]int64{}, nil
+		}
+		return nil, fmt.Errorf("%v: %s", err, bytes.TrimSpace(output))
+	}
+
+	// protojson encodes int64 values as strings
+	var resp struct {
+		IPs map[string]json.Number `json:"ips"`
+	}
+	start := bytes.IndexByte(output, '{')
+	if start < 0 {
+		return map[string]int64{}, nil
+	}
+	if err := json.Unmarshal(output[start:], &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse online IP list: %w", err)
+	}
+
+	ips := make(map[string]int64, len(resp.IPs))
+	for ip, seen := range resp.IPs {
+		ts, _ := seen.Int64()
+		ips[ip] = ts
+	}
+	return ips, nil
+}
+
+// GetBalancerInfo returns the current selection of a balancer (`xray api bi`),
+// which reflects the latest observatory results for leastPing / leastLoad
+func (c *APIClient) GetBalancerInfo(tag string) (string, error) {
+	cmd := exec.Command(c.xrayBinary, "api", "bi",
+		"--server=127.0.0.1:"+strconv.Itoa(c.apiPort),
+		tag,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, bytes.TrimSpace(output))
+	}
+	return string(output), nil
+}
+
 // RestartXray restarts Xray process (requires external script)
 func (c *APIClient) RestartXray() error {
 	// This would typically call a system command or script
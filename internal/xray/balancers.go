@@ -0,0 +1,263 @@
+package xray
+
+import (
+	"math"
+	"sort"
+
+	"xray-panel/internal/models"
+)
+
+// ObservatoryConfig represents the Xray observatory (used by leastPing balancers)
+type ObservatoryConfig struct {
+	SubjectSelector   []string `json:"subjectSelector"`
+	ProbeURL          string   `json:"probeUrl,omitempty"`
+	ProbeInterval     string   `json:"probeInterval,omitempty"`
+	EnableConcurrency bool     `json:"enableConcurrency,omitempty"`
+}
+
+// BurstObservatoryConfig represents the Xray burst observatory (used by leastLoad balancers)
+type BurstObservatoryConfig struct {
+	SubjectSelector []string         `json:"subjectSelector"`
+	PingConfig      *BurstPingConfig `json:"pingConfig,omitempty"`
+}
+
+// BurstPingConfig represents burst observatory probing settings
+type BurstPingConfig struct {
+	Destination string `json:"destination"`
+	Interval    string `json:"interval"`
+	Sampling    int    `json:"sampling"`
+	Timeout     string `json:"timeout"`
+}
+
+// Default observatory probe settings
+const (
+	defaultProbeURL      = "https://www.google.com/generate_204"
+	defaultProbeInterval = "1m"
+)
+
+// balancerGroups maps every balancer tag (subscription source groups and
+// outbound groups) to the tags of its enabled member outbounds
+func (g *Generator) balancerGroups() map[string][]string {
+	groups := make(map[string][]string, len(g.sources)+len(g.groups))
+
+	// Subscription sources: all enabled nodes of the source
+	byID := make(map[string]string, len(g.sources))
+	for _, src := range g.sources {
+		groups[src.GroupTag] = nil
+		byID[src.ID] = src.GroupTag
+	}
+	enabled := make(map[string]bool, len(g.outbounds))
+	for _, o := range g.sortedOutbounds() {
+		if !g.outboundActive(o) {
+			continue
+		}
+		enabled[o.Tag] = true
+		if tag, ok := byID[o.SourceID]; ok && o.SourceID != "" {
+			groups[tag] = append(groups[tag], o.Tag)
+		}
+	}
+
+	// Outbound groups: listed outbounds, source groups expand to their nodes
+	sourceMembers := make(map[string][]string, len(groups))
+	for tag, members := range groups {
+		sourceMembers[tag] = members
+	}
+	for _, grp := range g.groups {
+		if !grp.Enabled {
+			groups[grp.Tag] = nil // rules targeting a disabled group are blocked
+			continue
+		}
+		seen := make(map[string]bool)
+		members := []string{}
+		add := func(tag string) {
+			if !seen[tag] {
+				seen[tag] = true
+				members = append(members, tag)
+			}
+		}
+		for _, tag := range splitCSV(grp.Members) {
+			if nodes, ok := sourceMembers[tag]; ok {
+				for _, n := range nodes {
+					add(n)
+				}
+			} else if enabled[tag] {
+				add(tag)
+			}
+		}
+		groups[grp.Tag] = members
+	}
+	return groups
+}
+
+// generateBalancers renders non-empty groups as routing balancers
+func (g *Generator) generateBalancers(groups map[string][]string) []Balancer {
+	strategies := make(map[string]models.OutboundGroup, len(g.groups))
+	for _, grp := range g.groups {
+		if grp.Enabled {
+			strategies[grp.Tag] = grp
+		}
+	}
+
+	tags := make([]string, 0, len(groups))
+	for tag, members := range groups {
+		if len(members) > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	balancers := make([]Balancer, 0, len(tags))
+	for _, tag := range tags {
+		balancer := Balancer{
+			Tag:      tag,
+			Selector: groups[tag],
+			Strategy: &BalancerStrategy{Type: string(models.BalancerRandom)},
+		}
+		if grp, ok := strategies[tag]; ok {
+			if models.ValidBalancerStrategy(grp.Strategy) {
+				balancer.Strategy.Type = string(grp.Strategy)
+			}
+			if grp.UsesObservatory() && grp.FallbackTag != "" {
+				balancer.FallbackTag = grp.FallbackTag
+			}
+			if grp.Strategy == models.BalancerLeastLoad {
+				balancer.Strategy.Settings = g.leastLoadSettings(groups[tag])
+			}
+		}
+		balancers = append(balancers, balancer)
+	}
+	return balancers
+}
+
+// leastLoadSettings maps Outbound.Priority (higher = preferred) to leastLoad
+// costs: the measured latency deviation is multiplied by 0.9^priority
+func (g *Generator) leastLoadSettings(members []string) map[string]interface{} {
+	priority := make(map[string]int, len(g.outbounds))
+	for _, o := range g.outbounds {
+		priority[o.Tag] = o.Priority
+	}
+
+	costs := []map[string]interface{}{}
+	for _, tag := range members {
+		if p := priority[tag]; p != 0 {
+			costs = append(costs, map[string]interface{}{
+				"regexp": false,
+				"match":  tag,
+				"value":  math.Round(math.Pow(0.9, float64(p))*1000) / 1000,
+			})
+		}
+	}
+
+	settings := map[string]interface{}{
+		"expected":  2,
+		"tolerance": 0.01,
+	}
+	if len(costs) > 0 {
+		settings["costs"] = costs
+	}
+	return settings
+}
+
+// generateObservatories builds observatory / burstObservatory sections for
+// leastPing / leastLoad groups; nil when no group needs probing
+func (g *Generator) generateObservatories(groups map[string][]string) (*ObservatoryConfig, *BurstObservatoryConfig) {
+	var pingSubjects, loadSubjects []string
+	pingSeen := make(map[string]bool)
+	loadSeen := make(map[string]bool)
+
+	for _, grp := range g.groups {
+		if !grp.Enabled {
+			continue
+		}
+		for _, tag := range groups[grp.Tag] {
+			switch grp.Strategy {
+			case models.BalancerLeastPing:
+				if !pingSeen[tag] {
+					pingSeen[tag] = true
+					pingSubjects = append(pingSubjects, tag)
+				}
+			case models.BalancerLeastLoad:
+				if !loadSeen[tag] {
+					loadSeen[tag] = true
+					loadSubjects = append(loadSubjects, tag)
+				}
+			}
+		}
+	}
+
+	probeURL := g.probeURL
+	if probeURL == "" {
+		probeURL = defaultProbeURL
+	}
+	interval := g.probeInterval
+	if interval == "" {
+		interval = defaultProbeInterval
+	}
+
+	var observatory *ObservatoryConfig
+	if len(pingSubjects) > 0 {
+		observatory = &ObservatoryConfig{
+			SubjectSelector:   pingSubjects,
+			ProbeURL:          probeURL,
+			ProbeInterval:     interval,
+			EnableConcurrency: true,
+		}
+	}
+
+	var burst *BurstObservatoryConfig
+	if len(loadSubjects) > 0 {
+		burst = &BurstObservatoryConfig{
+			SubjectSelector: loadSubjects,
+			PingConfig: &BurstPingConfig{
+				Destination: probeURL,
+				Interval:    interval,
+				Sampling:    3,
+				Timeout:     "5s",
+			},
+		}
+	}
+
+	return observatory, burst
+}
+
+// sortedOutbounds returns the configured outbounds ordered by Priority
+// (higher = preferred), keeping the original order for equal priorities
+func (g *Generator) sortedOutbounds() []models.Outbound {
+	sorted := make([]models.Outbound, len(g.outbounds))
+	copy(sorted, g.outbounds)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	return sorted
+}
+
+// outboundActive reports whether an outbound is generated: enabled and,
+// for subscription nodes, belonging to an enabled source
+func (g *Generator) outboundActive(o models.Outbound) bool {
+	if !o.Enabled {
+		return false
+	}
+	if o.SourceID == "" {
+		return true
+	}
+	for _, src := range g.sources {
+		if src.ID == o.SourceID {
+			return src.Enabled
+		}
+	}
+	return true
+}
+
+// primaryProxyTag returns the default proxy in client mode: the group the
+// admin picked, otherwise the first enabled outbound
+func (g *Generator) primaryProxyTag() string {
+	if g.proxyGroup != "" {
+		return g.proxyGroup
+	}
+	for _, o := range g.outbounds {
+		if g.outboundActive(o) {
+			return o.Tag
+		}
+	}
+	return "proxy"
+}
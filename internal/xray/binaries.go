@@ -0,0 +1,364 @@
+package xray
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxBinaryUpload bounds the size of an uploaded release archive
+	MaxBinaryUpload = 200 << 20
+	// binaryMetaFile stores the metadata of an installed version
+	binaryMetaFile = "meta.json"
+	// binaryPreviousFile records the version that was active before the last switch
+	binaryPreviousFile = ".previous"
+)
+
+var (
+	xrayVersionPattern  = regexp.MustCompile(`^Xray (\S+)`)
+	sha256DigestPattern = regexp.MustCompile(`(?i)SHA2?-?256[^=\n]*=\s*([0-9a-f]{64})`)
+	sha256HexPattern    = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	binaryNamePattern   = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// BinaryInfo describes one installed Xray binary
+type BinaryInfo struct {
+	Version  string    `json:"version"` // directory name in the store
+	Path     string    `json:"path"`
+	Output   string    `json:"output"` // `xray version` output
+	SHA256   string    `json:"sha256"` // checksum of the uploaded file
+	Size     int64     `json:"size"`
+	Source   string    `json:"source"` // uploaded file name
+	AddedAt  time.Time `json:"added_at"`
+	Active   bool      `json:"active"`
+	Previous bool      `json:"previous"`
+}
+
+// BinaryStore keeps several Xray binaries in one directory, one
+// sub-directory per version. The active version is a symlink at the
+// configured binary path, so systemd units and the supervisor keep working.
+type BinaryStore struct {
+	dir        string
+	binaryPath string
+}
+
+// NewBinaryStore creates a store in dir whose active binary is linked at binaryPath
+func NewBinaryStore(dir, binaryPath string) *BinaryStore {
+	if binaryPath == "" {
+		binaryPath = "/usr/local/bin/xray"
+	}
+	return &BinaryStore{dir: dir, binaryPath: binaryPath}
+}
+
+// BinaryPath returns the path of the active binary
+func (s *BinaryStore) BinaryPath() string {
+	return s.binaryPath
+}
+
+// List returns the installed binaries, newest first
+func (s *BinaryStore) List() ([]BinaryInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	active, previous := s.Active(), s.Previous()
+	var list []BinaryInfo
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := s.Get(entry.Name())
+		if err != nil {
+			continue
+		}
+		info.Active = info.Version == active
+		info.Previous = info.Version == previous
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AddedAt.After(list[j].AddedAt) })
+	return list, nil
+}
+
+// Get returns an installed binary by version
+func (s *BinaryStore) Get(version string) (BinaryInfo, error) {
+	if version == "" || version != filepath.Base(version) || strings.HasPrefix(version, ".") {
+		return BinaryInfo{}, fmt.Errorf("无效的版本: %q", version)
+	}
+	dir := filepath.Join(s.dir, version)
+	data, err := os.ReadFile(filepath.Join(dir, binaryMetaFile))
+	if err != nil {
+		return BinaryInfo{}, fmt.Errorf("版本 %s 不存在", version)
+	}
+	var info BinaryInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return BinaryInfo{}, fmt.Errorf("版本 %s 元数据损坏: %w", version, err)
+	}
+	info.Version = version
+	info.Path = filepath.Join(dir, "xray")
+	return info, nil
+}
+
+// Active returns the version the binary path links to, or "" when the binary
+// path is not managed by the store
+func (s *BinaryStore) Active() string {
+	target, err := os.Readlink(s.binaryPath)
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(s.binaryPath), target)
+	}
+	dir := filepath.Dir(target)
+	if filepath.Dir(dir) != filepath.Clean(s.dir) {
+		return ""
+	}
+	return filepath.Base(dir)
+}
+
+// Previous returns the version that was active before the last switch
+func (s *BinaryStore) Previous() string {
+	data, err := os.ReadFile(filepath.Join(s.dir, binaryPreviousFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Install verifies an uploaded release archive (or bare binary) against its
+// SHA-256 checksum, checks that it runs on this host and adds it to the store.
+func (s *BinaryStore) Install(data []byte, source, checksum string) (BinaryInfo, error) {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	if expected, err := ParseChecksum(checksum); err != nil {
+		return BinaryInfo{}, err
+	} else if expected != actual {
+		return BinaryInfo{}, fmt.Errorf("SHA-256 校验失败: 期望 %s，实际 %s", expected, actual)
+	}
+
+	binary, err := extractXrayBinary(data)
+	if err != nil {
+		return BinaryInfo{}, err
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return BinaryInfo{}, err
+	}
+	tmpDir, err := os.MkdirTemp(s.dir, ".upload-")
+	if err != nil {
+		return BinaryInfo{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := filepath.Join(tmpDir, "xray")
+	if err := os.WriteFile(tmpPath, binary, 0755); err != nil {
+		return BinaryInfo{}, err
+	}
+	output, err := BinaryVersion(tmpPath)
+	if err != nil {
+		return BinaryInfo{}, fmt.Errorf("无法在本机运行该内核（架构不匹配或文件损坏）: %w", err)
+	}
+
+	info := BinaryInfo{
+		Output:  output,
+		SHA256:  actual,
+		Size:    int64(len(binary)),
+		Source:  filepath.Base(source),
+		AddedAt: time.Now(),
+	}
+	return s.add(tmpDir, info)
+}
+
+// add moves a prepared version directory into the store
+func (s *BinaryStore) add(tmpDir string, info BinaryInfo) (BinaryInfo, error) {
+	version := "unknown"
+	if m := xrayVersionPattern.FindStringSubmatch(info.Output); m != nil {
+		version = binaryNamePattern.ReplaceAllString(m[1], "_")
+	}
+	if existing, err := s.Get(version); err == nil {
+		if existing.SHA256 == info.SHA256 {
+			return BinaryInfo{}, fmt.Errorf("版本 %s 已存在", version)
+		}
+		// 同版本号的不同构建，用校验值区分
+		version += "-" + info.SHA256[:8]
+		if _, err := s.Get(version); err == nil {
+			return BinaryInfo{}, fmt.Errorf("版本 %s 已存在", version)
+		}
+	}
+
+	meta, _ := json.MarshalIndent(info, "", "  ")
+	if err := os.WriteFile(filepath.Join(tmpDir, binaryMetaFile), meta, 0644); err != nil {
+		return BinaryInfo{}, err
+	}
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return BinaryInfo{}, err
+	}
+	if err := os.Rename(tmpDir, filepath.Join(s.dir, version)); err != nil {
+		return BinaryInfo{}, err
+	}
+	return s.Get(version)
+}
+
+// Switch points the binary path at version. A binary path that is still a
+// regular file is first adopted into the store so it can be rolled back to.
+func (s *BinaryStore) Switch(version string) error {
+	info, err := s.Get(version)
+	if err != nil {
+		return err
+	}
+
+	current := s.Active()
+	if current == version {
+		return fmt.Errorf("版本 %s 已是当前版本", version)
+	}
+	if current == "" {
+		if current, err = s.adoptCurrent(); err != nil {
+			return fmt.Errorf("无法保存当前内核: %w", err)
+		}
+	}
+
+	// 先建临时链接再 rename，替换是原子的
+	tmpLink := s.binaryPath + ".switch"
+	os.Remove(tmpLink)
+	if err := os.Symlink(info.Path, tmpLink); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpLink, s.binaryPath); err != nil {
+		os.Remove(tmpLink)
+		return err
+	}
+
+	if current != "" {
+		os.WriteFile(filepath.Join(s.dir, binaryPreviousFile), []byte(current+"\n"), 0644)
+	}
+	return nil
+}
+
+// adoptCurrent copies an unmanaged binary at the binary path into the store.
+// Returns "" when there is no binary to adopt.
+func (s *BinaryStore) adoptCurrent() (string, error) {
+	data, err := os.ReadFile(s.binaryPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	output, err := BinaryVersion(s.binaryPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", err
+	}
+	tmpDir, err := os.MkdirTemp(s.dir, ".adopt-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := os.WriteFile(filepath.Join(tmpDir, "xray"), data, 0755); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	info, err := s.add(tmpDir, BinaryInfo{
+		Output:  output,
+		SHA256:  hex.EncodeToString(sum[:]),
+		Size:    int64(len(data)),
+		Source:  s.binaryPath,
+		AddedAt: time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+// Remove deletes an installed version; the active version cannot be removed
+func (s *BinaryStore) Remove(version string) error {
+	info, err := s.Get(version)
+	if err != nil {
+		return err
+	}
+	if s.Active() == version {
+		return fmt.Errorf("不能删除当前使用的版本")
+	}
+	if s.Previous() == version {
+		os.Remove(filepath.Join(s.dir, binaryPreviousFile))
+	}
+	return os.RemoveAll(filepath.Dir(info.Path))
+}
+
+// BinaryVersion runs `xray version` and returns its output
+func BinaryVersion(path string) (string, error) {
+	out, err := exec.Command(path, "version").CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		return output, fmt.Errorf("%w: %s", err, output)
+	}
+	if !xrayVersionPattern.MatchString(output) {
+		return output, fmt.Errorf("不是 Xray 可执行文件: %s", output)
+	}
+	return output, nil
+}
+
+// ParseChecksum extracts a SHA-256 hex digest from a bare digest, a
+// `sha256sum` line or the content of a release .dgst file
+func ParseChecksum(s string) (string, error) {
+	if m := sha256DigestPattern.FindStringSubmatch(s); m != nil {
+		return strings.ToLower(m[1]), nil
+	}
+	if fields := strings.Fields(s); len(fields) > 0 && sha256HexPattern.MatchString(fields[0]) {
+		return strings.ToLower(fields[0]), nil
+	}
+	return "", fmt.Errorf("请提供有效的 SHA-256 校验值（64 位十六进制或 .dgst 文件内容）")
+}
+
+// extractXrayBinary returns the xray executable from a release zip, or the
+// data itself when a bare binary was uploaded
+func extractXrayBinary(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return data, nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("无法解析压缩包: %w", err)
+	}
+	for _, f := range zr.File {
+		if name := filepath.Base(f.Name); name != "xray" && name != "xray.exe" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		binary, err := io.ReadAll(io.LimitReader(rc, MaxBinaryUpload+1))
+		if err != nil {
+			return nil, fmt.Errorf("解压失败: %w", err)
+		}
+		if len(binary) > MaxBinaryUpload {
+			return nil, fmt.Errorf("内核文件过大")
+		}
+		return binary, nil
+	}
+	return nil, fmt.Errorf("压缩包中没有 xray 可执行文件")
+}
@@ -2,8 +2,11 @@ package xray
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
+	"time"
 
+	"xray-panel/internal/logger"
 	"xray-panel/internal/models"
 )
 
@@ -12,9 +15,14 @@ type Config struct {
 	Log       *LogConfig       `json:"log,omitempty"`
 	API       *APIConfig       `json:"api,omitempty"`
 	DNS       *DNSConfig       `json:"dns,omitempty"`
+	FakeDNS   []FakeDNSPool    `json:"fakedns,omitempty"`
 	Inbounds  []InboundConfig  `json:"inbounds"`
 	Outbounds []OutboundConfig `json:"outbounds"`
 	Routing   *RoutingConfig   `json:"routing,omitempty"`
+
+	Observatory      *ObservatoryConfig      `json:"observatory,omitempty"`
+	BurstObservatory *BurstObservatoryConfig `json:"burstObservatory,omitempty"`
+
 	Policy    *PolicyConfig    `json:"policy,omitempty"`
 	Stats     *StatsConfig     `json:"stats,omitempty"`
 }
@@ -34,9 +42,18 @@ type APIConfig struct {
 
 // DNSConfig represents DNS configuration
 type DNSConfig struct {
-	Servers       []interface{} `json:"servers,omitempty"`
-	Tag           string        `json:"tag,omitempty"`
-	QueryStrategy string        `json:"queryStrategy,omitempty"`
+	Hosts         map[string]interface{} `json:"hosts,omitempty"`
+	Servers       []interface{}          `json:"servers,omitempty"`
+	ClientIP      string                 `json:"clientIp,omitempty"`
+	Tag           string                 `json:"tag,omitempty"`
+	QueryStrategy string                 `json:"queryStrategy,omitempty"`
+	DisableCache  bool                   `json:"disableCache,omitempty"`
+}
+
+// FakeDNSPool represents a FakeDNS IP pool
+type FakeDNSPool struct {
+	IPPool   string `json:"ipPool"`
+	PoolSize int    `json:"poolSize"`
 }
 
 // StatsConfig enables statistics
@@ -56,6 +73,7 @@ type PolicyLevel struct {
 	DownlinkOnly      int  `json:"downlinkOnly,omitempty"`
 	StatsUserUplink   bool `json:"statsUserUplink,omitempty"`
 	StatsUserDownlink bool `json:"statsUserDownlink,omitempty"`
+	StatsUserOnline   bool `json:"statsUserOnline,omitempty"`
 }
 
 // SystemPolicy represents system-wide policies
@@ -71,13 +89,28 @@ type Generator struct {
 	inbounds  []models.Inbound
 	outbounds []models.Outbound
 	rules     []models.RoutingRule
+	sources   []models.SubscriptionSource
+	groups    []models.OutboundGroup
 	domains   map[string]models.Domain
 	apiPort   int
 	logLevel  string
+	accessLog string
 	socketDir         string
 	panelMode         string
 	clientRoutingMode string
+	proxyGroup        string
 	directDomainStrategy string
+	probeURL             string
+	probeInterval        string
+	dnsServers           []models.DNSServer
+	dnsHosts             []models.DNSHost
+	dnsOptions           models.DNSOptions
+	fakeDNS              models.FakeDNSOptions
+	localInbounds        []models.LocalInbound
+	transparentProxy     models.TransparentProxyOptions
+	tun                  models.TunOptions
+	wgPeers              []models.WireGuardPeer
+	configPatch          string
 }
 
 // NewGenerator creates a new configuration generator
@@ -113,6 +146,69 @@ func (g *Generator) SetRoutingRules(rules []models.RoutingRule) *Generator {
 	return g
 }
 
+// SetSubscriptionSources sets the subscription sources whose group tags routing rules may target
+func (g *Generator) SetSubscriptionSources(sources []models.SubscriptionSource) *Generator {
+	g.sources = sources
+	return g
+}
+
+// SetOutboundGroups sets the outbound groups rendered as routing balancers
+func (g *Generator) SetOutboundGroups(groups []models.OutboundGroup) *Generator {
+	g.groups = groups
+	return g
+}
+
+// SetObservatory sets the probe URL and interval used for balancer health checks
+func (g *Generator) SetObservatory(probeURL, probeInterval string) *Generator {
+	g.probeURL = probeURL
+	g.probeInterval = probeInterval
+	return g
+}
+
+// SetDNS sets the admin-configured DNS servers, hosts and options
+func (g *Generator) SetDNS(servers []models.DNSServer, hosts []models.DNSHost, opts models.DNSOptions) *Generator {
+	g.dnsServers = servers
+	g.dnsHosts = hosts
+	g.dnsOptions = opts
+	return g
+}
+
+// SetFakeDNS sets the client-mode FakeDNS options
+func (g *Generator) SetFakeDNS(opts models.FakeDNSOptions) *Generator {
+	g.fakeDNS = opts
+	return g
+}
+
+// SetLocalInbounds sets the client-mode local listeners
+func (g *Generator) SetLocalInbounds(inbounds []models.LocalInbound) *Generator {
+	g.localInbounds = inbounds
+	return g
+}
+
+// SetTransparentProxy sets the client-mode TPROXY gateway options
+func (g *Generator) SetTransparentProxy(opts models.TransparentProxyOptions) *Generator {
+	g.transparentProxy = opts
+	return g
+}
+
+// SetTun sets the client-mode TUN options
+func (g *Generator) SetTun(opts models.TunOptions) *Generator {
+	g.tun = opts
+	return g
+}
+
+// SetWireGuardPeers sets the provisioned peers of the WireGuard inbounds
+func (g *Generator) SetWireGuardPeers(peers []models.WireGuardPeer) *Generator {
+	g.wgPeers = peers
+	return g
+}
+
+// SetConfigPatch sets the global override applied after generation
+func (g *Generator) SetConfigPatch(patch string) *Generator {
+	g.configPatch = patch
+	return g
+}
+
 // SetDomains sets the domain configurations
 func (g *Generator) SetDomains(domains []models.Domain) *Generator {
 	for _, d := range domains {
@@ -133,6 +229,12 @@ func (g *Generator) SetLogLevel(level string) *Generator {
 	return g
 }
 
+// SetAccessLog enables the access log at path; empty disables it
+func (g *Generator) SetAccessLog(path string) *Generator {
+	g.accessLog = path
+	return g
+}
+
 // SetSocketDir sets the directory for Unix Domain Sockets
 func (g *Generator) SetSocketDir(dir string) *Generator {
 	g.socketDir = dir
@@ -151,6 +253,13 @@ func (g *Generator) SetClientRoutingMode(mode string) *Generator {
 	return g
 }
 
+// SetClientProxyGroup sets the group used as the client default proxy
+// (empty = first outbound)
+func (g *Generator) SetClientProxyGroup(tag string) *Generator {
+	g.proxyGroup = tag
+	return g
+}
+
 // SetDirectDomainStrategy sets the domain strategy for the direct outbound
 func (g *Generator) SetDirectDomainStrategy(strategy string) *Generator {
 	if strategy == "" {
@@ -162,13 +271,19 @@ func (g *Generator) SetDirectDomainStrategy(strategy string) *Generator {
 
 // Generate creates the complete Xray configuration
 func (g *Generator) Generate() (*Config, error) {
+	// Both divert the same traffic through competing policy routes
+	if g.panelMode == "client" && g.transparentProxy.Enabled && g.tunEnabled() {
+		return nil, fmt.Errorf("transparent proxy (TPROXY) and TUN cannot be enabled at the same time")
+	}
+
 	config := &Config{
 		Log: &LogConfig{
+			Access:   g.accessLog,
 			LogLevel: g.logLevel,
 		},
 		API: &APIConfig{
 			Tag:      "api",
-			Services: []string{"HandlerService", "LoggerService", "StatsService"},
+			Services: []string{"HandlerService", "LoggerService", "StatsService", "RoutingService"},
 		},
 		Stats: &StatsConfig{},
 		Policy: &PolicyConfig{
@@ -180,6 +295,7 @@ func (g *Generator) Generate() (*Config, error) {
 					DownlinkOnly:      5,
 					StatsUserUplink:   true,
 					StatsUserDownlink: true,
+					StatsUserOnline:   true, // 在线 IP 统计，用于设备数限制
 				},
 			},
 			System: &SystemPolicy{
@@ -191,64 +307,20 @@ func (g *Generator) Generate() (*Config, error) {
 		},
 	}
 
-	if g.panelMode == "client" {
-		config.DNS = g.generateDNSForClient()
-	} else {
-		config.DNS = &DNSConfig{
-			QueryStrategy: "UseIP", // 同时查询 A 和 AAAA，支持 IPv6 出口
-			Servers: []interface{}{
-				"1.1.1.1",
-				"8.8.8.8",
-				"localhost",
-			},
-		}
-	}
+	config.DNS = g.generateDNS()
+	config.FakeDNS = g.generateFakeDNSPools()
 
 	// Generate API inbound
 	config.Inbounds = append(config.Inbounds, g.generateAPIInbound())
 
 	if g.panelMode == "client" {
-		config.Inbounds = append(config.Inbounds, InboundConfig{
-			Tag:      "dns-in",
-			Listen:   "127.0.0.1",
-			Port:     53,
-			Protocol: "dokodemo-door",
-			Settings: map[string]interface{}{
-				"address": "1.1.1.1",
-				"port":    53,
-				"network": "udp",
-			},
-		})
-
-		// Add SOCKS5 inbound
-		config.Inbounds = append(config.Inbounds, InboundConfig{
-			Tag:      "socks-in",
-			Listen:   "127.0.0.1",
-			Port:     10808,
-			Protocol: "socks",
-			Settings: map[string]interface{}{
-				"auth": "noauth",
-				"udp":  true,
-			},
-			Sniffing: &SniffingConfig{
-				Enabled:      true,
-				DestOverride: []string{"http", "tls", "quic", "fakedns"},
-				RouteOnly:    true,
-			},
-		})
-
-		// Add HTTP inbound
-		config.Inbounds = append(config.Inbounds, InboundConfig{
-			Tag:      "http-in",
-			Listen:   "127.0.0.1",
-			Port:     10809,
-			Protocol: "http",
-			Sniffing: &SniffingConfig{
-				Enabled:      true,
-				DestOverride: []string{"http", "tls", "quic", "fakedns"},
-				RouteOnly:    true,
-			},
-		})
+		config.Inbounds = append(config.Inbounds, g.generateLocalInbounds()...)
+		if g.transparentProxy.Enabled {
+			config.Inbounds = append(config.Inbounds, g.generateTProxyInbound())
+		}
+		if g.tunEnabled() {
+			config.Inbounds = append(config.Inbounds, g.generateTunInbound())
+		}
 	}
 
 	// Generate proxy inbounds
@@ -256,6 +328,11 @@ func (g *Generator) Generate() (*Config, error) {
 		if !inbound.Enabled {
 			continue
 		}
+		// 尚未添加对端的 WireGuard 入站不生成，避免整份配置失败
+		if inbound.Protocol == models.ProtocolWireGuard && inbound.WGSecretKey != "" && len(g.wgPeerSettings(inbound)) == 0 {
+			logger.Warn("Xray config: wireguard inbound %s has no peers, skipped", inbound.Tag)
+			continue
+		}
 		inboundConfig, err := g.generateInbound(inbound)
 		if err != nil {
 			return nil, err
@@ -265,6 +342,7 @@ func (g *Generator) Generate() (*Config, error) {
 
 	// Generate outbounds
 	config.Outbounds = g.generateOutbounds()
+	config.Outbounds = append(config.Outbounds, g.generateWGPeerOutbounds()...)
 
 	if g.panelMode == "client" {
 		config.Outbounds = append(config.Outbounds, OutboundConfig{
@@ -273,9 +351,24 @@ func (g *Generator) Generate() (*Config, error) {
 		})
 	}
 
+	// Xray's own connections must bypass the TUN routing
+	if g.tunEnabled() {
+		g.markOutbounds(config.Outbounds)
+	}
+
 	// Generate routing
 	config.Routing = g.generateRouting()
 
+	for _, conflict := range PortConflicts(config.Inbounds) {
+		logger.Warn("Xray config: %s", conflict)
+	}
+
+	// Health probing for leastPing / leastLoad balancers
+	config.Observatory, config.BurstObservatory = g.generateObservatories(g.balancerGroups())
+	if config.Observatory != nil || config.BurstObservatory != nil {
+		config.API.Services = append(config.API.Services, "ObservatoryService")
+	}
+
 	return config, nil
 }
 
@@ -315,13 +408,14 @@ func (g *Generator) GenerateJSON() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return json.MarshalIndent(config, "", "  ")
+	return g.applyOverrides(config, true)
 }
 
 // GenerateTestJSON builds a minimal Xray config for outbound connectivity testing.
 // It creates a simple HTTP proxy inbound on the given port, wires it to the configured
 // outbound(s), and skips the complex inbound generation (API, stats, etc.).
-func (g *Generator) GenerateTestJSON(httpProxyPort int) ([]byte, error) {
+// All test traffic is routed to outboundTag; chained upstreams are dialed via dialerProxy.
+func (g *Generator) GenerateTestJSON(httpProxyPort int, outboundTag string) ([]byte, error) {
 	// Minimal config: just log + inbound + outbound(s) + routing
 	testConfig := map[string]interface{}{
 		"log": map[string]interface{}{
@@ -338,10 +432,25 @@ func (g *Generator) GenerateTestJSON(httpProxyPort int) ([]byte, error) {
 		"outbounds": g.generateOutbounds(),
 		"routing": map[string]interface{}{
 			"domainStrategy": "IPIfNonMatch",
+			"rules": []RoutingRule{
+				{
+					Type:        "field",
+					InboundTag:  []string{"test-http-in"},
+					OutboundTag: outboundTag,
+				},
+			},
 		},
 	}
 
-	return json.MarshalIndent(testConfig, "", "  ")
+	return g.applyOverrides(testConfig, false)
+}
+
+// GenerateOutboundsJSON renders only the outbound section (direct, block and
+// the configured outbounds) as {"outbounds": [...]}, e.g. for subscription conversion
+func (g *Generator) GenerateOutboundsJSON() ([]byte, error) {
+	return json.MarshalIndent(map[string]interface{}{
+		"outbounds": g.generateOutbounds(),
+	}, "", "  ")
 }
 
 // generateAPIInbound creates the API inbound
@@ -357,11 +466,14 @@ func (g *Generator) generateAPIInbound() InboundConfig {
 	}
 }
 
-// getActiveUsers returns only active users
+// getActiveUsers returns only active users; users kicked for exceeding their
+// device limit stay out until the kick expires, so a config apply during the
+// kick does not let them back in
 func (g *Generator) getActiveUsers() []models.User {
+	now := time.Now()
 	var active []models.User
 	for _, u := range g.users {
-		if u.IsActive() {
+		if u.IsActive() && !u.KickedUntil.After(now) {
 			active = append(active, u)
 		}
 	}
@@ -0,0 +1,168 @@
+package xray
+
+import (
+	"sort"
+
+	"xray-panel/internal/models"
+)
+
+// generateDNS builds the DNS section from the admin-configured servers and
+// hosts of the current panel mode, falling back to the built-in resolvers
+// when no server is configured for the mode
+func (g *Generator) generateDNS() *DNSConfig {
+	mode := g.panelMode
+	if mode != "client" {
+		mode = "server"
+	}
+
+	var servers []models.DNSServer
+	for _, s := range g.dnsServers {
+		if !s.Enabled || !s.Scope.AppliesTo(mode) {
+			continue
+		}
+		// A fakedns server without a pool makes Xray refuse the config
+		if s.Address == "fakedns" && !g.fakeDNSEnabled() {
+			continue
+		}
+		servers = append(servers, s)
+	}
+	sort.SliceStable(servers, func(i, j int) bool {
+		return servers[i].Priority < servers[j].Priority
+	})
+
+	var dns *DNSConfig
+	if len(servers) == 0 {
+		if mode == "client" {
+			dns = g.generateDNSForClient()
+		} else {
+			dns = &DNSConfig{
+				QueryStrategy: "UseIP", // 同时查询 A 和 AAAA，支持 IPv6 出口
+				Servers: []interface{}{
+					"1.1.1.1",
+					"8.8.8.8",
+					"localhost",
+				},
+			}
+		}
+	} else {
+		dns = &DNSConfig{}
+		for _, s := range servers {
+			dns.Servers = append(dns.Servers, dnsServerEntry(s))
+		}
+	}
+
+	// With the TUN up, queries of the system resolver come back through the
+	// TUN and are hijacked to Xray's DNS again
+	if g.tunEnabled() {
+		servers := dns.Servers[:0]
+		for _, server := range dns.Servers {
+			address, _ := server.(string)
+			if entry, ok := server.(map[string]interface{}); ok {
+				address, _ = entry["address"].(string)
+			}
+			if address == "localhost" {
+				continue
+			}
+			servers = append(servers, server)
+		}
+		dns.Servers = servers
+		if len(dns.Servers) == 0 {
+			dns.Servers = []interface{}{"1.1.1.1"}
+		}
+	}
+
+	// FakeDNS answers the proxied domains first; everything else falls
+	// through to the real servers
+	if g.fakeDNSEnabled() {
+		fake := map[string]interface{}{"address": "fakedns"}
+		if domains := splitCSV(g.fakeDNS.Domains); len(domains) > 0 {
+			fake["domains"] = domains
+		}
+		dns.Servers = append([]interface{}{fake}, dns.Servers...)
+	}
+
+	if models.ValidQueryStrategy(g.dnsOptions.QueryStrategy) {
+		dns.QueryStrategy = g.dnsOptions.QueryStrategy
+	}
+	if dns.QueryStrategy == "" {
+		dns.QueryStrategy = "UseIP"
+	}
+	dns.DisableCache = g.dnsOptions.DisableCache
+	dns.ClientIP = g.dnsOptions.ClientIP
+
+	for _, h := range g.dnsHosts {
+		if !h.Enabled || !h.Scope.AppliesTo(mode) {
+			continue
+		}
+		addrs := h.AddressList()
+		if len(addrs) == 0 {
+			continue
+		}
+		if dns.Hosts == nil {
+			dns.Hosts = make(map[string]interface{})
+		}
+		if len(addrs) == 1 {
+			dns.Hosts[h.Domain] = addrs[0]
+		} else {
+			dns.Hosts[h.Domain] = addrs
+		}
+	}
+
+	return dns
+}
+
+// dnsServerEntry renders a server as a plain address or a server object
+func dnsServerEntry(s models.DNSServer) interface{} {
+	if s.IsSimple() {
+		return s.Address
+	}
+
+	entry := map[string]interface{}{
+		"address": s.Address,
+	}
+	if s.Port > 0 {
+		entry["port"] = s.Port
+	}
+	if domains := splitCSV(s.Domains); len(domains) > 0 {
+		entry["domains"] = domains
+	}
+	if ips := splitCSV(s.ExpectIPs); len(ips) > 0 {
+		entry["expectIPs"] = ips
+	}
+	if s.SkipFallback {
+		entry["skipFallback"] = true
+	}
+	if s.ClientIP != "" {
+		entry["clientIP"] = s.ClientIP
+	}
+	if models.ValidQueryStrategy(s.QueryStrategy) {
+		entry["queryStrategy"] = s.QueryStrategy
+	}
+	return entry
+}
+
+// fakeDNSEnabled reports whether FakeDNS is in effect (client mode only)
+func (g *Generator) fakeDNSEnabled() bool {
+	return g.panelMode == "client" && g.fakeDNS.Enabled && g.fakeDNS.IPv4Pool != ""
+}
+
+// generateFakeDNSPools returns the FakeDNS pools, or nil when FakeDNS is off
+func (g *Generator) generateFakeDNSPools() []FakeDNSPool {
+	if !g.fakeDNSEnabled() {
+		return nil
+	}
+	pools := []FakeDNSPool{{IPPool: g.fakeDNS.IPv4Pool, PoolSize: g.fakeDNS.IPv4PoolSize}}
+	if g.fakeDNS.IPv6Pool != "" {
+		pools = append(pools, FakeDNSPool{IPPool: g.fakeDNS.IPv6Pool, PoolSize: g.fakeDNS.IPv6PoolSize})
+	}
+	return pools
+}
+
+// fakeDNSPoolCIDRs returns the CIDRs of the FakeDNS pools
+func (g *Generator) fakeDNSPoolCIDRs() []string {
+	var cidrs []string
+	for _, pool := range g.generateFakeDNSPools() {
+		cidrs = append(cidrs, pool.IPPool)
+	}
+	return cidrs
+}
@@ -0,0 +1,101 @@
+package xray
+
+import (
+	"reflect"
+	"testing"
+
+	"xray-panel/internal/models"
+)
+
+// fakeDNSClient returns a client-mode generator with FakeDNS on and one proxy
+func fakeDNSClient() *Generator {
+	return NewGenerator().
+		SetPanelMode("client").
+		SetClientRoutingMode("white").
+		SetOutbounds([]models.Outbound{{Tag: "hk", Type: models.OutboundTrojan, Server: "hk.example.com", Port: 443, TrojanPassword: "secret", Enabled: true}}).
+		SetLocalInbounds([]models.LocalInbound{{Tag: "socks-in", Protocol: models.LocalInboundSocks, Listen: "127.0.0.1", Port: 10808, Sniffing: true, SniffingDestOverride: "http,tls", Enabled: true}}).
+		SetDNS([]models.DNSServer{{Address: "1.1.1.1", Enabled: true}}, nil, models.DNSOptions{}).
+		SetFakeDNS(models.FakeDNSOptions{
+			Enabled:      true,
+			IPv4Pool:     "198.18.0.0/15",
+			IPv4PoolSize: 65535,
+			IPv6Pool:     "fc00::/18",
+			IPv6PoolSize: 65535,
+			Domains:      "geosite:geolocation-!cn, example.org",
+		})
+}
+
+func TestFakeDNSPools(t *testing.T) {
+	config, err := fakeDNSClient().Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	want := []FakeDNSPool{{IPPool: "198.18.0.0/15", PoolSize: 65535}, {IPPool: "fc00::/18", PoolSize: 65535}}
+	if !reflect.DeepEqual(config.FakeDNS, want) {
+		t.Errorf("fakedns = %+v, want %+v", config.FakeDNS, want)
+	}
+}
+
+func TestFakeDNSServerFirst(t *testing.T) {
+	config, err := fakeDNSClient().Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if config.DNS == nil || len(config.DNS.Servers) < 2 {
+		t.Fatalf("dns servers = %+v, want fakedns followed by the real servers", config.DNS)
+	}
+	first, ok := config.DNS.Servers[0].(map[string]interface{})
+	if !ok || first["address"] != "fakedns" {
+		t.Fatalf("first dns server = %v, want fakedns", config.DNS.Servers[0])
+	}
+	if domains := first["domains"]; !reflect.DeepEqual(domains, []string{"geosite:geolocation-!cn", "example.org"}) {
+		t.Errorf("fakedns domains = %v", domains)
+	}
+}
+
+func TestFakeDNSSniffing(t *testing.T) {
+	config, err := fakeDNSClient().Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for _, in := range config.Inbounds {
+		if in.Tag != "socks-in" {
+			continue
+		}
+		if in.Sniffing == nil {
+			t.Fatal("socks-in has no sniffing")
+		}
+		if want := []string{"http", "tls", "fakedns"}; !reflect.DeepEqual(in.Sniffing.DestOverride, want) {
+			t.Errorf("destOverride = %v, want %v", in.Sniffing.DestOverride, want)
+		}
+		return
+	}
+	t.Fatal("socks-in not generated")
+}
+
+func TestFakeDNSPoolsRoutedToProxy(t *testing.T) {
+	config, err := fakeDNSClient().Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	want := []string{"198.18.0.0/15", "fc00::/18"}
+	for _, rule := range config.Routing.Rules {
+		if reflect.DeepEqual(rule.IP, want) {
+			if rule.OutboundTag != "hk" {
+				t.Errorf("fake IP rule goes to %q, want hk", rule.OutboundTag)
+			}
+			return
+		}
+	}
+	t.Errorf("no routing rule for the fake IP pools in %+v", config.Routing.Rules)
+}
+
+func TestFakeDNSServerModeOff(t *testing.T) {
+	config, err := fakeDNSClient().SetPanelMode("server").Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(config.FakeDNS) != 0 {
+		t.Errorf("server mode generated fakedns pools %+v", config.FakeDNS)
+	}
+}
@@ -28,6 +28,14 @@ type StreamSettings struct {
 	GRPCSettings    *GRPCSettings    `json:"grpcSettings,omitempty"`
 	TCPSettings     *TCPSettings     `json:"tcpSettings,omitempty"`
 	WSSettings      *WSSettings      `json:"wsSettings,omitempty"`
+	Sockopt         *SockoptConfig   `json:"sockopt,omitempty"`
+}
+
+// SockoptConfig represents socket options
+type SockoptConfig struct {
+	DialerProxy string `json:"dialerProxy,omitempty"` // dial through another outbound (chaining)
+	TProxy      string `json:"tproxy,omitempty"`      // tproxy / redirect, for transparent proxy inbounds
+	Mark        int    `json:"mark,omitempty"`        // SO_MARK of outgoing connections
 }
 
 // TLSSettings represents TLS configuration
@@ -170,17 +178,29 @@ func (g *Generator) generateInbound(inbound models.Inbound) (*InboundConfig, err
 	return config, nil
 }
 
+// UserClient returns the inbound client entry for a user, as used in the
+// generated config and by the HandlerService add-user API
+func UserClient(protocol models.Protocol, user models.User) map[string]interface{} {
+	if protocol == models.ProtocolTrojan {
+		return map[string]interface{}{
+			"password": user.UUID,
+			"email":    user.StatsKey(), // 用稳定的 stats key，不依赖可选的 Email 字段
+			"level":    0,
+		}
+	}
+	return map[string]interface{}{
+		"id":    user.UUID,
+		"flow":  "",
+		"email": user.StatsKey(), // 用稳定的 stats key，不依赖可选的 Email 字段
+		"level": 0,
+	}
+}
+
 // generateVLESSSettings generates VLESS protocol settings
 func (g *Generator) generateVLESSSettings() map[string]interface{} {
 	clients := make([]map[string]interface{}, 0)
 	for _, user := range g.getActiveUsers() {
-		client := map[string]interface{}{
-			"id":    user.UUID,
-			"flow":  "",
-			"email": user.StatsKey(), // 用稳定的 stats key，不依赖可选的 Email 字段
-			"level": 0,
-		}
-		clients = append(clients, client)
+		clients = append(clients, UserClient(models.ProtocolVLESS, user))
 	}
 
 	return map[string]interface{}{
@@ -193,12 +213,7 @@ func (g *Generator) generateVLESSSettings() map[string]interface{} {
 func (g *Generator) generateTrojanSettings() map[string]interface{} {
 	clients := make([]map[string]interface{}, 0)
 	for _, user := range g.getActiveUsers() {
-		client := map[string]interface{}{
-			"password": user.UUID,
-			"email":    user.StatsKey(), // 用稳定的 stats key，不依赖可选的 Email 字段
-			"level":    0,
-		}
-		clients = append(clients, client)
+		clients = append(clients, UserClient(models.ProtocolTrojan, user))
 	}
 
 	return map[string]interface{}{
@@ -209,13 +224,15 @@ func (g *Generator) generateTrojanSettings() map[string]interface{} {
 // generateWireGuardInbound generates a WireGuard inbound configuration.
 // WireGuard in Xray acts as a "freedom" tunnel — it receives traffic from
 // another Xray node's WireGuard outbound and routes it locally.
-// The peer is the remote xray-panel node that forwards traffic to this server.
+// Peers are remote xray-panel nodes forwarding traffic to this server (the
+// legacy single peer) and the provisioned user / relay peers.
 func (g *Generator) generateWireGuardInbound(inbound models.Inbound) (*InboundConfig, error) {
 	if inbound.WGSecretKey == "" {
 		return nil, fmt.Errorf("wireguard inbound %q: secret key is required", inbound.Tag)
 	}
-	if inbound.WGPeerPubKey == "" {
-		return nil, fmt.Errorf("wireguard inbound %q: peer public key is required", inbound.Tag)
+	peers := g.wgPeerSettings(inbound)
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("wireguard inbound %q: no peers (add a peer or set the peer public key)", inbound.Tag)
 	}
 
 	mtu := inbound.WGMTU
@@ -242,13 +259,8 @@ func (g *Generator) generateWireGuardInbound(inbound models.Inbound) (*InboundCo
 	settings := map[string]interface{}{
 		"secretKey": inbound.WGSecretKey,
 		"address":   []string{localIP},
-		"peers": []map[string]interface{}{
-			{
-				"publicKey":  inbound.WGPeerPubKey,
-				"allowedIPs": []string{"0.0.0.0/0", "::/0"},
-			},
-		},
-		"mtu": mtu,
+		"peers":     peers,
+		"mtu":       mtu,
 	}
 
 	listen := inbound.Listen
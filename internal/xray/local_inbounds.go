@@ -0,0 +1,153 @@
+package xray
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"xray-panel/internal/models"
+)
+
+// generateLocalInbounds builds the enabled client-mode local listeners
+func (g *Generator) generateLocalInbounds() []InboundConfig {
+	var inbounds []InboundConfig
+	for _, l := range g.localInbounds {
+		if !l.Enabled {
+			continue
+		}
+
+		inbound := InboundConfig{
+			Tag:      l.Tag,
+			Listen:   l.Listen,
+			Port:     l.Port,
+			Sniffing: g.localSniffing(l),
+		}
+		switch l.Protocol {
+		case models.LocalInboundDNS:
+			network := "tcp"
+			if l.UDP {
+				network = "udp"
+			}
+			inbound.Protocol = "dokodemo-door"
+			inbound.Settings = map[string]interface{}{
+				"address": "1.1.1.1",
+				"port":    53,
+				"network": network,
+			}
+		case models.LocalInboundSocks:
+			inbound.Protocol = "socks"
+			inbound.Settings = map[string]interface{}{
+				"auth": "noauth",
+				"udp":  l.UDP,
+			}
+			if l.HasAuth() {
+				inbound.Settings["auth"] = "password"
+				inbound.Settings["accounts"] = []map[string]string{{"user": l.Username, "pass": l.Password}}
+			}
+		case models.LocalInboundHTTP:
+			inbound.Protocol = "http"
+			if l.HasAuth() {
+				inbound.Settings = map[string]interface{}{
+					"accounts": []map[string]string{{"user": l.Username, "pass": l.Password}},
+				}
+			}
+		default:
+			continue
+		}
+		inbounds = append(inbounds, inbound)
+	}
+	return inbounds
+}
+
+// localSniffing returns the sniffing settings of a local inbound; the
+// fakedns sniffer is only useful when a pool exists
+func (g *Generator) localSniffing(l models.LocalInbound) *SniffingConfig {
+	if !l.Sniffing {
+		return nil
+	}
+	destOverride := l.DestOverrideList()
+	if g.fakeDNSEnabled() {
+		destOverride = append(destOverride, "fakedns")
+	}
+	return &SniffingConfig{
+		Enabled:      true,
+		DestOverride: destOverride,
+		RouteOnly:    l.SniffingRouteOnly,
+	}
+}
+
+// localDNSTags returns the tags of the enabled DNS local inbounds
+func (g *Generator) localDNSTags() []string {
+	var tags []string
+	for _, l := range g.localInbounds {
+		if l.Enabled && l.Protocol == models.LocalInboundDNS {
+			tags = append(tags, l.Tag)
+		}
+	}
+	return tags
+}
+
+// listener is one socket an inbound binds
+type listener struct {
+	tag     string
+	listen  string
+	port    int
+	network string
+}
+
+// PortConflicts reports inbounds that bind the same port and network on
+// overlapping addresses. Unix socket inbounds (port 0) are skipped.
+func PortConflicts(inbounds []InboundConfig) []string {
+	var listeners []listener
+	for _, in := range inbounds {
+		port, ok := in.Port.(int)
+		if !ok || port == 0 {
+			continue
+		}
+		for _, network := range inboundNetworks(in) {
+			listeners = append(listeners, listener{tag: in.Tag, listen: in.Listen, port: port, network: network})
+		}
+	}
+
+	var conflicts []string
+	for i, a := range listeners {
+		for _, b := range listeners[i+1:] {
+			if a.tag == b.tag || a.port != b.port || a.network != b.network || !listenOverlaps(a.listen, b.listen) {
+				continue
+			}
+			conflicts = append(conflicts, fmt.Sprintf("入站 %s 与 %s 都监听 %s 端口 %d", a.tag, b.tag, a.network, a.port))
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// inboundNetworks returns the transport protocols an inbound listens on
+func inboundNetworks(in InboundConfig) []string {
+	switch in.Protocol {
+	case "dokodemo-door":
+		if network, ok := in.Settings["network"].(string); ok && network != "" {
+			return strings.Split(strings.ReplaceAll(network, " ", ""), ",")
+		}
+		return []string{"tcp"}
+	case "socks":
+		if udp, _ := in.Settings["udp"].(bool); udp {
+			return []string{"tcp", "udp"}
+		}
+	case "wireguard":
+		return []string{"udp"}
+	}
+	return []string{"tcp"}
+}
+
+// listenOverlaps reports whether two listen addresses can collide; an empty
+// or unspecified address binds every interface
+func listenOverlaps(a, b string) bool {
+	addrA, errA := netip.ParseAddr(a)
+	addrB, errB := netip.ParseAddr(b)
+	if a == "" || b == "" || (errA == nil && addrA.IsUnspecified()) || (errB == nil && addrB.IsUnspecified()) {
+		return true
+	}
+	return a == b
+}
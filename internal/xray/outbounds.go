@@ -46,29 +46,59 @@ func (g *Generator) generateOutbounds() []OutboundConfig {
 		},
 	})
 
-	// Add configured outbounds
-	for _, outbound := range g.outbounds {
-		if !outbound.Enabled {
+	// Add configured outbounds (higher priority first)
+	for _, outbound := range g.sortedOutbounds() {
+		if !g.outboundActive(outbound) {
 			continue
 		}
 
+		var config OutboundConfig
 		switch outbound.Type {
 		case models.OutboundWireGuard:
-			outbounds = append(outbounds, g.generateWireGuardOutbound(outbound))
+			config = g.generateWireGuardOutbound(outbound)
 		case models.OutboundSOCKS5:
-			outbounds = append(outbounds, g.generateSOCKS5Outbound(outbound))
+			config = g.generateSOCKS5Outbound(outbound)
 		case models.OutboundTrojan:
-			outbounds = append(outbounds, g.generateTrojanOutbound(outbound))
+			config = g.generateTrojanOutbound(outbound)
 		case models.OutboundVLESS:
-			outbounds = append(outbounds, g.generateVLESSOutbound(outbound))
+			config = g.generateVLESSOutbound(outbound)
 		case models.OutboundVMess:
-			outbounds = append(outbounds, g.generateVMessOutbound(outbound))
+			config = g.generateVMessOutbound(outbound)
+		default:
+			continue
+		}
+
+		if outbound.DialerProxy != "" {
+			g.applyDialerProxy(&config, outbound)
 		}
+		outbounds = append(outbounds, config)
 	}
 
 	return outbounds
 }
 
+// applyDialerProxy chains an outbound through its upstream via sockopt.dialerProxy.
+// A disabled / missing upstream or a cycle sends the traffic to block instead,
+// so a broken chain never falls back to dialing the server directly.
+func (g *Generator) applyDialerProxy(config *OutboundConfig, outbound models.Outbound) {
+	enabled := make([]models.Outbound, 0, len(g.outbounds))
+	for _, o := range g.outbounds {
+		if g.outboundActive(o) {
+			enabled = append(enabled, o)
+		}
+	}
+
+	upstream := outbound.DialerProxy
+	if _, err := models.ResolveOutboundChain(enabled, outbound.Tag); err != nil {
+		upstream = "block"
+	}
+
+	if config.StreamSettings == nil {
+		config.StreamSettings = &StreamSettings{Network: "tcp"}
+	}
+	config.StreamSettings.Sockopt = &SockoptConfig{DialerProxy: upstream}
+}
+
 // generateWireGuardOutbound generates a WireGuard outbound (WARP, Proton VPN, etc.)
 func (g *Generator) generateWireGuardOutbound(outbound models.Outbound) OutboundConfig {
 	// Parse reserved bytes from JSON array format [0,0,0]
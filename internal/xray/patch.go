@@ -0,0 +1,496 @@
+package xray
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Config overrides are written either as a JSON Merge Patch (RFC 7386, a JSON
+// object) or as a JSON Patch (RFC 6902, an array of operations). They are
+// applied to the generated JSON, so they can set anything the generator does
+// not model (sockopt, mux, policy tweaks, extra inbounds, ...).
+
+// jsonPatchOp is a single RFC 6902 operation
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ValidatePatch checks that patch is a well-formed merge patch or JSON Patch.
+// An empty patch is valid and means "no override".
+func ValidatePatch(patch string) error {
+	_, err := parsePatch(patch)
+	return err
+}
+
+// ApplyPatch applies a merge patch or JSON Patch to a JSON document
+func ApplyPatch(doc []byte, patch string) ([]byte, error) {
+	value, err := decodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	value, err = applyPatchValue(value, patch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// applyPatchValue applies patch to an already decoded document
+func applyPatchValue(doc interface{}, patch string) (interface{}, error) {
+	parsed, err := parsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	switch p := parsed.(type) {
+	case nil:
+		return doc, nil
+	case []jsonPatchOp:
+		for i, op := range p {
+			if doc, err = applyPatchOp(doc, op); err != nil {
+				return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+			}
+		}
+		return doc, nil
+	default:
+		return mergePatch(doc, p), nil
+	}
+}
+
+// parsePatch decodes a patch into []jsonPatchOp (JSON Patch), a decoded
+// object (merge patch), or nil for an empty patch
+func parsePatch(patch string) (interface{}, error) {
+	patch = strings.TrimSpace(patch)
+	if patch == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(patch, "[") {
+		var ops []jsonPatchOp
+		if err := json.Unmarshal([]byte(patch), &ops); err != nil {
+			return nil, fmt.Errorf("invalid JSON Patch: %w", err)
+		}
+		for i, op := range ops {
+			if err := validatePatchOp(op); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		}
+		return ops, nil
+	}
+
+	value, err := decodeJSON([]byte(patch))
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("patch must be a JSON object (merge patch) or an array (JSON Patch)")
+	}
+	return value, nil
+}
+
+// validatePatchOp checks the shape of a JSON Patch operation
+func validatePatchOp(op jsonPatchOp) error {
+	if _, err := parsePointer(op.Path); err != nil {
+		return err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return fmt.Errorf("%q requires a value", op.Op)
+		}
+	case "remove":
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	return nil
+}
+
+// decodeJSON decodes a document keeping numbers exact
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+// mergePatch implements RFC 7386: objects merge recursively, null removes a
+// member, anything else replaces the target
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// applyPatchOp applies a single RFC 6902 operation
+func applyPatchOp(doc interface{}, op jsonPatchOp) (interface{}, error) {
+	path, _ := parsePointer(op.Path)
+
+	var value interface{}
+	if len(op.Value) > 0 {
+		var err error
+		if value, err = decodeJSON(op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, path, value)
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		doc, _, err := pointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "move":
+		from, _ := parsePointer(op.From)
+		if isPointerPrefix(from, path) && len(from) < len(path) {
+			return nil, fmt.Errorf("cannot move a value into itself")
+		}
+		doc, moved, err := pointerRemove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, moved)
+	case "copy":
+		from, _ := parsePointer(op.From)
+		src, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, deepCopyJSON(src))
+	case "test":
+		current, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, value) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// jsonEqual compares decoded JSON values; numbers are equal by value, so 1,
+// 1.0 and 1e0 match as RFC 6902 requires
+func jsonEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		rx, okx := new(big.Rat).SetString(string(x))
+		ry, oky := new(big.Rat).SetString(string(y))
+		if !okx || !oky {
+			return x == y
+		}
+		return rx.Cmp(ry) == 0
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON Pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// isPointerPrefix reports whether prefix is a leading part of path
+func isPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses an array index token; "-" is allowed (as len) when
+// appending
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if token == "-" && appending {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if appending {
+		max = length
+	}
+	if idx > max {
+		return 0, fmt.Errorf("array index %d out of range", idx)
+	}
+	return idx, nil
+}
+
+// pointerGet returns the value at path
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path not found: %s", token)
+			}
+			doc = child
+		case []interface{}:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[idx]
+		default:
+			return nil, fmt.Errorf("path not found: %s", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd inserts value at path and returns the updated document
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("path not found: %s", token)
+		}
+		updated, err := pointerAdd(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = updated
+		return node, nil
+	case []interface{}:
+		idx, err := arrayIndex(token, len(node), len(rest) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = value
+			return node, nil
+		}
+		updated, err := pointerAdd(node[idx], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		node[idx] = updated
+		return node, nil
+	}
+	return nil, fmt.Errorf("path not found: %s", token)
+}
+
+// pointerRemove deletes the value at path and returns the updated document
+// along with the removed value
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+	token, rest := path[0], path[1:]
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path not found: %s", token)
+		}
+		if len(rest) == 0 {
+			delete(node, token)
+			return node, child, nil
+		}
+		updated, removed, err := pointerRemove(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = updated
+		return node, removed, nil
+	case []interface{}:
+		idx, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := node[idx]
+			return append(node[:idx], node[idx+1:]...), removed, nil
+		}
+		updated, removed, err := pointerRemove(node[idx], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[idx] = updated
+		return node, removed, nil
+	}
+	return nil, nil, fmt.Errorf("path not found: %s", token)
+}
+
+// deepCopyJSON copies a decoded JSON value
+func deepCopyJSON(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(node))
+		for k, child := range node {
+			out[k] = deepCopyJSON(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(node))
+		for i, child := range node {
+			out[i] = deepCopyJSON(child)
+		}
+		return out
+	}
+	return v
+}
+
+// applyOverrides renders config as indented JSON after applying the per-inbound
+// and per-outbound advanced JSON and, when global is set, the global patch
+func (g *Generator) applyOverrides(config interface{}, global bool) ([]byte, error) {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.(map[string]interface{})
+
+	inboundPatches := make(map[string]string)
+	for _, in := range g.inbounds {
+		if in.Enabled && strings.TrimSpace(in.AdvancedJSON) != "" {
+			inboundPatches[in.Tag] = in.AdvancedJSON
+		}
+	}
+	if err := patchTaggedObjects(root, "inbounds", inboundPatches); err != nil {
+		return nil, fmt.Errorf("inbound %w", err)
+	}
+
+	outboundPatches := make(map[string]string)
+	for _, out := range g.outbounds {
+		if g.outboundActive(out) && strings.TrimSpace(out.AdvancedJSON) != "" {
+			outboundPatches[out.Tag] = out.AdvancedJSON
+		}
+	}
+	if err := patchTaggedObjects(root, "outbounds", outboundPatches); err != nil {
+		return nil, fmt.Errorf("outbound %w", err)
+	}
+
+	if global {
+		if doc, err = applyPatchValue(doc, g.configPatch); err != nil {
+			return nil, fmt.Errorf("global override: %w", err)
+		}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// patchTaggedObjects applies patches (by tag) to the objects of root[key]
+func patchTaggedObjects(root map[string]interface{}, key string, patches map[string]string) error {
+	if len(patches) == 0 {
+		return nil
+	}
+	items, _ := root[key].([]interface{})
+	for i, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		tag, _ := obj["tag"].(string)
+		patch, ok := patches[tag]
+		if !ok {
+			continue
+		}
+		patched, err := applyPatchValue(obj, patch)
+		if err != nil {
+			return fmt.Errorf("%s advanced JSON: %w", tag, err)
+		}
+		items[i] = patched
+	}
+	return nil
+}
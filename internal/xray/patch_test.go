@@ -0,0 +1,110 @@
+package xray
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	const doc = `{"log":{"loglevel":"warning"},"list":[1,2,3],"a/b":1,"m~n":2,"n":1}`
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+		err   string
+	}{
+		{"add member", `[{"op":"add","path":"/log/access","value":"none"}]`, `{"log":{"loglevel":"warning","access":"none"},"list":[1,2,3],"a/b":1,"m~n":2,"n":1}`, ""},
+		{"add array index", `[{"op":"add","path":"/list/1","value":9}]`, `{"log":{"loglevel":"warning"},"list":[1,9,2,3],"a/b":1,"m~n":2,"n":1}`, ""},
+		{"add append", `[{"op":"add","path":"/list/-","value":4}]`, `{"log":{"loglevel":"warning"},"list":[1,2,3,4],"a/b":1,"m~n":2,"n":1}`, ""},
+		{"add out of range", `[{"op":"add","path":"/list/5","value":4}]`, "", "index"},
+		{"remove", `[{"op":"remove","path":"/list/0"}]`, `{"log":{"loglevel":"warning"},"list":[2,3],"a/b":1,"m~n":2,"n":1}`, ""},
+		{"remove dash", `[{"op":"remove","path":"/list/-"}]`, "", "index"},
+		{"remove missing", `[{"op":"remove","path":"/nope"}]`, "", "not found"},
+		{"replace", `[{"op":"replace","path":"/log/loglevel","value":"debug"}]`, `{"log":{"loglevel":"debug"},"list":[1,2,3],"a/b":1,"m~n":2,"n":1}`, ""},
+		{"replace missing", `[{"op":"replace","path":"/log/access","value":"none"}]`, "", "not found"},
+		{"move", `[{"op":"move","from":"/list","path":"/log/list"}]`, `{"log":{"loglevel":"warning","list":[1,2,3]},"a/b":1,"m~n":2,"n":1}`, ""},
+		{"move into own child", `[{"op":"move","from":"/log","path":"/log/inner"}]`, "", "itself"},
+		{"copy", `[{"op":"copy","from":"/log","path":"/copy"}]`, `{"log":{"loglevel":"warning"},"copy":{"loglevel":"warning"},"list":[1,2,3],"a/b":1,"m~n":2,"n":1}`, ""},
+		{"test", `[{"op":"test","path":"/log/loglevel","value":"warning"}]`, doc, ""},
+		{"test failed", `[{"op":"test","path":"/log/loglevel","value":"debug"}]`, "", "test failed"},
+		{"test number 1.0", `[{"op":"test","path":"/n","value":1.0}]`, doc, ""},
+		{"test number 1e0", `[{"op":"test","path":"/list","value":[1e0,2,3]}]`, doc, ""},
+		{"test number differs", `[{"op":"test","path":"/n","value":1.5}]`, "", "test failed"},
+		{"escaped slash", `[{"op":"replace","path":"/a~1b","value":5}]`, `{"log":{"loglevel":"warning"},"list":[1,2,3],"a/b":5,"m~n":2,"n":1}`, ""},
+		{"escaped tilde", `[{"op":"remove","path":"/m~0n"}]`, `{"log":{"loglevel":"warning"},"list":[1,2,3],"a/b":1,"n":1}`, ""},
+		{"error names the operation", `[{"op":"remove","path":"/n"},{"op":"test","path":"/log","value":null}]`, "", "operation 1"},
+		{"merge null deletes", `{"log":null,"list":[7],"new":{"x":1}}`, `{"list":[7],"a/b":1,"m~n":2,"n":1,"new":{"x":1}}`, ""},
+		{"merge nested", `{"log":{"loglevel":"debug","access":"none"}}`, `{"log":{"loglevel":"debug","access":"none"},"list":[1,2,3],"a/b":1,"m~n":2,"n":1}`, ""},
+		{"merge null inside new object", `{"new":{"x":null,"y":1}}`, `{"log":{"loglevel":"warning"},"list":[1,2,3],"a/b":1,"m~n":2,"n":1,"new":{"y":1}}`, ""},
+		{"not an object", `"x"`, "", "JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ApplyPatch([]byte(doc), tt.patch)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			assertJSON(t, out, tt.want)
+		})
+	}
+}
+
+func TestPatchTaggedObjects(t *testing.T) {
+	config := `{
+		"inbounds":[{"tag":"vless-in","port":443},{"tag":"socks-in","port":1080}],
+		"outbounds":[{"tag":"direct","protocol":"freedom"},{"tag":"hk","protocol":"trojan"}]
+	}`
+	doc, err := decodeJSON([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := doc.(map[string]interface{})
+
+	if err := patchTaggedObjects(root, "inbounds", map[string]string{
+		"vless-in": `{"sniffing":{"enabled":true}}`,
+		"missing":  `{"port":1}`,
+	}); err != nil {
+		t.Fatalf("patch inbounds: %v", err)
+	}
+	if err := patchTaggedObjects(root, "outbounds", map[string]string{
+		"hk": `[{"op":"add","path":"/mux","value":{"enabled":true}}]`,
+	}); err != nil {
+		t.Fatalf("patch outbounds: %v", err)
+	}
+	out, err := json.Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, out, `{
+		"inbounds":[{"tag":"vless-in","port":443,"sniffing":{"enabled":true}},{"tag":"socks-in","port":1080}],
+		"outbounds":[{"tag":"direct","protocol":"freedom"},{"tag":"hk","protocol":"trojan","mux":{"enabled":true}}]
+	}`)
+
+	err = patchTaggedObjects(root, "outbounds", map[string]string{"hk": `[{"op":"remove","path":"/nope"}]`})
+	if err == nil || !strings.HasPrefix(err.Error(), "hk advanced JSON") {
+		t.Errorf("err = %v, want it to name the outbound", err)
+	}
+}
+
+// assertJSON compares two JSON documents by value
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	g, err := decodeJSON(got)
+	if err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	w, err := decodeJSON([]byte(want))
+	if err != nil {
+		t.Fatalf("decode want: %v", err)
+	}
+	if !jsonEqual(g, w) {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,286 @@
+package xray
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"xray-panel/internal/logger"
+)
+
+const (
+	// processOutputLines is the number of recent output lines kept
+	processOutputLines = 100
+	// processStopTimeout is how long a graceful stop waits before killing
+	processStopTimeout = 10 * time.Second
+	// processStableAfter resets the crash backoff once Xray has run this long
+	processStableAfter = time.Minute
+	// processMaxBackoff caps the delay between crash restarts
+	processMaxBackoff = time.Minute
+)
+
+// Process runs Xray as a supervised child process: output goes to the panel
+// logger, crashes are restarted with exponential backoff.
+type Process struct {
+	binary     string
+	configPath string
+	assetsPath string
+
+	mu        sync.Mutex
+	enabled   bool // false after Stop, suppresses crash restarts
+	cmd       *exec.Cmd
+	exited    chan struct{}
+	startedAt time.Time
+	timer     *time.Timer
+	backoff   time.Duration
+
+	restarts    int
+	lastExit    string
+	lastExitAt  time.Time
+	crashOutput []string
+	output      []string
+}
+
+// ProcessStatus is a snapshot of the supervised Xray process
+type ProcessStatus struct {
+	Running      bool      `json:"running"`
+	PID          int       `json:"pid"`
+	StartedAt    time.Time `json:"started_at"`
+	Uptime       string    `json:"uptime"`
+	Restarts     int       `json:"restarts"`
+	LastExit     string    `json:"last_exit"`
+	LastExitAt   time.Time `json:"last_exit_at"`
+	CrashOutput  []string  `json:"crash_output"`
+	RecentOutput []string  `json:"recent_output"`
+}
+
+// NewProcess creates a supervisor for `xray run -c configPath`
+func NewProcess(binary, configPath, assetsPath string) *Process {
+	if binary == "" {
+		binary = "/usr/local/bin/xray"
+	}
+	return &Process{binary: binary, configPath: configPath, assetsPath: assetsPath}
+}
+
+// Start starts Xray if it is not running
+func (p *Process) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enabled = true
+	return p.startLocked()
+}
+
+// Stop stops Xray gracefully and disables crash restarts
+func (p *Process) Stop() {
+	p.mu.Lock()
+	p.enabled = false
+	cmd, exited := p.detachLocked()
+	p.mu.Unlock()
+
+	terminate(cmd, exited)
+}
+
+// Restart stops Xray gracefully and starts it again with the current config
+func (p *Process) Restart() error {
+	p.mu.Lock()
+	p.enabled = true
+	cmd, exited := p.detachLocked()
+	p.mu.Unlock()
+
+	terminate(cmd, exited)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backoff = 0
+	return p.startLocked()
+}
+
+// Status returns the current process state
+func (p *Process) Status() ProcessStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := ProcessStatus{
+		Running:      p.cmd != nil,
+		Restarts:     p.restarts,
+		LastExit:     p.lastExit,
+		LastExitAt:   p.lastExitAt,
+		CrashOutput:  append([]string(nil), p.crashOutput...),
+		RecentOutput: append([]string(nil), p.output...),
+	}
+	if p.cmd != nil {
+		status.PID = p.cmd.Process.Pid
+		status.StartedAt = p.startedAt
+		status.Uptime = time.Since(p.startedAt).Round(time.Second).String()
+	}
+	return status
+}
+
+// startLocked starts the process; on failure a retry is scheduled
+func (p *Process) startLocked() error {
+	if p.cmd != nil || !p.enabled {
+		return nil
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	cmd := exec.Command(p.binary, "run", "-c", p.configPath)
+	cmd.Env = os.Environ()
+	if p.assetsPath != "" {
+		cmd.Env = append(cmd.Env, "XRAY_LOCATION_ASSET="+p.assetsPath)
+	}
+	out := &processWriter{p: p}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Start(); err != nil {
+		p.lastExit = "启动失败: " + err.Error()
+		p.lastExitAt = time.Now()
+		logger.Error("Failed to start Xray: %v", err)
+		p.scheduleRestartLocked()
+		return err
+	}
+
+	exited := make(chan struct{})
+	p.cmd, p.exited, p.startedAt = cmd, exited, time.Now()
+	p.output = nil // crash output covers only the run that crashed
+	logger.Info("Xray started (pid %d)", cmd.Process.Pid)
+
+	go p.wait(cmd, exited, out)
+	return nil
+}
+
+// wait reaps the process and restarts it if it exited on its own
+func (p *Process) wait(cmd *exec.Cmd, exited chan struct{}, out *processWriter) {
+	err := cmd.Wait()
+	out.flush()
+	close(exited)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd != cmd {
+		return // stopped or restarted on purpose
+	}
+	p.cmd = nil
+
+	uptime := time.Since(p.startedAt)
+	if err == nil {
+		err = fmt.Errorf("exit status 0")
+	}
+	p.restarts++
+	p.lastExit = err.Error()
+	p.lastExitAt = time.Now()
+	p.crashOutput = append([]string(nil), p.output...)
+
+	if uptime >= processStableAfter {
+		p.backoff = 0
+	}
+	logger.Error("Xray exited unexpectedly after %v: %v", uptime.Round(time.Second), err)
+	p.scheduleRestartLocked()
+}
+
+// scheduleRestartLocked restarts the process after the next backoff delay
+func (p *Process) scheduleRestartLocked() {
+	if !p.enabled {
+		return
+	}
+	if p.backoff == 0 {
+		p.backoff = time.Second
+	} else {
+		p.backoff = min(p.backoff*2, processMaxBackoff)
+	}
+	logger.Warn("Restarting Xray in %v", p.backoff)
+
+	p.timer = time.AfterFunc(p.backoff, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.timer = nil
+		p.startLocked()
+	})
+}
+
+// detachLocked takes the running process out of supervision so its exit is
+// not treated as a crash
+func (p *Process) detachLocked() (*exec.Cmd, chan struct{}) {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	cmd, exited := p.cmd, p.exited
+	p.cmd, p.exited = nil, nil
+	return cmd, exited
+}
+
+// terminate sends SIGTERM and kills the process if it does not exit in time
+func terminate(cmd *exec.Cmd, exited chan struct{}) {
+	if cmd == nil {
+		return
+	}
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		cmd.Process.Kill()
+	}
+	select {
+	case <-exited:
+	case <-time.After(processStopTimeout):
+		logger.Warn("Xray did not stop within %v, killing", processStopTimeout)
+		cmd.Process.Kill()
+		<-exited
+	}
+	logger.Info("Xray stopped (pid %d)", cmd.Process.Pid)
+}
+
+// processWriter forwards Xray output to the logger line by line and keeps
+// the most recent lines for the status API
+type processWriter struct {
+	p   *Process
+	buf []byte
+}
+
+func (w *processWriter) Write(data []byte) (int, error) {
+	w.buf = append(w.buf, data...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(string(bytes.TrimRight(w.buf[:i], "\r")))
+		w.buf = w.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// flush emits a trailing line without newline
+func (w *processWriter) flush() {
+	if len(w.buf) > 0 {
+		w.line(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *processWriter) line(line string) {
+	if line == "" {
+		return
+	}
+	switch {
+	case strings.Contains(line, "[Error]"):
+		logger.Error("[xray] %s", line)
+	case strings.Contains(line, "[Warning]"):
+		logger.Warn("[xray] %s", line)
+	default:
+		logger.Info("[xray] %s", line)
+	}
+
+	w.p.mu.Lock()
+	w.p.output = append(w.p.output, line)
+	if len(w.p.output) > processOutputLines {
+		w.p.output = w.p.output[len(w.p.output)-processOutputLines:]
+	}
+	w.p.mu.Unlock()
+}
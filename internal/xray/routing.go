@@ -2,6 +2,7 @@ package xray
 
 import (
 	"sort"
+	"strings"
 
 	"xray-panel/internal/models"
 )
@@ -11,18 +12,38 @@ type RoutingConfig struct {
 	DomainStrategy string        `json:"domainStrategy"`
 	DomainMatcher  string        `json:"domainMatcher,omitempty"`
 	Rules          []RoutingRule `json:"rules"`
+	Balancers      []Balancer    `json:"balancers,omitempty"`
+}
+
+// Balancer represents an Xray routing balancer over a group of outbounds
+type Balancer struct {
+	Tag         string            `json:"tag"`
+	Selector    []string          `json:"selector"`
+	FallbackTag string            `json:"fallbackTag,omitempty"`
+	Strategy    *BalancerStrategy `json:"strategy,omitempty"`
+}
+
+// BalancerStrategy represents the selection strategy of a balancer
+type BalancerStrategy struct {
+	Type     string                 `json:"type"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
 }
 
 // RoutingRule represents a single routing rule
 type RoutingRule struct {
-	Type        string   `json:"type"`
-	Domain      []string `json:"domain,omitempty"`
-	IP          []string `json:"ip,omitempty"`
-	Port        string   `json:"port,omitempty"`
-	Network     string   `json:"network,omitempty"`
-	Protocol    []string `json:"protocol,omitempty"`
-	InboundTag  []string `json:"inboundTag,omitempty"`
-	OutboundTag string   `json:"outboundTag"`
+	Type        string            `json:"type"`
+	Domain      []string          `json:"domain,omitempty"`
+	IP          []string          `json:"ip,omitempty"`
+	Port        string            `json:"port,omitempty"`
+	SourcePort  string            `json:"sourcePort,omitempty"`
+	Source      []string          `json:"source,omitempty"`
+	Network     string            `json:"network,omitempty"`
+	Protocol    []string          `json:"protocol,omitempty"`
+	User        []string          `json:"user,omitempty"`
+	Attrs       map[string]string `json:"attrs,omitempty"`
+	InboundTag  []string          `json:"inboundTag,omitempty"`
+	OutboundTag string            `json:"outboundTag,omitempty"`
+	BalancerTag string            `json:"balancerTag,omitempty"`
 }
 
 // generateRouting generates the routing configuration
@@ -33,6 +54,10 @@ func (g *Generator) generateRouting() *RoutingConfig {
 		Rules:          make([]RoutingRule, 0),
 	}
 
+	// Subscription sources and outbound groups are rendered as balancers
+	groups := g.balancerGroups()
+	routing.Balancers = g.generateBalancers(groups)
+
 	// Add API routing rule first
 	routing.Rules = append(routing.Rules, RoutingRule{
 		Type:        "field",
@@ -40,43 +65,74 @@ func (g *Generator) generateRouting() *RoutingConfig {
 		OutboundTag: "api",
 	})
 
+	// WireGuard peers go through their loopback outbounds for traffic stats
+	routing.Rules = append(routing.Rules, g.generateWGPeerRules()...)
+
 	if g.panelMode == "client" {
 		// Route upstream proxy DNS to the primary configured wireguard/trojan/socks proxy
 		// This uses string literal to avoid depending heavily on user input formatting.
-		proxyTag := "proxy"
-		if len(g.outbounds) > 0 {
-			proxyTag = g.outbounds[0].Tag
+		proxyTag := g.primaryProxyTag()
+		toProxy := func(rule RoutingRule) RoutingRule {
+			setRuleTarget(&rule, proxyTag, groups)
+			return rule
 		}
 
 		// Route intercepted 53 DNS to Xray internal DNS process
-		routing.Rules = append(routing.Rules, RoutingRule{
-			Type:        "field",
-			InboundTag:  []string{"dns-in"},
-			OutboundTag: "dns-out",
-		})
+		if tags := g.localDNSTags(); len(tags) > 0 {
+			routing.Rules = append(routing.Rules, RoutingRule{
+				Type:        "field",
+				InboundTag:  tags,
+				OutboundTag: "dns-out",
+			})
+		}
+
+		// DNS queries intercepted by the gateway or the TUN
+		var hijackTags []string
+		if g.transparentProxy.Enabled {
+			hijackTags = append(hijackTags, models.TransparentProxyTag)
+		}
+		if g.tunEnabled() {
+			hijackTags = append(hijackTags, models.TunTag)
+		}
+		if len(hijackTags) > 0 {
+			routing.Rules = append(routing.Rules, RoutingRule{
+				Type:        "field",
+				InboundTag:  hijackTags,
+				Port:        "53",
+				Network:     "udp",
+				OutboundTag: "dns-out",
+			})
+		}
 
 		// DNS server IPs routing (Remote -> Proxy, Local -> Direct)
-		routing.Rules = append(routing.Rules, RoutingRule{
-			Type:        "field",
-			IP:          []string{"1.1.1.1", "1.0.0.1", "8.8.8.8", "8.8.4.4"},
-			OutboundTag: proxyTag,
-		})
+		routing.Rules = append(routing.Rules, toProxy(RoutingRule{
+			Type: "field",
+			IP:   []string{"1.1.1.1", "1.0.0.1", "8.8.8.8", "8.8.4.4"},
+		}))
 		routing.Rules = append(routing.Rules, RoutingRule{
 			Type:        "field",
 			IP:          []string{"223.5.5.5", "223.6.6.6"},
 			OutboundTag: "direct",
 		})
 
+		// Fake IPs the sniffer could not map back to a domain (e.g. evicted
+		// from the pool) must never leave via direct
+		if cidrs := g.fakeDNSPoolCIDRs(); len(cidrs) > 0 {
+			routing.Rules = append(routing.Rules, toProxy(RoutingRule{
+				Type: "field",
+				IP:   cidrs,
+			}))
+		}
+
 		// Handle specific client routing modes
 		switch g.clientRoutingMode {
 		case "white":
 			routing.Rules = append(routing.Rules, getWhiteRoutingRules()...)
 			// White mode needs a proxy catch-all at the end
-			routing.Rules = append(routing.Rules, RoutingRule{
-				Type:        "field",
-				Port:        "0-65535",
-				OutboundTag: proxyTag,
-			})
+			routing.Rules = append(routing.Rules, toProxy(RoutingRule{
+				Type: "field",
+				Port: "0-65535",
+			}))
 			return routing
 		case "black":
 			routing.Rules = append(routing.Rules, getBlackRoutingRules()...)
@@ -104,80 +160,133 @@ func (g *Generator) generateRouting() *RoutingConfig {
 	})
 
 	// Convert model rules to Xray rules
+	inactive := make(map[string]bool)
+	for _, o := range g.outbounds {
+		if o.Enabled && !g.outboundActive(o) {
+			inactive[o.Tag] = true
+		}
+	}
+	egressAdded := false
 	for _, rule := range sortedRules {
 		if !rule.Enabled {
 			continue
 		}
 
-		xrayRule := RoutingRule{
-			Type:        "field",
-			OutboundTag: rule.OutboundTag,
+		xrayRule := RoutingRule{Type: "field"}
+		setRuleTarget(&xrayRule, rule.OutboundTag, groups)
+		// 已停用订阅源的节点不生成，指向它们的规则改为阻断
+		if inactive[rule.OutboundTag] {
+			xrayRule.OutboundTag = "block"
 		}
 
-		switch rule.Type {
-		case models.RuleTypeInbound:
-			// Inbound-based routing
-			if rule.InboundTag != "" {
-				xrayRule.InboundTag = []string{rule.InboundTag}
-			} else {
-				continue // Skip if no inbound tag specified
-			}
-
-		case models.RuleTypeDomain:
-			domains := splitCSV(rule.Domains)
-			if len(domains) > 0 {
-				xrayRule.Domain = domains
-			} else {
-				continue // Skip empty domain rules
-			}
-
-		case models.RuleTypeIP:
-			ips := splitCSV(rule.IPs)
-			if len(ips) > 0 {
-				xrayRule.IP = ips
-			} else {
-				continue
-			}
-
-		case models.RuleTypeGeoSite:
-			tags := splitCSV(rule.GeoSiteTags)
-			if len(tags) > 0 {
-				domains := make([]string, len(tags))
-				for i, tag := range tags {
-					domains[i] = "geosite:" + tag
-				}
-				xrayRule.Domain = domains
-			} else {
-				continue
-			}
-
-		case models.RuleTypeGeoIP:
-			codes := splitCSV(rule.GeoIPCodes)
-			if len(codes) > 0 {
-				ips := make([]string, len(codes))
-				for i, code := range codes {
-					ips[i] = "geoip:" + code
-				}
-				xrayRule.IP = ips
-			} else {
-				continue
-			}
-
-		case models.RuleTypeProtocol:
-			protocols := splitCSV(rule.Protocols)
-			if len(protocols) > 0 {
-				xrayRule.Protocol = protocols
-			} else {
-				continue
-			}
+		// All conditions are combined into one Xray rule (AND)
+		rule.Normalize()
+		if !rule.HasCondition() {
+			continue // Skip rules without any condition
 		}
+		applyRuleConditions(&xrayRule, rule)
+		xrayRule.InboundTag = g.expandWGInboundTags(xrayRule.InboundTag)
 
+		// Per-user egress goes before the first catch-all rule, i.e. after
+		// block and destination rules; admin rule order is kept as is
+		if rule.IsCatchAll() && !egressAdded {
+			routing.Rules = append(routing.Rules, g.generateUserEgressRules(groups)...)
+			egressAdded = true
+		}
 		routing.Rules = append(routing.Rules, xrayRule)
 	}
+	if !egressAdded {
+		routing.Rules = append(routing.Rules, g.generateUserEgressRules(groups)...)
+	}
 
 	return routing
 }
 
+// setRuleTarget points a rule at an outbound tag, or at a balancer when tag
+// names a group. Empty groups are blocked (never leak to direct).
+func setRuleTarget(xrayRule *RoutingRule, tag string, groups map[string][]string) {
+	xrayRule.OutboundTag = tag
+	xrayRule.BalancerTag = ""
+	if members, ok := groups[tag]; ok {
+		xrayRule.OutboundTag = ""
+		xrayRule.BalancerTag = tag
+		if len(members) == 0 {
+			xrayRule.OutboundTag = "block"
+			xrayRule.BalancerTag = ""
+		}
+	}
+}
+
+// generateUserEgressRules routes the traffic of active users with an egress
+// tag through that outbound or group (Xray "user" matches User.StatsKey()).
+// Their WireGuard peers are matched by the peer inbound tags in a second rule.
+// An egress pointing at a missing or disabled outbound is blocked.
+func (g *Generator) generateUserEgressRules(groups map[string][]string) []RoutingRule {
+	known := map[string]bool{"direct": true, "block": true}
+	for _, o := range g.outbounds {
+		if g.outboundActive(o) {
+			known[o.Tag] = true
+		}
+	}
+
+	byTag := make(map[string][]string)
+	peerTags := make(map[string][]string) // WireGuard 对端按入站标签匹配
+	for _, u := range g.getActiveUsers() {
+		if u.EgressTag != "" {
+			byTag[u.EgressTag] = append(byTag[u.EgressTag], u.StatsKey())
+			peerTags[u.EgressTag] = append(peerTags[u.EgressTag], g.wgUserPeerTags(u.ID)...)
+		}
+	}
+
+	tags := make([]string, 0, len(byTag))
+	for tag := range byTag {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	rules := make([]RoutingRule, 0, len(tags))
+	for _, tag := range tags {
+		rule := RoutingRule{Type: "field", User: byTag[tag]}
+		peers := peerTags[tag]
+		if _, isGroup := groups[tag]; !isGroup && !known[tag] {
+			tag = "block"
+		}
+		setRuleTarget(&rule, tag, groups)
+		rules = append(rules, rule)
+		if len(peers) > 0 {
+			peerRule := rule
+			peerRule.User, peerRule.InboundTag = nil, peers
+			rules = append(rules, peerRule)
+		}
+	}
+	return rules
+}
+
+// applyRuleConditions copies the conditions of a model rule into an Xray rule
+func applyRuleConditions(xrayRule *RoutingRule, rule models.RoutingRule) {
+	xrayRule.InboundTag = splitCSV(rule.InboundTag)
+
+	xrayRule.Domain = splitCSV(rule.Domains)
+	for _, tag := range splitCSV(rule.GeoSiteTags) {
+		xrayRule.Domain = append(xrayRule.Domain, "geosite:"+tag)
+	}
+
+	xrayRule.IP = splitCSV(rule.IPs)
+	for _, code := range splitCSV(rule.GeoIPCodes) {
+		xrayRule.IP = append(xrayRule.IP, "geoip:"+code)
+	}
+
+	xrayRule.Protocol = splitCSV(rule.Protocols)
+	xrayRule.User = splitCSV(rule.Users)
+	xrayRule.Source = splitCSV(rule.SourceIPs)
+	xrayRule.Port = strings.Join(splitCSV(rule.Port), ",")
+	xrayRule.SourcePort = strings.Join(splitCSV(rule.SourcePort), ",")
+	xrayRule.Network = strings.Join(splitCSV(rule.Network), ",")
+	if attrs := rule.AttrsMap(); len(attrs) > 0 {
+		xrayRule.Attrs = attrs
+	}
+}
+
 // getBlackRoutingRules returns v2rayN custom_routing_black rules (Bypass Mainland / Proxy Blocked Sites)
 func getBlackRoutingRules() []RoutingRule {
 	return []RoutingRule{
@@ -0,0 +1,498 @@
+package xray
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"xray-panel/internal/geodata"
+)
+
+// SimulateRequest describes a connection to run through the routing rules.
+// Domain is the (sniffed) target domain, IP the destination address; at
+// least one of them is required.
+type SimulateRequest struct {
+	Domain     string `json:"domain" form:"domain"`
+	IP         string `json:"ip" form:"ip"`
+	Port       int    `json:"port" form:"port"`       // 0 = 443
+	Network    string `json:"network" form:"network"` // tcp / udp, empty = tcp
+	InboundTag string `json:"inbound_tag" form:"inbound_tag"`
+	Protocol   string `json:"protocol" form:"protocol"` // sniffed protocol: http, tls, quic, bittorrent
+	User       string `json:"user" form:"user"`         // user email (stats key)
+	SourceIP   string `json:"source_ip" form:"source_ip"`
+}
+
+// SimulateStep is the result of evaluating one rule
+type SimulateStep struct {
+	Index   int         `json:"index"` // position in routing.rules, from 0
+	Rule    RoutingRule `json:"rule"`
+	Matched bool        `json:"matched"`
+	Reason  string      `json:"reason"` // matched conditions, or the first condition that failed
+}
+
+// SimulateResult is where Xray would send the connection
+type SimulateResult struct {
+	Outbound    string         `json:"outbound,omitempty"`
+	Balancer    string         `json:"balancer,omitempty"`
+	Candidates  []string       `json:"candidates,omitempty"` // balancer members, the strategy picks one
+	RuleIndex   int            `json:"rule_index"`           // -1 = no rule matched
+	ResolvedIPs []string       `json:"resolved_ips,omitempty"`
+	Steps       []SimulateStep `json:"steps"`
+	Explanation []string       `json:"explanation"`
+}
+
+// Simulation evaluates the routing section of an Xray config the way Xray
+// does: rules are tried in order, all conditions of a rule must match, and
+// unmatched traffic goes to the first outbound.
+type Simulation struct {
+	Routing   RoutingConfig
+	Outbounds []string // outbound tags in config order
+
+	geo *geodata.GeoDataParser
+	// Resolve looks up a domain for IPIfNonMatch / IPOnDemand
+	Resolve func(domain string) ([]netip.Addr, error)
+}
+
+// NewSimulation loads the routing and outbounds from a config JSON.
+// geosite / geoip / ext: references are read from assetsPath.
+func NewSimulation(configJSON []byte, assetsPath string) (*Simulation, error) {
+	var cfg struct {
+		Outbounds []struct {
+			Tag string `json:"tag"`
+		} `json:"outbounds"`
+		Routing RoutingConfig `json:"routing"`
+	}
+	if err := json.Unmarshal(configJSON, &cfg); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+
+	sim := &Simulation{
+		Routing: cfg.Routing,
+		geo:     geodata.NewGeoDataParser(assetsPath),
+		Resolve: resolveDomain,
+	}
+	for _, o := range cfg.Outbounds {
+		sim.Outbounds = append(sim.Outbounds, o.Tag)
+	}
+	return sim, nil
+}
+
+// simTarget is a request with parsed addresses
+type simTarget struct {
+	SimulateRequest
+	ips    []netip.Addr
+	source netip.Addr
+}
+
+// Run evaluates the request against the rules
+func (s *Simulation) Run(req SimulateRequest) (*SimulateResult, error) {
+	req.Domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(req.Domain), "."))
+	req.Network = strings.ToLower(strings.TrimSpace(req.Network))
+	if req.Network == "" {
+		req.Network = "tcp"
+	}
+	if req.Port == 0 {
+		req.Port = 443
+	}
+
+	t := simTarget{SimulateRequest: req}
+	if ip := strings.TrimSpace(req.IP); ip != "" {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 IP: %s", ip)
+		}
+		t.ips = []netip.Addr{addr.Unmap()}
+	}
+	if src := strings.TrimSpace(req.SourceIP); src != "" {
+		addr, err := netip.ParseAddr(src)
+		if err != nil {
+			return nil, fmt.Errorf("无效的来源 IP: %s", src)
+		}
+		t.source = addr.Unmap()
+	}
+	if t.Domain == "" && len(t.ips) == 0 {
+		return nil, fmt.Errorf("请输入域名或 IP")
+	}
+
+	result := &SimulateResult{RuleIndex: -1}
+	strategy := s.Routing.DomainStrategy
+	if strategy == "" {
+		strategy = "AsIs"
+	}
+
+	// IPOnDemand 在匹配前解析域名；IPIfNonMatch 在域名未命中任何规则后解析再匹配一次
+	if strategy == "IPOnDemand" && t.Domain != "" && len(t.ips) == 0 {
+		s.resolveInto(&t, result)
+	}
+	s.match(&t, result)
+	if result.RuleIndex < 0 && strategy == "IPIfNonMatch" && t.Domain != "" && len(t.ips) == 0 {
+		result.Explanation = append(result.Explanation, "域名未命中任何规则，按 IPIfNonMatch 解析后重新匹配")
+		if s.resolveInto(&t, result) {
+			result.Steps = nil
+			s.match(&t, result)
+		}
+	}
+
+	if result.RuleIndex < 0 {
+		if len(s.Outbounds) > 0 {
+			result.Outbound = s.Outbounds[0]
+		}
+		result.Explanation = append(result.Explanation, fmt.Sprintf("未命中任何规则，使用第一个出站 %s", result.Outbound))
+		return result, nil
+	}
+
+	rule := s.Routing.Rules[result.RuleIndex]
+	msg := fmt.Sprintf("命中第 %d 条规则", result.RuleIndex+1)
+	if rule.BalancerTag != "" {
+		result.Balancer = rule.BalancerTag
+		result.Candidates, result.Outbound = s.balancerMembers(rule.BalancerTag)
+		msg += fmt.Sprintf(" → 负载均衡 %s，候选出站: %s", rule.BalancerTag, strings.Join(result.Candidates, ", "))
+		if result.Outbound != "" {
+			msg += "（无可用出站时使用 " + result.Outbound + "）"
+		}
+	} else {
+		result.Outbound = rule.OutboundTag
+		msg += " → 出站 " + rule.OutboundTag
+	}
+	result.Explanation = append(result.Explanation, msg)
+	return result, nil
+}
+
+// resolveInto resolves the domain into the target's IPs
+func (s *Simulation) resolveInto(t *simTarget, result *SimulateResult) bool {
+	addrs, err := s.Resolve(t.Domain)
+	if err != nil || len(addrs) == 0 {
+		result.Explanation = append(result.Explanation, fmt.Sprintf("解析 %s 失败，IP 条件无法匹配", t.Domain))
+		return false
+	}
+	for _, addr := range addrs {
+		t.ips = append(t.ips, addr.Unmap())
+		result.ResolvedIPs = append(result.ResolvedIPs, addr.Unmap().String())
+	}
+	result.Explanation = append(result.Explanation, fmt.Sprintf("%s 解析为 %s（面板主机的 DNS，可能与 Xray 不同）",
+		t.Domain, strings.Join(result.ResolvedIPs, ", ")))
+	return true
+}
+
+// match evaluates the rules in order, stopping at the first match
+func (s *Simulation) match(t *simTarget, result *SimulateResult) {
+	for i, rule := range s.Routing.Rules {
+		matched, reason := s.matchRule(rule, t)
+		result.Steps = append(result.Steps, SimulateStep{Index: i, Rule: rule, Matched: matched, Reason: reason})
+		if matched {
+			result.RuleIndex = i
+			return
+		}
+	}
+}
+
+// matchRule checks every condition of a rule. Returns the matched conditions,
+// or the first one that does not match.
+func (s *Simulation) matchRule(rule RoutingRule, t *simTarget) (bool, string) {
+	var hits []string
+
+	if len(rule.InboundTag) > 0 {
+		if !containsString(rule.InboundTag, t.InboundTag) {
+			return false, "入站标签不匹配"
+		}
+		hits = append(hits, "入站 "+t.InboundTag)
+	}
+
+	if len(rule.Domain) > 0 {
+		if t.Domain == "" {
+			return false, "需要域名"
+		}
+		hit, err := s.matchDomains(rule.Domain, t.Domain)
+		if hit == "" {
+			if err != nil {
+				return false, "域名不匹配（" + err.Error() + "）"
+			}
+			return false, "域名不匹配"
+		}
+		hits = append(hits, "域名命中 "+hit)
+	}
+
+	if len(rule.IP) > 0 {
+		if len(t.ips) == 0 {
+			return false, "需要目标 IP"
+		}
+		hit, err := s.matchIPs(rule.IP, t.ips)
+		if hit == "" {
+			if err != nil {
+				return false, "IP 不匹配（" + err.Error() + "）"
+			}
+			return false, "IP 不匹配"
+		}
+		hits = append(hits, "IP 命中 "+hit)
+	}
+
+	if rule.Port != "" {
+		if !matchPortList(rule.Port, t.Port) {
+			return false, "端口 " + strconv.Itoa(t.Port) + " 不在 " + rule.Port
+		}
+		hits = append(hits, "端口 "+strconv.Itoa(t.Port)+" 在 "+rule.Port)
+	}
+
+	if rule.SourcePort != "" {
+		return false, "来源端口条件无法模拟"
+	}
+
+	if len(rule.Source) > 0 {
+		if !t.source.IsValid() {
+			return false, "需要来源 IP"
+		}
+		hit, err := s.matchIPs(rule.Source, []netip.Addr{t.source})
+		if hit == "" {
+			if err != nil {
+				return false, "来源 IP 不匹配（" + err.Error() + "）"
+			}
+			return false, "来源 IP 不匹配"
+		}
+		hits = append(hits, "来源 IP 命中 "+hit)
+	}
+
+	if rule.Network != "" {
+		if !containsString(strings.Split(strings.ReplaceAll(rule.Network, " ", ""), ","), t.Network) {
+			return false, "网络 " + t.Network + " 不在 " + rule.Network
+		}
+		hits = append(hits, "网络 "+t.Network)
+	}
+
+	if len(rule.Protocol) > 0 {
+		if !containsString(rule.Protocol, strings.ToLower(t.Protocol)) {
+			return false, "协议不匹配"
+		}
+		hits = append(hits, "协议 "+t.Protocol)
+	}
+
+	if len(rule.User) > 0 {
+		if !matchUser(rule.User, t.User) {
+			return false, "用户不匹配"
+		}
+		hits = append(hits, "用户 "+t.User)
+	}
+
+	if len(rule.Attrs) > 0 {
+		return false, "HTTP 属性条件无法模拟"
+	}
+
+	if len(hits) == 0 {
+		return true, "无条件"
+	}
+	return true, strings.Join(hits, "；")
+}
+
+// matchDomains returns the first entry matching the domain, in Xray's
+// notation: domain:, full:, keyword:, regexp:, dotless:, geosite:, ext:
+// (a plain value is a keyword)
+func (s *Simulation) matchDomains(entries []string, domain string) (string, error) {
+	var firstErr error
+	for _, entry := range entries {
+		ok, detail, err := s.matchDomain(entry, domain)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if ok {
+			if detail != "" {
+				return entry + "（" + detail + "）", nil
+			}
+			return entry, nil
+		}
+	}
+	return "", firstErr
+}
+
+func (s *Simulation) matchDomain(entry, domain string) (bool, string, error) {
+	prefix, value, ok := strings.Cut(entry, ":")
+	if !ok {
+		return strings.Contains(domain, strings.ToLower(entry)), "", nil
+	}
+
+	switch prefix {
+	case "domain":
+		value = strings.ToLower(value)
+		return domain == value || strings.HasSuffix(domain, "."+value), "", nil
+	case "full":
+		return domain == strings.ToLower(value), "", nil
+	case "keyword":
+		return strings.Contains(domain, strings.ToLower(value)), "", nil
+	case "regexp":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return false, "", fmt.Errorf("正则无效: %s", value)
+		}
+		return re.MatchString(domain), "", nil
+	case "dotless":
+		return !strings.Contains(domain, ".") && strings.Contains(domain, strings.ToLower(value)), "", nil
+	case "geosite":
+		return s.matchGeoSite("geosite.dat", value, domain)
+	case "ext":
+		file, tag, ok := strings.Cut(value, ":")
+		if !ok {
+			return false, "", fmt.Errorf("无效的引用: %s", entry)
+		}
+		return s.matchGeoSite(file, tag, domain)
+	}
+	// 其他前缀 Xray 不识别，整条按关键字匹配
+	return strings.Contains(domain, strings.ToLower(entry)), "", nil
+}
+
+// matchGeoSite checks a domain against a category, optionally restricted to
+// rules with an attribute (category@attr)
+func (s *Simulation) matchGeoSite(file, category, domain string) (bool, string, error) {
+	category, attr, _ := strings.Cut(strings.ToLower(category), "@")
+	index, err := s.geo.GeoSiteFile(file)
+	if err != nil {
+		return false, "", fmt.Errorf("读取 %s 失败", file)
+	}
+	if _, ok := index.Domains(category, ""); !ok {
+		return false, "", fmt.Errorf("%s 中没有分类 %s", file, category)
+	}
+	for _, m := range index.Lookup(domain) {
+		if m.Category == category && (attr == "" || m.Rule.HasAttribute(attr)) {
+			return true, m.Rule.String(), nil
+		}
+	}
+	return false, "", nil
+}
+
+// matchIPs returns the first entry containing any of the addresses:
+// IP, CIDR, geoip:[!]code or ext:file:[!]code
+func (s *Simulation) matchIPs(entries []string, addrs []netip.Addr) (string, error) {
+	var firstErr error
+	for _, entry := range entries {
+		for _, addr := range addrs {
+			ok, err := s.matchIP(entry, addr)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if ok {
+				return entry + "（" + addr.String() + "）", nil
+			}
+		}
+	}
+	return "", firstErr
+}
+
+func (s *Simulation) matchIP(entry string, addr netip.Addr) (bool, error) {
+	switch {
+	case strings.HasPrefix(entry, "geoip:"):
+		return s.matchGeoIP("geoip.dat", strings.TrimPrefix(entry, "geoip:"), addr)
+	case strings.HasPrefix(entry, "ext:"):
+		file, code, ok := strings.Cut(strings.TrimPrefix(entry, "ext:"), ":")
+		if !ok {
+			return false, fmt.Errorf("无效的引用: %s", entry)
+		}
+		return s.matchGeoIP(file, code, addr)
+	}
+
+	if ip, err := netip.ParseAddr(entry); err == nil {
+		return ip.Unmap() == addr, nil
+	}
+	prefix, err := netip.ParsePrefix(entry)
+	if err != nil {
+		return false, fmt.Errorf("无效的 IP: %s", entry)
+	}
+	return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Contains(addr), nil
+}
+
+// matchGeoIP checks an address against a geoip code; "!code" matches
+// addresses outside it
+func (s *Simulation) matchGeoIP(file, code string, addr netip.Addr) (bool, error) {
+	code = strings.ToLower(code)
+	negate := strings.HasPrefix(code, "!")
+	code = strings.TrimPrefix(code, "!")
+
+	index, err := s.geo.GeoIPFile(file)
+	if err != nil {
+		return false, fmt.Errorf("读取 %s 失败", file)
+	}
+	if _, ok := index.CIDRs(code); !ok {
+		return false, fmt.Errorf("%s 中没有代码 %s", file, code)
+	}
+	in := false
+	for _, m := range index.Lookup(addr) {
+		if m.Code == code {
+			in = true
+			break
+		}
+	}
+	return in != negate, nil
+}
+
+// balancerMembers returns the outbounds a balancer selects from (selector
+// entries are tag prefixes) and its fallback
+func (s *Simulation) balancerMembers(tag string) ([]string, string) {
+	for _, b := range s.Routing.Balancers {
+		if b.Tag != tag {
+			continue
+		}
+		var members []string
+		for _, outbound := range s.Outbounds {
+			for _, prefix := range b.Selector {
+				if strings.HasPrefix(outbound, prefix) {
+					members = append(members, outbound)
+					break
+				}
+			}
+		}
+		return members, b.FallbackTag
+	}
+	return nil, ""
+}
+
+// matchPortList reports whether port is in a list like "53,443,1000-2000"
+func matchPortList(list string, port int) bool {
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		lo, err1 := strconv.Atoi(strings.TrimSpace(from))
+		hi, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 == nil && err2 == nil && port >= lo && port <= hi {
+			return true
+		}
+	}
+	return false
+}
+
+// matchUser matches a user email; entries may use the regexp: prefix
+func matchUser(entries []string, user string) bool {
+	if user == "" {
+		return false
+	}
+	for _, entry := range entries {
+		if pattern, ok := strings.CutPrefix(entry, "regexp:"); ok {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(user) {
+				return true
+			}
+		} else if entry == user {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDomain looks up a domain with the system resolver
+func resolveDomain(domain string) ([]netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", domain)
+}
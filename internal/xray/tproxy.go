@@ -0,0 +1,227 @@
+package xray
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"xray-panel/internal/models"
+)
+
+// TProxyTable is the nftables table holding the transparent proxy rules
+const TProxyTable = "xray_panel"
+
+// PrivateCIDRs are the reserved destinations that never go through the gateway
+var PrivateCIDRs = []string{
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+}
+
+// generateTProxyInbound builds the dokodemo-door inbound nftables diverts
+// LAN traffic to
+func (g *Generator) generateTProxyInbound() InboundConfig {
+	listen := "0.0.0.0"
+	if g.transparentProxy.IPv6 {
+		listen = "::"
+	}
+	destOverride := []string{"http", "tls", "quic"}
+	if g.fakeDNSEnabled() {
+		destOverride = append(destOverride, "fakedns")
+	}
+	return InboundConfig{
+		Tag:      models.TransparentProxyTag,
+		Listen:   listen,
+		Port:     g.transparentProxy.Port,
+		Protocol: "dokodemo-door",
+		Settings: map[string]interface{}{
+			"network":        "tcp,udp",
+			"followRedirect": true,
+		},
+		StreamSettings: &StreamSettings{
+			Network: "tcp",
+			Sockopt: &SockoptConfig{TProxy: "tproxy"},
+		},
+		Sniffing: &SniffingConfig{
+			Enabled:      true,
+			DestOverride: destOverride,
+			RouteOnly:    true,
+		},
+	}
+}
+
+// TProxyPlan is the host setup for the TPROXY gateway: an nftables ruleset
+// loaded with `nft -f -` and the ip rule / route commands around it
+type TProxyPlan struct {
+	Ruleset  string
+	Setup    [][]string // run after loading the ruleset, see IsRuleDel
+	Teardown [][]string // run on removal; errors are ignored
+}
+
+// NewTProxyPlan builds the host setup. bypass holds the destinations that
+// are not diverted (private ranges are always added); overlapping prefixes
+// are merged since nftables interval sets reject them. divert holds
+// destinations diverted even inside the bypass set, i.e. the FakeDNS pools.
+func NewTProxyPlan(opts models.TransparentProxyOptions, bypass, divert []netip.Prefix) *TProxyPlan {
+	for _, cidr := range PrivateCIDRs {
+		bypass = append(bypass, netip.MustParsePrefix(cidr))
+	}
+	var v4, v6 []netip.Prefix
+	for _, p := range mergePrefixes(bypass) {
+		if p.Addr().Is4() {
+			v4 = append(v4, p)
+		} else {
+			v6 = append(v6, p)
+		}
+	}
+
+	mark := strconv.Itoa(opts.Mark)
+	table := strconv.Itoa(opts.RouteTable)
+	port := strconv.Itoa(opts.Port)
+
+	var b strings.Builder
+	// 先声明再删除，重复执行时原子替换旧规则
+	fmt.Fprintf(&b, "table inet %s\ndelete table inet %s\n\n", TProxyTable, TProxyTable)
+	fmt.Fprintf(&b, "table inet %s {\n", TProxyTable)
+	writeNftSet(&b, "bypass4", "ipv4_addr", v4)
+	if opts.IPv6 {
+		writeNftSet(&b, "bypass6", "ipv6_addr", v6)
+	}
+	b.WriteString("\tchain prerouting {\n")
+	b.WriteString("\t\ttype filter hook prerouting priority mangle; policy accept;\n")
+	b.WriteString("\t\tfib daddr type local return\n")
+	// 已建立的透明代理连接直接送往本机 socket
+	fmt.Fprintf(&b, "\t\tmeta l4proto tcp socket transparent 1 meta mark set %s accept\n", mark)
+	for _, p := range mergePrefixes(divert) {
+		if p.Addr().Is4() {
+			fmt.Fprintf(&b, "\t\tip daddr %s meta l4proto { tcp, udp } meta mark set %s tproxy ip to :%s accept\n", p, mark, port)
+		} else if opts.IPv6 {
+			fmt.Fprintf(&b, "\t\tip6 daddr %s meta l4proto { tcp, udp } meta mark set %s tproxy ip6 to :%s accept\n", p, mark, port)
+		}
+	}
+	b.WriteString("\t\tip daddr @bypass4 return\n")
+	if opts.IPv6 {
+		b.WriteString("\t\tip6 daddr @bypass6 return\n")
+	} else {
+		b.WriteString("\t\tmeta nfproto ipv6 return\n")
+	}
+	fmt.Fprintf(&b, "\t\tmeta nfproto ipv4 meta l4proto { tcp, udp } meta mark set %s tproxy ip to :%s accept\n", mark, port)
+	if opts.IPv6 {
+		fmt.Fprintf(&b, "\t\tmeta nfproto ipv6 meta l4proto { tcp, udp } meta mark set %s tproxy ip6 to :%s accept\n", mark, port)
+	}
+	b.WriteString("\t}\n}\n")
+
+	plan := &TProxyPlan{Ruleset: b.String()}
+	families := []string{"-4"}
+	if opts.IPv6 {
+		families = append(families, "-6")
+	}
+	for _, family := range families {
+		local := "0.0.0.0/0"
+		if family == "-6" {
+			local = "::/0"
+		}
+		plan.Setup = append(plan.Setup,
+			[]string{"ip", family, "rule", "del", "fwmark", mark, "table", table},
+			[]string{"ip", family, "rule", "add", "fwmark", mark, "table", table},
+			[]string{"ip", family, "route", "replace", "local", local, "dev", "lo", "table", table},
+		)
+	}
+	plan.Teardown = append(plan.Teardown, []string{"nft", "delete", "table", "inet", TProxyTable})
+	for _, family := range []string{"-4", "-6"} {
+		plan.Teardown = append(plan.Teardown,
+			[]string{"ip", family, "rule", "del", "fwmark", mark, "table", table},
+			[]string{"ip", family, "route", "flush", "table", table},
+		)
+	}
+	return plan
+}
+
+// Script renders the plan as a shell script for review (dry run)
+func (p *TProxyPlan) Script() string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n# 透明代理网关规则（预览，未执行）\n\n")
+	b.WriteString("nft -f - <<'EOF'\n")
+	b.WriteString(p.Ruleset)
+	b.WriteString("EOF\n\n")
+	for _, args := range p.Setup {
+		b.WriteString(scriptLine(args) + "\n")
+	}
+	b.WriteString("\n# 清除:\n")
+	for _, args := range p.Teardown {
+		b.WriteString("# " + scriptLine(args) + "\n")
+	}
+	return b.String()
+}
+
+// scriptLine renders a command; rule deletions repeat until no matching
+// rule is left and may fail on the first run
+func scriptLine(args []string) string {
+	line := strings.Join(args, " ")
+	if IsRuleDel(args) {
+		return "while " + line + " 2>/dev/null; do :; done"
+	}
+	return line
+}
+
+// IsRuleDel reports whether a command removes a policy rule. It is repeated
+// until it fails, which is expected once no matching rule is left.
+func IsRuleDel(args []string) bool {
+	return len(args) > 3 && args[2] == "rule" && args[3] == "del"
+}
+
+// writeNftSet writes an interval set of prefixes
+func writeNftSet(b *strings.Builder, name, typ string, prefixes []netip.Prefix) {
+	fmt.Fprintf(b, "\tset %s {\n\t\ttype %s\n\t\tflags interval\n", name, typ)
+	if len(prefixes) > 0 {
+		elements := make([]string, len(prefixes))
+		for i, p := range prefixes {
+			elements[i] = p.String()
+		}
+		b.WriteString("\t\telements = {\n")
+		for i := 0; i < len(elements); i += 8 {
+			end := i + 8
+			if end > len(elements) {
+				end = len(elements)
+			}
+			b.WriteString("\t\t\t" + strings.Join(elements[i:end], ", "))
+			if end < len(elements) {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\t\t}\n")
+	}
+	b.WriteString("\t}\n\n")
+}
+
+// mergePrefixes sorts the prefixes and drops those covered by another one
+func mergePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.IsValid() {
+			sorted = append(sorted, p.Masked())
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+
+	var merged []netip.Prefix
+	for _, p := range sorted {
+		if n := len(merged); n > 0 {
+			last := merged[n-1]
+			if last.Addr().BitLen() == p.Addr().BitLen() && last.Bits() <= p.Bits() && last.Contains(p.Addr()) {
+				continue
+			}
+		}
+		merged = append(merged, p)
+	}
+	return merged
+}
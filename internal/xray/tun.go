@@ -0,0 +1,194 @@
+package xray
+
+import (
+	"encoding/json"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"xray-panel/internal/models"
+)
+
+// Policy routing priorities of the TUN rules: exclusions first, then the
+// catch-all lookup of the TUN table
+const (
+	TunExcludePref = 9000
+	TunRoutePref   = 9001
+)
+
+// tunEnabled reports whether the TUN inbound is generated
+func (g *Generator) tunEnabled() bool {
+	return g.panelMode == "client" && g.tun.Enabled
+}
+
+// generateTunInbound builds the TUN inbound; Xray creates the interface and
+// the panel assigns its addresses and routes
+func (g *Generator) generateTunInbound() InboundConfig {
+	destOverride := []string{"http", "tls", "quic"}
+	if g.fakeDNSEnabled() {
+		destOverride = append(destOverride, "fakedns")
+	}
+	return InboundConfig{
+		Tag:      models.TunTag,
+		Port:     0,
+		Protocol: "tun",
+		Settings: map[string]interface{}{
+			"name": g.tun.Name,
+			"MTU":  g.tun.MTU,
+		},
+		Sniffing: &SniffingConfig{
+			Enabled:      true,
+			DestOverride: destOverride,
+			RouteOnly:    true,
+		},
+	}
+}
+
+// markOutbounds sets the TUN mark on every outbound that opens connections
+func (g *Generator) markOutbounds(outbounds []OutboundConfig) {
+	for i := range outbounds {
+		if outbounds[i].Protocol == "blackhole" || outbounds[i].Protocol == "loopback" {
+			continue
+		}
+		if outbounds[i].StreamSettings == nil {
+			outbounds[i].StreamSettings = &StreamSettings{Network: "tcp"}
+		}
+		if outbounds[i].StreamSettings.Sockopt == nil {
+			outbounds[i].StreamSettings.Sockopt = &SockoptConfig{}
+		}
+		outbounds[i].StreamSettings.Sockopt.Mark = g.tun.Mark
+	}
+}
+
+// ServerEndpoints returns the hosts (domains or IPs) the outbounds of a
+// config connect to
+func ServerEndpoints(config *Config) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	add := func(host string) {
+		if host = strings.Trim(strings.TrimSpace(host), "[]"); host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+
+	for _, outbound := range config.Outbounds {
+		data, err := json.Marshal(outbound.Settings)
+		if err != nil {
+			continue
+		}
+		var settings struct {
+			Vnext   []struct{ Address string }
+			Servers []struct{ Address string }
+			Peers   []struct{ Endpoint string }
+		}
+		if json.Unmarshal(data, &settings) != nil {
+			continue
+		}
+		for _, server := range settings.Vnext {
+			add(server.Address)
+		}
+		for _, server := range settings.Servers {
+			add(server.Address)
+		}
+		for _, peer := range settings.Peers {
+			host, _, err := net.SplitHostPort(peer.Endpoint)
+			if err != nil {
+				host = peer.Endpoint
+			}
+			add(host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// TunPlan is the host setup for the TUN interface Xray created: addresses,
+// a default route in the TUN table and the policy rules selecting it
+type TunPlan struct {
+	Setup    [][]string // run after the teardown, so reapplying is idempotent
+	Teardown [][]string // errors are ignored
+}
+
+// NewTunPlan builds the host setup. exclude holds the destinations that keep
+// using the main table (private ranges are always added), e.g. the proxy
+// servers; divert holds destinations sent into the TUN even inside the
+// excluded ranges, i.e. the FakeDNS pools.
+func NewTunPlan(opts models.TunOptions, exclude, divert []netip.Prefix) *TunPlan {
+	for _, cidr := range PrivateCIDRs {
+		exclude = append(exclude, netip.MustParsePrefix(cidr))
+	}
+
+	var addrs4, addrs6 []string
+	for _, addr := range opts.AddressList() {
+		if prefix, err := netip.ParsePrefix(addr); err == nil && prefix.Addr().Is4() {
+			addrs4 = append(addrs4, addr)
+		} else if err == nil {
+			addrs6 = append(addrs6, addr)
+		}
+	}
+
+	mark := strconv.Itoa(opts.Mark)
+	table := strconv.Itoa(opts.RouteTable)
+	excludePref := strconv.Itoa(TunExcludePref)
+	routePref := strconv.Itoa(TunRoutePref)
+
+	plan := &TunPlan{}
+	for _, family := range []string{"-4", "-6"} {
+		plan.Teardown = append(plan.Teardown,
+			[]string{"ip", family, "rule", "del", "pref", excludePref},
+			[]string{"ip", family, "rule", "del", "pref", routePref},
+			[]string{"ip", family, "route", "flush", "table", table},
+		)
+	}
+	plan.Setup = append(plan.Setup, []string{"ip", "link", "set", "dev", opts.Name, "up"})
+
+	for _, family := range []string{"-4", "-6"} {
+		addrs, is4 := addrs4, true
+		if family == "-6" {
+			addrs, is4 = addrs6, false
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+		for _, addr := range addrs {
+			plan.Setup = append(plan.Setup, []string{"ip", family, "addr", "replace", addr, "dev", opts.Name})
+		}
+		plan.Setup = append(plan.Setup,
+			[]string{"ip", family, "route", "replace", "default", "dev", opts.Name, "table", table},
+			[]string{"ip", family, "rule", "add", "fwmark", mark, "lookup", "main", "pref", excludePref},
+		)
+		for _, prefix := range mergePrefixes(divert) {
+			if prefix.Addr().Is4() == is4 {
+				plan.Setup = append(plan.Setup, []string{"ip", family, "rule", "add", "to", prefix.String(), "lookup", table, "pref", excludePref})
+			}
+		}
+		for _, prefix := range mergePrefixes(exclude) {
+			if prefix.Addr().Is4() == is4 {
+				plan.Setup = append(plan.Setup, []string{"ip", family, "rule", "add", "to", prefix.String(), "lookup", "main", "pref", excludePref})
+			}
+		}
+		plan.Setup = append(plan.Setup, []string{"ip", family, "rule", "add", "lookup", table, "pref", routePref})
+	}
+	return plan
+}
+
+// Script renders the plan as a shell script for review (dry run)
+func (p *TunPlan) Script() string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n# TUN 路由（预览，未执行）\n\n# 清除旧规则\n")
+	for _, args := range p.Teardown {
+		line := scriptLine(args)
+		if !IsRuleDel(args) {
+			line += " 2>/dev/null || true"
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n")
+	for _, args := range p.Setup {
+		b.WriteString(scriptLine(args) + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,26 @@
+package xray
+
+import (
+	"testing"
+	"time"
+
+	"xray-panel/internal/models"
+)
+
+func TestActiveUsersSkipKicked(t *testing.T) {
+	now := time.Now()
+	g := NewGenerator().SetUsers([]models.User{
+		{Name: "ok", Enabled: true},
+		{Name: "kicked", Enabled: true, KickedUntil: now.Add(10 * time.Minute)},
+		{Name: "expired-kick", Enabled: true, KickedUntil: now.Add(-time.Minute)},
+		{Name: "disabled", Enabled: false},
+	})
+
+	var names []string
+	for _, u := range g.getActiveUsers() {
+		names = append(names, u.Name)
+	}
+	if len(names) != 2 || names[0] != "ok" || names[1] != "expired-kick" {
+		t.Errorf("active users = %v, want [ok expired-kick]", names)
+	}
+}
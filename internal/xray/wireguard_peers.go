@@ -0,0 +1,130 @@
+package xray
+
+import (
+	"sort"
+
+	"xray-panel/internal/models"
+)
+
+// Xray's WireGuard peers carry no email, so each provisioned peer is routed
+// by its tunnel IP through a loopback outbound named after it. The loopback's
+// outbound stats are the peer's traffic, and the re-injected connection is
+// routed again with the peer's tag as inbound tag.
+
+// wgPeersByInbound returns the peers that are generated, keyed by inbound tag:
+// enabled peers of enabled WireGuard inbounds whose user (if any) is active
+func (g *Generator) wgPeersByInbound() map[string][]models.WireGuardPeer {
+	active := make(map[string]bool)
+	for _, u := range g.getActiveUsers() {
+		active[u.ID] = true
+	}
+	tags := make(map[string]string)
+	for _, inbound := range g.inbounds {
+		if inbound.Enabled && inbound.Protocol == models.ProtocolWireGuard {
+			tags[inbound.ID] = inbound.Tag
+		}
+	}
+
+	byInbound := make(map[string][]models.WireGuardPeer)
+	for _, p := range g.wgPeers {
+		tag, ok := tags[p.InboundID]
+		if !ok || !p.Enabled || (!p.IsRelay() && !active[p.UserID]) {
+			continue
+		}
+		byInbound[tag] = append(byInbound[tag], p)
+	}
+	return byInbound
+}
+
+// wgPeerSettings returns the Xray peers of a WireGuard inbound
+func (g *Generator) wgPeerSettings(inbound models.Inbound) []map[string]interface{} {
+	peers := make([]map[string]interface{}, 0)
+	// 旧版单对端（中转节点），放行全部地址
+	if inbound.WGPeerPubKey != "" {
+		peers = append(peers, map[string]interface{}{
+			"publicKey":  inbound.WGPeerPubKey,
+			"allowedIPs": []string{"0.0.0.0/0", "::/0"},
+		})
+	}
+	for _, p := range g.wgPeersByInbound()[inbound.Tag] {
+		peer := map[string]interface{}{
+			"publicKey":  p.PublicKey,
+			"allowedIPs": []string{p.Address},
+		}
+		if p.PresharedKey != "" {
+			peer["preSharedKey"] = p.PresharedKey
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// generateWGPeerOutbounds builds the loopback outbound of every peer
+func (g *Generator) generateWGPeerOutbounds() []OutboundConfig {
+	var outbounds []OutboundConfig
+	for _, tag := range g.wgInboundTags() {
+		for _, p := range g.wgPeersByInbound()[tag] {
+			outbounds = append(outbounds, OutboundConfig{
+				Tag:      p.StatsTag(),
+				Protocol: "loopback",
+				Settings: map[string]interface{}{
+					"inboundTag": p.StatsTag(),
+				},
+			})
+		}
+	}
+	return outbounds
+}
+
+// generateWGPeerRules sends each peer's traffic to its loopback outbound
+func (g *Generator) generateWGPeerRules() []RoutingRule {
+	var rules []RoutingRule
+	for _, tag := range g.wgInboundTags() {
+		for _, p := range g.wgPeersByInbound()[tag] {
+			rules = append(rules, RoutingRule{
+				Type:        "field",
+				InboundTag:  []string{tag},
+				Source:      []string{p.TunnelIP()},
+				OutboundTag: p.StatsTag(),
+			})
+		}
+	}
+	return rules
+}
+
+// expandWGInboundTags adds the peer tags of the WireGuard inbounds a rule
+// matches, so rules written for the inbound keep applying to its peers
+func (g *Generator) expandWGInboundTags(inboundTags []string) []string {
+	byInbound := g.wgPeersByInbound()
+	expanded := inboundTags
+	for _, tag := range inboundTags {
+		for _, p := range byInbound[tag] {
+			expanded = append(expanded, p.StatsTag())
+		}
+	}
+	return expanded
+}
+
+// wgUserPeerTags returns the peer tags of a user
+func (g *Generator) wgUserPeerTags(userID string) []string {
+	var tags []string
+	for _, tag := range g.wgInboundTags() {
+		for _, p := range g.wgPeersByInbound()[tag] {
+			if p.UserID == userID {
+				tags = append(tags, p.StatsTag())
+			}
+		}
+	}
+	return tags
+}
+
+// wgInboundTags returns the tags of the inbounds with peers, sorted
+func (g *Generator) wgInboundTags() []string {
+	byInbound := g.wgPeersByInbound()
+	tags := make([]string, 0, len(byInbound))
+	for tag := range byInbound {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}